@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
-	"strings"
+	"os"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 
 	"syncforge/database"
 	"syncforge/updater"
@@ -12,6 +14,7 @@ import (
 type App struct {
 	ctx             context.Context
 	connectionStore *database.ConnectionStore
+	mappingStore    *database.MappingStore
 }
 
 // NewApp creates a new App application struct
@@ -25,6 +28,11 @@ func (a *App) startup(ctx context.Context) {
 	store, err := database.NewConnectionStore()
 	if err == nil {
 		a.connectionStore = store
+		database.UseSavedSecrets(store)
+	}
+	mappings, err := database.NewMappingStore()
+	if err == nil {
+		a.mappingStore = mappings
 	}
 }
 
@@ -38,6 +46,11 @@ func (a *App) GetDatabases(config database.ConnectionConfig) ([]string, error) {
 	return database.GetDatabases(config)
 }
 
+// GetSchemaNames returns the schemas that can be selected for a connection
+func (a *App) GetSchemaNames(config database.ConnectionConfig) ([]string, error) {
+	return database.GetSchemaNames(config)
+}
+
 // GetSchema retrieves database schema
 func (a *App) GetSchema(config database.ConnectionConfig) (*database.SchemaInfo, error) {
 	return database.GetSchema(config)
@@ -58,78 +71,38 @@ func (a *App) CompareSchemas(source, target database.ConnectionConfig) ([]databa
 	return database.CompareSchemas(sourceSchema, targetSchema), nil
 }
 
-// ExecuteSQL executes SQL on target database
-func (a *App) ExecuteSQL(config database.ConnectionConfig, sql string) error {
-	db, err := database.Connect(config)
+// GetMigrationPlan compares two schemas and returns the differences as an
+// ordered script that can be executed on the target
+func (a *App) GetMigrationPlan(source, target database.ConnectionConfig) (*database.MigrationPlan, error) {
+	sourceSchema, err := database.GetSchema(source)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer db.Close()
 
-	// MySQL supports multi-statement execution via DSN config
-	// For other databases, execute statements one by one
-	dbType := config.Type
-	if dbType == "" || dbType == database.MySQL {
-		_, err = db.Exec(sql)
-		return err
+	targetSchema, err := database.GetSchema(target)
+	if err != nil {
+		return nil, err
 	}
 
-	// Split and execute statements one by one for non-MySQL databases
-	statements := splitSQLStatements(sql)
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
-		}
-		if _, err := db.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// splitSQLStatements splits SQL string into individual statements
-func splitSQLStatements(sql string) []string {
-	var statements []string
-	var current strings.Builder
-	inString := false
-	stringChar := rune(0)
-
-	for i, c := range sql {
-		if inString {
-			current.WriteRune(c)
-			// Check for end of string (handle escaped quotes)
-			if c == stringChar {
-				// Check if it's an escaped quote (two consecutive quotes)
-				if i+1 < len(sql) && rune(sql[i+1]) == stringChar {
-					continue
-				}
-				inString = false
-			}
-		} else {
-			if c == '\'' || c == '"' {
-				inString = true
-				stringChar = c
-				current.WriteRune(c)
-			} else if c == ';' {
-				stmt := strings.TrimSpace(current.String())
-				if stmt != "" {
-					statements = append(statements, stmt)
-				}
-				current.Reset()
-			} else {
-				current.WriteRune(c)
-			}
-		}
-	}
-
-	// Add any remaining statement
-	stmt := strings.TrimSpace(current.String())
-	if stmt != "" {
-		statements = append(statements, stmt)
-	}
-
-	return statements
+	diffs := database.CompareSchemas(sourceSchema, targetSchema)
+	return database.PlanMigration(sourceSchema, targetSchema, diffs), nil
+}
+
+// ExecuteSQL executes SQL on target database
+func (a *App) ExecuteSQL(config database.ConnectionConfig, sql string) error {
+	return database.ExecuteSQL(config, sql)
+}
+
+// ExecuteSQLTransaction executes SQL on target database in one transaction,
+// reporting the failed statement and whether the rollback succeeded
+func (a *App) ExecuteSQLTransaction(config database.ConnectionConfig, sql string) (*database.ExecutionResult, error) {
+	return database.ExecuteSQLTransaction(config, sql)
+}
+
+// ExecuteDataDiffs applies data differences as prepared statements in a single transaction,
+// batching or bulk loading inserts as options say
+func (a *App) ExecuteDataDiffs(config database.ConnectionConfig, diffs []database.DataDiffResult, options database.DataApplyOptions) (*database.ExecutionResult, error) {
+	return database.ExecuteDataDiffs(config, diffs, options)
 }
 
 // GetTablesForSync returns tables available for data sync
@@ -137,14 +110,34 @@ func (a *App) GetTablesForSync(config database.ConnectionConfig) ([]database.Tab
 	return database.GetTablesForSync(config)
 }
 
-// CompareTableData compares data between source and target tables
-func (a *App) CompareTableData(source, target database.ConnectionConfig, tableName string) ([]database.DataDiffResult, error) {
-	return database.CompareTableData(source, target, tableName)
+// CompareTableData compares data between source and target tables; an empty targetTable uses the source table's name
+func (a *App) CompareTableData(source, target database.ConnectionConfig, sourceTable, targetTable string) ([]database.DataDiffResult, error) {
+	return database.CompareTableData(source, target, sourceTable, targetTable)
+}
+
+// CompareTableDataWithOptions compares table data with options such as checksum blocks
+func (a *App) CompareTableDataWithOptions(source, target database.ConnectionConfig, sourceTable, targetTable string, options database.DataCompareOptions) ([]database.DataDiffResult, error) {
+	return database.CompareTableDataWithOptions(source, target, sourceTable, targetTable, options)
+}
+
+// CompareDataSync compares a table per a sync configuration, optionally producing upserts
+func (a *App) CompareDataSync(config database.DataSyncConfig) ([]database.DataDiffResult, error) {
+	return database.CompareDataSync(config)
 }
 
-// GetDataSyncSummary returns sync summary for a table
-func (a *App) GetDataSyncSummary(source, target database.ConnectionConfig, tableName string) (*database.TableDataInfo, error) {
-	return database.GetDataSyncSummary(source, target, tableName)
+// ApplyDataSync compares the configured tables and applies the enabled kinds of changes in one transaction
+func (a *App) ApplyDataSync(config database.DataSyncConfig) (*database.DataSyncResult, error) {
+	return database.ApplyDataSync(config)
+}
+
+// GetDataSyncSummary returns sync summary for a table; an empty targetTable uses the source table's name
+func (a *App) GetDataSyncSummary(source, target database.ConnectionConfig, sourceTable, targetTable string) (*database.TableDataInfo, error) {
+	return database.GetDataSyncSummary(source, target, sourceTable, targetTable)
+}
+
+// GetDataSyncSummaryWithOptions returns sync summary for a table with options such as a row filter
+func (a *App) GetDataSyncSummaryWithOptions(source, target database.ConnectionConfig, sourceTable, targetTable string, options database.DataCompareOptions) (*database.TableDataInfo, error) {
+	return database.GetDataSyncSummaryWithOptions(source, target, sourceTable, targetTable, options)
 }
 
 // CreateDatabase creates a new database
@@ -167,12 +160,12 @@ func (a *App) GetAllTables(config database.ConnectionConfig) ([]database.TableDa
 	return database.GetAllTables(config)
 }
 
-// GetSavedConnections returns all saved connections
+// GetSavedConnections returns all saved connections, with secrets redacted
 func (a *App) GetSavedConnections() []database.SavedConnection {
 	if a.connectionStore == nil {
 		return []database.SavedConnection{}
 	}
-	return a.connectionStore.GetAll()
+	return a.connectionStore.GetAllRedacted()
 }
 
 // SaveConnection saves a connection configuration
@@ -194,6 +187,112 @@ func (a *App) DeleteConnection(name string) error {
 	return a.connectionStore.Delete(name)
 }
 
+// GetConnectionStoreState tells whether saved passwords are encrypted and locked
+func (a *App) GetConnectionStoreState() database.StoreState {
+	if a.connectionStore == nil {
+		return database.StoreState{}
+	}
+	return a.connectionStore.State()
+}
+
+// UnlockConnections decrypts saved passwords with the master passphrase
+func (a *App) UnlockConnections(passphrase string) error {
+	if a.connectionStore == nil {
+		return nil
+	}
+	return a.connectionStore.Unlock(passphrase)
+}
+
+// LockConnections forgets the master passphrase until the next unlock
+func (a *App) LockConnections() {
+	if a.connectionStore == nil {
+		return
+	}
+	a.connectionStore.Lock()
+}
+
+// SetConnectionPassphrase encrypts saved passwords with a new master passphrase,
+// or removes the encryption if it is empty
+func (a *App) SetConnectionPassphrase(passphrase string) error {
+	if a.connectionStore == nil {
+		return nil
+	}
+	return a.connectionStore.SetPassphrase(passphrase)
+}
+
+// ExportConnections writes the selected connections to a file the user picks,
+// returning its path, or "" if the dialog was cancelled
+func (a *App) ExportConnections(options database.ExportOptions) (string, error) {
+	if a.connectionStore == nil {
+		return "", nil
+	}
+	data, err := a.connectionStore.Export(options)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Connections",
+		DefaultFilename: "syncforge-connections.json",
+		Filters:         []runtime.FileFilter{{DisplayName: "Connections (*.json)", Pattern: "*.json"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0600)
+}
+
+// ImportConnections adds the connections of a file the user picks: a SyncForge
+// export, a DBeaver data-sources.json or a Navicat .ncx. It returns nil if the
+// dialog was cancelled.
+func (a *App) ImportConnections(options database.ImportOptions) (*database.ImportResult, error) {
+	if a.connectionStore == nil {
+		return nil, nil
+	}
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Connections",
+		Filters: []runtime.FileFilter{{DisplayName: "Connections (*.json, *.ncx)", Pattern: "*.json;*.ncx"}},
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.connectionStore.Import(data, options)
+}
+
+// GetMappingSets returns all saved table mapping sets
+func (a *App) GetMappingSets() []database.MappingSet {
+	if a.mappingStore == nil {
+		return []database.MappingSet{}
+	}
+	return a.mappingStore.GetAll()
+}
+
+// SaveMappingSet saves a table mapping set
+func (a *App) SaveMappingSet(set database.MappingSet) error {
+	if a.mappingStore == nil {
+		return nil
+	}
+	return a.mappingStore.Save(set)
+}
+
+// DeleteMappingSet deletes a saved table mapping set
+func (a *App) DeleteMappingSet(name string) error {
+	if a.mappingStore == nil {
+		return nil
+	}
+	return a.mappingStore.Delete(name)
+}
+
+// SuggestTableMappings pairs source and target tables whose names differ by a prefix
+func (a *App) SuggestTableMappings(sourceTables, targetTables []string, sourcePrefix, targetPrefix string) []database.TableMapping {
+	return database.MapTablesByPrefix(sourceTables, targetTables, sourcePrefix, targetPrefix)
+}
+
 // GetAppVersion returns the current app version
 func (a *App) GetAppVersion() string {
 	return updater.GetCurrentVersion()
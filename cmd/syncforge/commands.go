@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"syncforge/database"
+)
+
+// connectionPair holds the flags shared by every command
+type connectionPair struct {
+	source *connectionFlags
+	target *connectionFlags
+	format *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *connectionPair) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	pair := &connectionPair{
+		source: addConnectionFlags(fs, "source"),
+		target: addConnectionFlags(fs, "target"),
+		format: fs.String("format", "text", "output format: text or json"),
+	}
+	return fs, pair
+}
+
+// configs resolves both connections and checks the output format
+func (p *connectionPair) configs() (source, target database.ConnectionConfig, err error) {
+	if *p.format != "text" && *p.format != "json" {
+		return source, target, fmt.Errorf("unknown format %q, expected text or json", *p.format)
+	}
+	if source, err = p.source.config(); err != nil {
+		return source, target, err
+	}
+	if target, err = p.target.config(); err != nil {
+		return source, target, err
+	}
+	return source, target, nil
+}
+
+func (p *connectionPair) json() bool {
+	return *p.format == "json"
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// loadSchemas reads both schemas and plans the migration between them
+func loadSchemas(source, target database.ConnectionConfig) ([]database.DiffResult, *database.MigrationPlan, error) {
+	sourceSchema, err := database.GetSchema(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read source schema: %v", err)
+	}
+	targetSchema, err := database.GetSchema(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read target schema: %v", err)
+	}
+
+	diffs := database.CompareSchemas(sourceSchema, targetSchema)
+	return diffs, database.PlanMigration(sourceSchema, targetSchema, diffs), nil
+}
+
+func runSchemaDiff(args []string, stdout io.Writer) (bool, error) {
+	fs, pair := newFlagSet("schema-diff")
+	showSQL := fs.Bool("sql", false, "print the ordered migration script instead of the list of differences")
+	fs.Parse(args)
+
+	source, target, err := pair.configs()
+	if err != nil {
+		return false, err
+	}
+	diffs, plan, err := loadSchemas(source, target)
+	if err != nil {
+		return false, err
+	}
+	drift := len(diffs) > 0
+
+	switch {
+	case pair.json() && *showSQL:
+		return drift, writeJSON(stdout, plan)
+	case pair.json():
+		if diffs == nil {
+			diffs = []database.DiffResult{}
+		}
+		return drift, writeJSON(stdout, diffs)
+	case *showSQL:
+		if plan.SQL != "" {
+			fmt.Fprintln(stdout, plan.SQL)
+		}
+		return drift, nil
+	}
+
+	if !drift {
+		fmt.Fprintln(stdout, "No differences found. Schemas are identical.")
+		return false, nil
+	}
+	markers := map[string]string{"added": "+", "removed": "-", "modified": "~"}
+	for _, diff := range diffs {
+		fmt.Fprintf(stdout, "%s %-10s %s: %s\n", markers[diff.Type], diff.ObjectType, diff.TableName, diff.Detail)
+		for _, c := range diff.Conversions {
+			if c.Column == "" {
+				fmt.Fprintf(stdout, "    %s\n", c.Detail)
+				continue
+			}
+			fmt.Fprintf(stdout, "    %s: %s -> %s: %s\n", c.Column, c.SourceType, c.TargetType, c.Detail)
+		}
+	}
+	fmt.Fprintf(stdout, "%d difference(s) found\n", len(diffs))
+	return true, nil
+}
+
+// compareFlags holds the flags tuning data comparisons
+type compareFlags struct {
+	checksum            bool
+	floatEpsilon        float64
+	timestampPrecision  string
+	ignoreTrailingSpace bool
+	ignoreCase          bool
+	upsert              bool
+	mappings            string
+	targets             tableFlag
+	keys                tableFlag
+	filters             tableFlag
+	include             tableFlag
+	exclude             tableFlag
+	rename              tableFlag
+}
+
+// tableFlag collects repeated table=value flags
+type tableFlag map[string]string
+
+func (f tableFlag) String() string {
+	return ""
+}
+
+func (f tableFlag) Set(value string) error {
+	table, v, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(table) == "" {
+		return fmt.Errorf("expected table=value, got %q", value)
+	}
+	f[strings.TrimSpace(table)] = v
+	return nil
+}
+
+func addCompareFlags(fs *flag.FlagSet) *compareFlags {
+	f := &compareFlags{targets: tableFlag{}, keys: tableFlag{}, filters: tableFlag{}, include: tableFlag{}, exclude: tableFlag{}, rename: tableFlag{}}
+	fs.BoolVar(&f.checksum, "checksum", false, "only read blocks of rows whose server-side checksums differ")
+	fs.Float64Var(&f.floatEpsilon, "float-epsilon", 0, "largest difference between floating point values that still match")
+	fs.StringVar(&f.timestampPrecision, "timestamp-precision", "", "match timestamps less than one unit apart: s, ms or us")
+	fs.BoolVar(&f.ignoreTrailingSpace, "ignore-trailing-space", false, "ignore trailing spaces in text values")
+	fs.BoolVar(&f.ignoreCase, "ignore-case", false, "compare text values case-insensitively")
+	fs.StringVar(&f.mappings, "mappings", "", "saved table mapping set to sync; the table flags below override its entries")
+	fs.Var(f.targets, "target-table", "sync a source table with a differently named target table, as table=target (repeatable)")
+	fs.Var(f.keys, "key", "match the rows of a table on columns other than its primary key, as table=col1,col2 (repeatable)")
+	fs.Var(f.filters, "filter", "compare only the rows of a table matching a condition, as table=condition (repeatable)")
+	fs.Var(f.include, "include", "compare only some columns of a table, and its key, as table=col1,col2 (repeatable)")
+	fs.Var(f.exclude, "exclude", "leave columns of a table out, as table=col1,col2 (repeatable)")
+	fs.Var(f.rename, "rename", "map source columns of a table to differently named target columns, as table=src:dst,src2:dst2 (repeatable)")
+	fs.BoolVar(&f.upsert, "upsert", false, "write new and changed rows as upserts, so the sync can be re-run after a failure")
+	return f
+}
+
+// columnMappings combines -include, -exclude and -rename by table
+func (f *compareFlags) columnMappings() map[string]database.ColumnMapping {
+	mappings := make(map[string]database.ColumnMapping)
+	for table, cols := range f.include {
+		m := mappings[table]
+		m.Include = splitList(cols)
+		mappings[table] = m
+	}
+	for table, cols := range f.exclude {
+		m := mappings[table]
+		m.Exclude = splitList(cols)
+		mappings[table] = m
+	}
+	for table, pairs := range f.rename {
+		m := mappings[table]
+		m.Rename = make(map[string]string)
+		for _, pair := range splitList(pairs) {
+			src, dst, _ := strings.Cut(pair, ":")
+			m.Rename[strings.TrimSpace(src)] = strings.TrimSpace(dst)
+		}
+		mappings[table] = m
+	}
+	return mappings
+}
+
+// mappingSet returns the saved mapping set named by -mappings, if any
+func (f *compareFlags) mappingSet() (*database.MappingSet, error) {
+	if f.mappings == "" {
+		return nil, nil
+	}
+	store, err := database.NewMappingStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open saved mapping sets: %v", err)
+	}
+	set, ok := store.Get(f.mappings)
+	if !ok {
+		return nil, fmt.Errorf("no saved mapping set named %q", f.mappings)
+	}
+	return &set, nil
+}
+
+// syncConfig returns the configuration syncing every difference of tables.
+// It starts from the mapping set, if one is named, and applies the table
+// flags on top of it.
+func (f *compareFlags) syncConfig(source, target database.ConnectionConfig, set *database.MappingSet, tables ...string) database.DataSyncConfig {
+	config := f.baseConfig(source, target)
+	if set != nil {
+		config = set.Apply(config)
+	}
+	config.Tables = tables
+	for table, name := range f.targets {
+		config.TargetTables[table] = name
+	}
+	for table, cols := range f.keys {
+		config.Keys[table] = splitList(cols)
+	}
+	for table, filter := range f.filters {
+		config.Filters[table] = filter
+	}
+	for table, mapping := range f.columnMappings() {
+		config.Columns[table] = mapping
+	}
+	return config
+}
+
+func (f *compareFlags) baseConfig(source, target database.ConnectionConfig) database.DataSyncConfig {
+	return database.DataSyncConfig{
+		SourceConfig: source,
+		TargetConfig: target,
+		TargetTables: make(map[string]string),
+		Filters:      make(map[string]string),
+		Columns:      make(map[string]database.ColumnMapping),
+		Keys:         make(map[string][]string),
+		SyncInsert:   true,
+		SyncUpdate:   true,
+		SyncDelete:   true,
+		Upsert:       f.upsert,
+		Options: database.DataCompareOptions{
+			Checksum:            f.checksum,
+			FloatEpsilon:        f.floatEpsilon,
+			TimestampPrecision:  f.timestampPrecision,
+			IgnoreTrailingSpace: f.ignoreTrailingSpace,
+			IgnoreCase:          f.ignoreCase,
+		},
+	}
+}
+
+// tableDataDiff is the data-diff result for one table
+type tableDataDiff struct {
+	Table  string                    `json:"table"`
+	Target string                    `json:"target,omitempty"`
+	Insert int                       `json:"insert"`
+	Update int                       `json:"update"`
+	Delete int                       `json:"delete"`
+	Diffs  []database.DataDiffResult `json:"diffs"`
+}
+
+// compareData compares the given tables, or every table present on both sides
+func compareData(source, target database.ConnectionConfig, tables []string, compare *compareFlags) ([]tableDataDiff, error) {
+	set, err := compare.mappingSet()
+	if err != nil {
+		return nil, err
+	}
+	tables, err = syncTables(source, target, tables, set, compare.targets)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []tableDataDiff{}
+	for _, table := range tables {
+		config := compare.syncConfig(source, target, set, table)
+		diffs, err := database.CompareDataSync(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %v", table, err)
+		}
+		result := tableDataDiff{Table: table, Target: config.TargetTables[table], Diffs: diffs}
+		if result.Diffs == nil {
+			result.Diffs = []database.DataDiffResult{}
+		}
+		for _, diff := range diffs {
+			switch diff.Type {
+			case "insert":
+				result.Insert++
+			case "update":
+				result.Update++
+			case "delete":
+				result.Delete++
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// syncTables returns the given tables, else the tables of the mapping set,
+// else every table present on both sides under its target name
+func syncTables(source, target database.ConnectionConfig, tables []string, set *database.MappingSet, targets map[string]string) ([]string, error) {
+	if len(tables) > 0 {
+		return tables, nil
+	}
+	if set != nil {
+		for _, t := range set.Tables {
+			tables = append(tables, t.Source)
+		}
+		return tables, nil
+	}
+	sourceTables, err := database.GetTablesForSync(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source tables: %v", err)
+	}
+	targetTables, err := database.GetTablesForSync(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target tables: %v", err)
+	}
+	inTarget := make(map[string]bool)
+	for _, t := range targetTables {
+		inTarget[t.TableName] = true
+	}
+	for _, t := range sourceTables {
+		name := t.TableName
+		if renamed, ok := targets[name]; ok {
+			name = renamed
+		}
+		if inTarget[name] {
+			tables = append(tables, t.TableName)
+		}
+	}
+	return tables, nil
+}
+
+func runDataDiff(args []string, stdout io.Writer) (bool, error) {
+	fs, pair := newFlagSet("data-diff")
+	tables := fs.String("tables", "", "comma-separated tables to compare (default: the -mappings tables, else every table in both databases)")
+	showSQL := fs.Bool("sql", false, "print the statements that would sync the target")
+	compare := addCompareFlags(fs)
+	fs.Parse(args)
+
+	source, target, err := pair.configs()
+	if err != nil {
+		return false, err
+	}
+	results, err := compareData(source, target, splitList(*tables), compare)
+	if err != nil {
+		return false, err
+	}
+
+	drift := false
+	for _, result := range results {
+		if len(result.Diffs) > 0 {
+			drift = true
+		}
+	}
+
+	switch {
+	case pair.json():
+		return drift, writeJSON(stdout, results)
+	case *showSQL:
+		for _, result := range results {
+			for _, diff := range result.Diffs {
+				fmt.Fprintln(stdout, diff.SQL)
+			}
+		}
+		return drift, nil
+	}
+
+	for _, result := range results {
+		table := result.Table
+		if result.Target != "" {
+			table += " -> " + result.Target
+		}
+		fmt.Fprintf(stdout, "%s: %d to insert, %d to update, %d to delete\n",
+			table, result.Insert, result.Update, result.Delete)
+	}
+	if !drift {
+		fmt.Fprintln(stdout, "No differences found. Data is identical.")
+	}
+	return drift, nil
+}
+
+// applyResult reports what apply ran, or would run with -dry-run
+type applyResult struct {
+	SchemaChanges int    `json:"schemaChanges"`
+	SchemaSQL     string `json:"schemaSql,omitempty"`
+	DataChanges   int    `json:"dataChanges"`
+	DataSQL       string `json:"dataSql,omitempty"`
+	// Rows written per type and table, when data was applied
+	DataSync *database.DataSyncResult `json:"dataSync,omitempty"`
+	// Changes that have no SQL and must be migrated by hand
+	Manual  []string `json:"manual"`
+	Applied bool     `json:"applied"`
+}
+
+func runApply(args []string, stdout io.Writer) (bool, error) {
+	fs, pair := newFlagSet("apply")
+	schema := fs.Bool("schema", true, "apply the schema migration")
+	data := fs.Bool("data", false, "sync table data after the schema")
+	tables := fs.String("tables", "", "comma-separated tables to sync with -data (default: the -mappings tables, else every table in both databases)")
+	compare := addCompareFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of executing it")
+	transaction := fs.Bool("transaction", true, "run the schema script in a transaction that is rolled back on failure; row changes always are")
+	batchSize := fs.Int("batch-size", 0, "rows per multi-row INSERT when syncing data, 1 to insert rows one by one (default 500)")
+	bulk := fs.Bool("bulk", false, "load inserted rows with COPY, bulk copy or LOAD DATA LOCAL INFILE")
+	fs.Parse(args)
+
+	source, target, err := pair.configs()
+	if err != nil {
+		return false, err
+	}
+
+	result := applyResult{Manual: []string{}, Applied: !*dryRun}
+	if *schema {
+		_, plan, err := loadSchemas(source, target)
+		if err != nil {
+			return false, err
+		}
+		for _, step := range plan.Steps {
+			if step.SQL == "" {
+				result.Manual = append(result.Manual, fmt.Sprintf("%s: %s", step.TableName, step.Detail))
+			} else {
+				result.SchemaChanges++
+			}
+		}
+		result.SchemaSQL = plan.SQL
+		if !*dryRun && plan.SQL != "" {
+			if err := execute(target, plan.SQL, *transaction); err != nil {
+				return false, fmt.Errorf("failed to apply schema changes: %v", err)
+			}
+		}
+	}
+
+	if *data {
+		set, err := compare.mappingSet()
+		if err != nil {
+			return false, err
+		}
+		names, err := syncTables(source, target, splitList(*tables), set, compare.targets)
+		if err != nil {
+			return false, err
+		}
+		config := compare.syncConfig(source, target, set, names...)
+		config.Apply = database.DataApplyOptions{BatchSize: *batchSize, BulkLoad: *bulk}
+		switch {
+		case len(names) == 0:
+			// No table is on both sides
+		case *dryRun:
+			diffs, err := database.PlanDataSync(config)
+			if err != nil {
+				return false, err
+			}
+			stmts := make([]string, len(diffs))
+			for i, diff := range diffs {
+				stmts[i] = diff.SQL
+			}
+			result.DataChanges = len(stmts)
+			result.DataSQL = strings.Join(stmts, "\n")
+		default:
+			res, err := database.ApplyDataSync(config)
+			if err != nil {
+				return false, fmt.Errorf("failed to sync data: %v", err)
+			}
+			if f := res.Failed; f != nil {
+				return false, fmt.Errorf("failed to sync data: %s of %s %v failed: %s", f.Type, f.TableName, f.PrimaryKey, f.Error)
+			}
+			result.DataChanges = res.Inserted + res.Updated + res.Deleted
+			result.DataSync = res
+		}
+	}
+
+	// Changes left for a manual migration mean the target still differs
+	drift := len(result.Manual) > 0
+	if pair.json() {
+		return drift, writeJSON(stdout, result)
+	}
+
+	if *dryRun {
+		for _, script := range []string{result.SchemaSQL, result.DataSQL} {
+			if script != "" {
+				fmt.Fprintln(stdout, script)
+			}
+		}
+	} else {
+		fmt.Fprintf(stdout, "Applied %d schema change(s) and %d row change(s)\n", result.SchemaChanges, result.DataChanges)
+	}
+	for _, manual := range result.Manual {
+		fmt.Fprintf(stdout, "Migrate manually: %s\n", manual)
+	}
+	return drift, nil
+}
+
+// execute runs a script on the target, reporting a failed statement as an error
+func execute(target database.ConnectionConfig, script string, transaction bool) error {
+	if !transaction {
+		return database.ExecuteSQL(target, script)
+	}
+	result, err := database.ExecuteSQLTransaction(target, script)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
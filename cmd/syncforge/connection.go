@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"syncforge/database"
+)
+
+// passphraseEnv names the variable holding the master passphrase of
+// encrypted saved connections
+const passphraseEnv = "SYNCFORGE_PASSPHRASE"
+
+// connectionFlags holds the flags describing one side of a comparison
+type connectionFlags struct {
+	side     string
+	name     string
+	dbType   string
+	host     string
+	port     int
+	user     string
+	password string
+	database string
+	file     string
+	schemas  string
+	tls      database.TLSConfig
+	ssh      string
+	sshKey   string
+	sshHosts string
+}
+
+// addConnectionFlags registers -<side> and the -<side>-* flags
+func addConnectionFlags(fs *flag.FlagSet, side string) *connectionFlags {
+	c := &connectionFlags{side: side}
+	fs.StringVar(&c.name, side, "", "saved connection to use as the "+side)
+	fs.StringVar(&c.dbType, side+"-type", "", "database type: mysql, postgresql, sqlite or sqlserver")
+	fs.StringVar(&c.host, side+"-host", "", "database host")
+	fs.IntVar(&c.port, side+"-port", 0, "database port (default depends on the type)")
+	fs.StringVar(&c.user, side+"-user", "", "database user")
+	fs.StringVar(&c.password, side+"-password", "", "database password, or set "+c.passwordEnv())
+	fs.StringVar(&c.database, side+"-database", "", "database name")
+	fs.StringVar(&c.file, side+"-file", "", "SQLite database file")
+	fs.StringVar(&c.schemas, side+"-schemas", "", "comma-separated PostgreSQL/SQL Server schemas")
+	fs.StringVar(&c.tls.Mode, side+"-tls", "", "TLS mode: disable, prefer, require, verify-ca or verify-full")
+	fs.StringVar(&c.tls.CACert, side+"-tls-ca", "", "CA certificate (PEM) to verify the server with")
+	fs.StringVar(&c.tls.ClientCert, side+"-tls-cert", "", "TLS client certificate (PEM)")
+	fs.StringVar(&c.tls.ClientKey, side+"-tls-key", "", "TLS client key (PEM)")
+	fs.StringVar(&c.tls.ServerName, side+"-tls-server-name", "", "name expected in the server certificate")
+	fs.StringVar(&c.ssh, side+"-ssh", "", "connect through an SSH tunnel to user@host[:port]; password from "+c.sshPasswordEnv())
+	fs.StringVar(&c.sshKey, side+"-ssh-key", "", "SSH private key file")
+	fs.StringVar(&c.sshHosts, side+"-ssh-known-hosts", "", "known_hosts file to check the SSH host key against (default ~/.ssh/known_hosts)")
+	return c
+}
+
+func (c *connectionFlags) passwordEnv() string {
+	return "SYNCFORGE_" + strings.ToUpper(c.side) + "_PASSWORD"
+}
+
+func (c *connectionFlags) sshPasswordEnv() string {
+	return "SYNCFORGE_" + strings.ToUpper(c.side) + "_SSH_PASSWORD"
+}
+
+// config starts from the saved connection, if one is named, and applies the
+// flags that were given on top of it
+func (c *connectionFlags) config() (database.ConnectionConfig, error) {
+	var config database.ConnectionConfig
+	if c.name != "" {
+		store, err := database.NewConnectionStore()
+		if err != nil {
+			return config, fmt.Errorf("failed to open saved connections: %v", err)
+		}
+		if store.State().Locked {
+			passphrase, ok := os.LookupEnv(passphraseEnv)
+			if !ok {
+				return config, fmt.Errorf("saved connections are encrypted: set %s to the master passphrase", passphraseEnv)
+			}
+			if err := store.Unlock(passphrase); err != nil {
+				return config, fmt.Errorf("failed to unlock saved connections: %v", err)
+			}
+		}
+		saved, ok := store.Get(c.name)
+		if !ok {
+			return config, fmt.Errorf("no saved connection named %q", c.name)
+		}
+		config = saved.Config
+	}
+
+	if c.dbType != "" {
+		config.Type = database.DBType(c.dbType)
+	}
+	if c.host != "" {
+		config.Host = c.host
+	}
+	if c.port != 0 {
+		config.Port = c.port
+	}
+	if c.user != "" {
+		config.User = c.user
+	}
+	if c.password != "" {
+		config.Password = c.password
+	} else if password, ok := os.LookupEnv(c.passwordEnv()); ok {
+		config.Password = password
+	}
+	if c.database != "" {
+		config.Database = c.database
+	}
+	if c.file != "" {
+		config.FilePath = c.file
+	}
+	if c.schemas != "" {
+		config.Schemas = splitList(c.schemas)
+	}
+	if c.tls.Mode != "" {
+		// An explicit mode replaces a saved skip-verify
+		config.TLS.Mode = c.tls.Mode
+		config.TLS.SkipVerify = false
+	}
+	if c.tls.CACert != "" {
+		config.TLS.CACert = c.tls.CACert
+	}
+	if c.tls.ClientCert != "" {
+		config.TLS.ClientCert = c.tls.ClientCert
+	}
+	if c.tls.ClientKey != "" {
+		config.TLS.ClientKey = c.tls.ClientKey
+	}
+	if c.tls.ServerName != "" {
+		config.TLS.ServerName = c.tls.ServerName
+	}
+
+	if c.ssh != "" {
+		if err := parseSSHTarget(c.ssh, &config.SSH); err != nil {
+			return config, fmt.Errorf("-%s-ssh: %v", c.side, err)
+		}
+	}
+	if c.sshKey != "" {
+		config.SSH.PrivateKey = c.sshKey
+	}
+	if c.sshHosts != "" {
+		config.SSH.KnownHosts = c.sshHosts
+	}
+	if password, ok := os.LookupEnv(c.sshPasswordEnv()); ok {
+		config.SSH.Password = password
+	}
+
+	if c.name == "" && config.Type == "" && config.Host == "" && config.FilePath == "" {
+		return config, fmt.Errorf("no %s connection given: use -%s or the -%s-* flags", c.side, c.side, c.side)
+	}
+	if config.Port == 0 {
+		config.Port = defaultPort(config.Type)
+	}
+	return config, nil
+}
+
+func defaultPort(dbType database.DBType) int {
+	switch dbType {
+	case database.PostgreSQL:
+		return 5432
+	case database.SQLServer:
+		return 1433
+	case database.SQLite:
+		return 0
+	default:
+		return 3306
+	}
+}
+
+// parseSSHTarget sets the user, host and port of an SSH tunnel from
+// user@host[:port]
+func parseSSHTarget(target string, config *database.SSHConfig) error {
+	user, hostPort, ok := strings.Cut(target, "@")
+	if !ok || user == "" {
+		return fmt.Errorf("expected user@host[:port], got %q", target)
+	}
+	host, port := hostPort, 0
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", p)
+		}
+		host, port = h, n
+	}
+	if host == "" {
+		return fmt.Errorf("expected user@host[:port], got %q", target)
+	}
+	config.User, config.Host, config.Port = user, host, port
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
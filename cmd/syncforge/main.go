@@ -0,0 +1,96 @@
+// Command syncforge runs schema and data comparisons without the GUI, for
+// scripts and CI pipelines.
+//
+// Usage:
+//
+//	syncforge schema-diff -source prod -target staging
+//	syncforge data-diff -source prod -target staging -tables users,orders
+//	syncforge apply -source prod -target staging -data
+//
+// Connections are looked up by name among the connections saved in the GUI,
+// and can be given or overridden with -source-* and -target-* flags.
+// schema-diff and data-diff exit with status 1 when differences are found,
+// so they can gate a deployment; errors exit with status 2.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK    = 0
+	exitDrift = 1
+	exitError = 2
+)
+
+// command runs a subcommand and reports whether the databases differ
+type command func(args []string, stdout io.Writer) (bool, error)
+
+var commands = map[string]command{
+	"schema-diff": runSchemaDiff,
+	"data-diff":   runDataDiff,
+	"apply":       runApply,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitError
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "syncforge: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitError
+	}
+
+	drift, err := cmd(args[1:], stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "syncforge: %v\n", err)
+		return exitError
+	}
+	if drift {
+		return exitDrift
+	}
+	return exitOK
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: syncforge <command> [flags]
+
+Commands:
+  schema-diff   compare the schemas of two databases
+  data-diff     compare the rows of tables in two databases
+  apply         bring the target in line with the source
+
+Connection flags, for both -source and -target:
+  -source NAME               saved connection to use; set SYNCFORGE_PASSPHRASE
+                             if saved connections are encrypted
+  -source-type TYPE          mysql, postgresql, sqlite or sqlserver
+  -source-host, -source-port, -source-user, -source-database
+  -source-password           or set SYNCFORGE_SOURCE_PASSWORD
+  -source-file PATH          SQLite database file
+  -source-schemas LIST       comma-separated PostgreSQL/SQL Server schemas
+
+Passwords and SSH passphrases, given or saved, may be a reference read when
+connecting: ${env:NAME} for an environment variable or ${file:PATH} for the
+contents of a file. Other values starting with ${, env: or file: are
+rejected.
+
+Run "syncforge <command> -h" for the flags of a command.
+schema-diff and data-diff exit with status 1 when differences are found.
+`)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"syncforge/database"
+)
+
+// sqliteFile creates a SQLite database in a temporary file, runs stmts on it
+// and returns its path
+func sqliteFile(t *testing.T, name string, stmts ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	db, err := database.Connect(database.ConnectionConfig{Type: database.SQLite, FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return path
+}
+
+// runCommand runs the command line against two SQLite files
+func runCommand(t *testing.T, source, target string, args ...string) (int, string, string) {
+	t.Helper()
+	args = append(args, "-source-type", "sqlite", "-source-file", source, "-target-type", "sqlite", "-target-file", target)
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+const createUsers = "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"
+
+func TestRunNoDrift(t *testing.T) {
+	source := sqliteFile(t, "source.db", createUsers, "INSERT INTO users VALUES (1, 'ann')")
+	target := sqliteFile(t, "target.db", createUsers, "INSERT INTO users VALUES (1, 'ann')")
+
+	for _, command := range []string{"schema-diff", "data-diff"} {
+		code, stdout, stderr := runCommand(t, source, target, command)
+		if code != exitOK {
+			t.Errorf("%s exited with %d, want %d: %s", command, code, exitOK, stderr)
+		}
+		if !strings.Contains(stdout, "No differences found") {
+			t.Errorf("%s printed %q", command, stdout)
+		}
+	}
+}
+
+func TestRunDrift(t *testing.T) {
+	source := sqliteFile(t, "source.db",
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT)",
+		"INSERT INTO users VALUES (1, 'ann', NULL), (2, 'bob', NULL)")
+	target := sqliteFile(t, "target.db", createUsers, "INSERT INTO users VALUES (1, 'ann')")
+
+	code, stdout, stderr := runCommand(t, source, target, "schema-diff", "-format", "json")
+	if code != exitDrift {
+		t.Fatalf("schema-diff exited with %d, want %d: %s", code, exitDrift, stderr)
+	}
+	var diffs []database.DiffResult
+	if err := json.Unmarshal([]byte(stdout), &diffs); err != nil {
+		t.Fatalf("schema-diff printed invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(diffs) != 1 || diffs[0].ObjectType != "column" || diffs[0].Action != "create" {
+		t.Errorf("schema diffs = %+v, want the email column added", diffs)
+	}
+
+	code, stdout, stderr = runCommand(t, source, target, "data-diff", "-format", "json", "-tables", "users", "-include", "users=name")
+	if code != exitDrift {
+		t.Fatalf("data-diff exited with %d, want %d: %s", code, exitDrift, stderr)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("data-diff printed invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(results) != 1 {
+		t.Fatalf("data-diff reported %d tables, want 1", len(results))
+	}
+	for _, field := range []string{"table", "insert", "update", "delete", "diffs"} {
+		if _, ok := results[0][field]; !ok {
+			t.Errorf("data-diff result has no %q: %v", field, results[0])
+		}
+	}
+	if results[0]["table"] != "users" || results[0]["insert"] != 1.0 || len(results[0]["diffs"].([]interface{})) != 1 {
+		t.Errorf("data-diff result = %v, want one insert into users", results[0])
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	source := sqliteFile(t, "source.db", createUsers)
+	target := sqliteFile(t, "target.db", createUsers)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"frobnicate"}, &stdout, &stderr); code != exitError {
+		t.Errorf("unknown command exited with %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "frobnicate"`) {
+		t.Errorf("unknown command printed %q", stderr.String())
+	}
+	if code := run(nil, &stdout, &stderr); code != exitError {
+		t.Errorf("no command exited with %d, want %d", code, exitError)
+	}
+
+	code, _, errOut := runCommand(t, source, target, "schema-diff", "-format", "yaml")
+	if code != exitError {
+		t.Errorf("bad -format exited with %d, want %d", code, exitError)
+	}
+	if !strings.Contains(errOut, `unknown format "yaml"`) {
+		t.Errorf("bad -format printed %q", errOut)
+	}
+}
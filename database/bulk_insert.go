@@ -0,0 +1,245 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// defaultInsertBatchSize is the number of rows per multi-row INSERT
+const defaultInsertBatchSize = 500
+
+// DataApplyOptions tunes how ExecuteDataDiffs writes inserted rows
+type DataApplyOptions struct {
+	// Rows per multi-row INSERT, 0 for the default and 1 to insert rows one
+	// by one. Consecutive inserts into the same table are grouped.
+	BatchSize int `json:"batchSize"`
+	// BulkLoad sends inserts through the engine's bulk path instead: COPY on
+	// PostgreSQL, bulk copy on SQL Server and LOAD DATA LOCAL INFILE on MySQL,
+	// which needs local_infile enabled on the server. LOAD DATA skips rows
+	// that collide with existing keys, so a load that inserts fewer rows
+	// than it was given fails. SQLite uses batches.
+	BulkLoad bool `json:"bulkLoad"`
+}
+
+// insertRun returns how many diffs from the start are inserts into the same
+// table with the same columns, up to limit
+func insertRun(diffs []DataDiffResult, limit int) int {
+	first := diffs[0]
+	if first.Type != "insert" || first.Statement == "" || len(first.Columns) == 0 {
+		return 0
+	}
+	n := 1
+	for n < len(diffs) && n < limit {
+		d := diffs[n]
+		if d.Type != "insert" || d.targetTable() != first.targetTable() || !stringSlicesEqual(d.Columns, first.Columns) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// insertBatchLimit returns the most rows one multi-row INSERT may hold
+// without exceeding the engine's bind parameter limit
+func insertBatchLimit(dbType DBType, batchSize, columns int) int {
+	if batchSize <= 0 {
+		batchSize = defaultInsertBatchSize
+	}
+	maxParams, maxRows := 65535, batchSize
+	switch dbType {
+	case SQLServer:
+		// 2100 parameters per request, 1000 rows per VALUES list
+		maxParams = 2099
+		if maxRows > 1000 {
+			maxRows = 1000
+		}
+	case SQLite:
+		maxParams = 32766
+	}
+	if rows := maxParams / columns; rows < maxRows {
+		maxRows = rows
+	}
+	if maxRows < 1 {
+		maxRows = 1
+	}
+	return maxRows
+}
+
+// decodeArgs returns the driver values of a diff's arguments
+func decodeArgs(diff DataDiffResult) ([]interface{}, error) {
+	args := make([]interface{}, len(diff.Args))
+	for i, arg := range diff.Args {
+		value, err := arg.value()
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		args[i] = value
+	}
+	return args, nil
+}
+
+// execInsertBatch inserts the rows of a run of inserts with one statement
+// and returns how many it inserted
+func execInsertBatch(tx *sql.Tx, dbType DBType, diffs []DataDiffResult) (int64, error) {
+	columns := diffs[0].Columns
+	var query strings.Builder
+	fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ",
+		quoteTableName(dbType, diffs[0].targetTable()), quotedColumnList(dbType, columns))
+
+	var args []interface{}
+	for i, diff := range diffs {
+		values, err := decodeArgs(diff)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j, value := range values {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, value)
+			query.WriteString(placeholder(dbType, len(args)))
+		}
+		query.WriteString(")")
+	}
+
+	return rowsAffected(tx.Exec(query.String(), args...))
+}
+
+// rowsAffected returns the rows a statement changed
+func rowsAffected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// execBulkInsert loads the rows of a run of inserts through the engine's
+// bulk path. Values are converted to the target column types first, since
+// bulk protocols do not convert them the way statements do. It returns
+// how many rows were loaded.
+func execBulkInsert(tx *sql.Tx, dbType DBType, diffs []DataDiffResult, kinds map[string]valueKind) (int64, error) {
+	columns := diffs[0].Columns
+	rows := make([][]interface{}, len(diffs))
+	for i, diff := range diffs {
+		values, err := decodeArgs(diff)
+		if err != nil {
+			return 0, err
+		}
+		for j, col := range columns {
+			values[j] = coerceValue(values[j], kinds[col])
+		}
+		rows[i] = values
+	}
+
+	schema, name := splitTableKey(dbType, diffs[0].targetTable())
+	switch dbType {
+	case PostgreSQL:
+		return copyRows(tx, pq.CopyInSchema(schemaOrDefault(dbType, schema), name, columns...), rows)
+	case SQLServer:
+		table := qualifiedName(dbType, schema, name)
+		return copyRows(tx, mssql.CopyIn(table, mssql.BulkOptions{CheckConstraints: true, FireTriggers: true, KeepNulls: true}, columns...), rows)
+	case MySQL, "":
+		if err := loadDataInfile(tx, diffs[0].targetTable(), columns, rows); err != nil {
+			return 0, err
+		}
+		return int64(len(rows)), nil
+	default:
+		return 0, fmt.Errorf("bulk load is not supported for %s", dbType)
+	}
+}
+
+// copyRows feeds rows to a COPY-style statement, which lib/pq and
+// go-mssqldb both expose as a prepared statement executed once per row and
+// flushed by a final Exec without arguments, which reports the rows copied
+func copyRows(tx *sql.Tx, copyStatement string, rows [][]interface{}) (int64, error) {
+	stmt, err := tx.Prepare(copyStatement)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return 0, err
+		}
+	}
+	return rowsAffected(stmt.Exec())
+}
+
+var infileReaders int64
+
+// loadDataInfile streams rows to MySQL as tab-separated text through a
+// registered reader, so no temporary file is written
+func loadDataInfile(tx *sql.Tx, tableName string, columns []string, rows [][]interface{}) error {
+	var buf bytes.Buffer
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(infileField(value))
+		}
+		buf.WriteByte('\n')
+	}
+
+	name := fmt.Sprintf("syncforge-%d", atomic.AddInt64(&infileReaders, 1))
+	mysql.RegisterReaderHandler(name, func() io.Reader { return &buf })
+	defer mysql.DeregisterReaderHandler(name)
+
+	result, err := tx.Exec(fmt.Sprintf(
+		"LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4 "+
+			"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s)",
+		name, quoteTableName(MySQL, tableName), quotedColumnList(MySQL, columns)))
+	if err != nil {
+		return err
+	}
+	return checkRowsLoaded(result, len(rows))
+}
+
+// checkRowsLoaded fails a LOAD DATA that inserted fewer rows than it was
+// given, which it does without an error for duplicate keys
+func checkRowsLoaded(result sql.Result, rows int) error {
+	loaded, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if loaded != int64(rows) {
+		return fmt.Errorf("LOAD DATA inserted %d of %d rows; the others collide with existing keys", loaded, rows)
+	}
+	return nil
+}
+
+// infileField renders a value in LOAD DATA's default escaping
+func infileField(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return `\N`
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		// In UTC, as sqlLiteral and the driver write times
+		return v.UTC().Format("2006-01-02 15:04:05.999999")
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`).Replace(s)
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestInfileField(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, `\N`},
+		{true, "1"},
+		{false, "0"},
+		{int64(-42), "-42"},
+		{"a\tb\nc\\d\re\x00", `a\tb\nc\\d\re\0`},
+		{[]byte("x\ty"), `x\ty`},
+		{time.Date(2024, 3, 1, 9, 30, 0, 123456000, tokyo), "2024-03-01 00:30:00.123456"},
+		{time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC), "2024-03-01 00:30:00"},
+	}
+	for _, tt := range tests {
+		if got := infileField(tt.value); got != tt.want {
+			t.Errorf("infileField(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	// Bulk loads and statements must write the same instant
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, tokyo)
+	if got, want := "'"+infileField(at)+"'", sqlLiteral(MySQL, at); got != want {
+		t.Errorf("infileField = %s, sqlLiteral = %s", got, want)
+	}
+}
+
+func TestCheckRowsLoaded(t *testing.T) {
+	if err := checkRowsLoaded(driver.RowsAffected(3), 3); err != nil {
+		t.Errorf("complete load failed: %v", err)
+	}
+	if err := checkRowsLoaded(driver.RowsAffected(2), 3); err == nil {
+		t.Error("load with a skipped row succeeded")
+	}
+}
+
+func TestInsertBatchLimit(t *testing.T) {
+	tests := []struct {
+		dbType    DBType
+		batchSize int
+		columns   int
+		want      int
+	}{
+		{MySQL, 0, 10, defaultInsertBatchSize},
+		{MySQL, 100000, 10, 6553},
+		{SQLServer, 0, 3, 500},
+		{SQLServer, 5000, 1, 1000},
+		{SQLServer, 5000, 10, 209},
+		{SQLite, 5000, 10, 3276},
+		{PostgreSQL, 1, 10, 1},
+		{SQLServer, 0, 5000, 1},
+	}
+	for _, tt := range tests {
+		if got := insertBatchLimit(tt.dbType, tt.batchSize, tt.columns); got != tt.want {
+			t.Errorf("insertBatchLimit(%s, %d, %d) = %d, want %d", tt.dbType, tt.batchSize, tt.columns, got, tt.want)
+		}
+	}
+}
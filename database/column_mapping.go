@@ -0,0 +1,87 @@
+package database
+
+import "fmt"
+
+// ColumnMapping selects and renames the columns of a table for data sync.
+// Columns are named as in the source table.
+type ColumnMapping struct {
+	// Only compare these columns, and the primary key; empty for all
+	Include []string `json:"include,omitempty"`
+	// Leave these columns out of the comparison and the generated SQL, so
+	// inserted rows get the target's defaults for them
+	Exclude []string `json:"exclude,omitempty"`
+	// Target names of source columns that are named differently there
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+// target returns the target name of a source column
+func (m ColumnMapping) target(col string) string {
+	if name, ok := m.Rename[col]; ok {
+		return name
+	}
+	return col
+}
+
+// selectColumns returns the source columns the mapping compares, in table
+// order, after checking that every column it names exists
+func (m ColumnMapping) selectColumns(columns []ColumnInfo, primaryKeys []string) ([]ColumnInfo, error) {
+	exists := make(map[string]bool)
+	for _, col := range columns {
+		exists[col.Name] = true
+	}
+	isPK := make(map[string]bool)
+	for _, pk := range primaryKeys {
+		isPK[pk] = true
+	}
+
+	included := make(map[string]bool)
+	for _, col := range m.Include {
+		if !exists[col] {
+			return nil, fmt.Errorf("source has no column %s", col)
+		}
+		included[col] = true
+	}
+	excluded := make(map[string]bool)
+	for _, col := range m.Exclude {
+		if !exists[col] {
+			return nil, fmt.Errorf("source has no column %s", col)
+		}
+		if isPK[col] {
+			return nil, fmt.Errorf("key column %s cannot be excluded", col)
+		}
+		excluded[col] = true
+	}
+	for col, name := range m.Rename {
+		if !exists[col] {
+			return nil, fmt.Errorf("source has no column %s", col)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no target column given for %s", col)
+		}
+	}
+
+	var selected []ColumnInfo
+	for _, col := range columns {
+		if excluded[col.Name] || (len(included) > 0 && !included[col.Name] && !isPK[col.Name]) {
+			continue
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
+
+// renameKeys returns row with its columns renamed per names, which maps
+// old names to new ones
+func renameKeys(row map[string]interface{}, names map[string]string) map[string]interface{} {
+	if len(names) == 0 {
+		return row
+	}
+	renamed := make(map[string]interface{}, len(row))
+	for col, value := range row {
+		if name, ok := names[col]; ok {
+			col = name
+		}
+		renamed[col] = value
+	}
+	return renamed
+}
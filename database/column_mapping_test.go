@@ -0,0 +1,56 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectColumns(t *testing.T) {
+	columns := []ColumnInfo{{Name: "id"}, {Name: "tenant_id"}, {Name: "total"}, {Name: "note"}}
+	tests := []struct {
+		name    string
+		mapping ColumnMapping
+		want    []string
+		wantErr bool
+	}{
+		{"all", ColumnMapping{}, []string{"id", "tenant_id", "total", "note"}, false},
+		{"include keeps the key and table order", ColumnMapping{Include: []string{"note", "total"}}, []string{"id", "total", "note"}, false},
+		{"exclude", ColumnMapping{Exclude: []string{"note"}}, []string{"id", "tenant_id", "total"}, false},
+		{"rename keeps the source names", ColumnMapping{Rename: map[string]string{"tenant_id": "org_id"}}, []string{"id", "tenant_id", "total", "note"}, false},
+		{"exclude the key", ColumnMapping{Exclude: []string{"id"}}, nil, true},
+		{"include a missing column", ColumnMapping{Include: []string{"missing"}}, nil, true},
+		{"exclude a missing column", ColumnMapping{Exclude: []string{"missing"}}, nil, true},
+		{"rename a missing column", ColumnMapping{Rename: map[string]string{"missing": "x"}}, nil, true},
+		{"rename to nothing", ColumnMapping{Rename: map[string]string{"tenant_id": ""}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := tt.mapping.selectColumns(columns, []string{"id"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, col := range selected {
+				got = append(got, col.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	row := map[string]interface{}{"id": 1, "tenant_id": 2}
+	got := renameKeys(row, map[string]string{"tenant_id": "org_id", "absent": "x"})
+	want := map[string]interface{}{"id": 1, "org_id": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("renameKeys = %v, want %v", got, want)
+	}
+	if _, ok := row["tenant_id"]; !ok {
+		t.Error("renameKeys modified its argument")
+	}
+	if got := renameKeys(row, nil); !reflect.DeepEqual(got, row) {
+		t.Errorf("renameKeys without names = %v, want %v", got, row)
+	}
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedPrefix marks a secret encrypted with the store's key
+const sealedPrefix = "enc:v1:"
+
+// storeCheck is sealed with the key so a wrong passphrase is detected on
+// unlock rather than when a secret fails to open
+const storeCheck = "syncforge"
+
+// StoreEncryption holds what is needed to derive the key of an encrypted
+// connection file from its passphrase; never the key itself
+type StoreEncryption struct {
+	KDF   string `json:"kdf"`
+	Salt  string `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Check string `json:"check"`
+}
+
+// secretFields returns the secrets of a connection, which are encrypted
+// when the store has a passphrase. New secret settings belong here.
+func secretFields(config *ConnectionConfig) []*string {
+	return []*string{
+		&config.Password,
+		&config.SSH.Password,
+		&config.SSH.Passphrase,
+	}
+}
+
+// newStoreEncryption sets up encryption with passphrase and a new salt,
+// returning the key it derives
+func newStoreEncryption(passphrase string) (*StoreEncryption, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	enc := &StoreEncryption{
+		KDF:  "scrypt",
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		N:    1 << 15,
+		R:    8,
+		P:    1,
+	}
+	key, err := enc.deriveKey(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enc.Check, err = sealSecret(key, storeCheck); err != nil {
+		return nil, nil, err
+	}
+	return enc, key, nil
+}
+
+// deriveKey returns the AES-256 key for passphrase
+func (e *StoreEncryption) deriveKey(passphrase string) ([]byte, error) {
+	if e.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation: %s", e.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	return scrypt.Key([]byte(passphrase), salt, e.N, e.R, e.P, 32)
+}
+
+// unlock derives the key for passphrase and checks it is the right one
+func (e *StoreEncryption) unlock(passphrase string) ([]byte, error) {
+	key, err := e.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := openSecret(key, e.Check); err != nil || check != storeCheck {
+		return nil, fmt.Errorf("wrong passphrase")
+	}
+	return key, nil
+}
+
+// sealSecret encrypts a secret with AES-GCM under a random nonce
+func sealSecret(key []byte, secret string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a sealed secret. A value that is not sealed is
+// returned as is.
+func openSecret(key []byte, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %v", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %v", err)
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isSealed reports whether a secret is encrypted
+func isSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
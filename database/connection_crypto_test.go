@@ -0,0 +1,120 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestStore returns an empty store saving to a temporary file
+func newTestStore(t *testing.T) *ConnectionStore {
+	t.Helper()
+	return &ConnectionStore{
+		Connections: []SavedConnection{},
+		filePath:    filepath.Join(t.TempDir(), "connections.json"),
+	}
+}
+
+func TestSealOpenSecret(t *testing.T) {
+	enc, key, err := newStoreEncryption("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := sealSecret(key, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(sealed) || strings.Contains(sealed, "s3cret") {
+		t.Fatalf("sealed value %q", sealed)
+	}
+	if again, _ := sealSecret(key, "s3cret"); again == sealed {
+		t.Errorf("sealing twice gave the same value; nonces are not random")
+	}
+	if plain, err := openSecret(key, sealed); err != nil || plain != "s3cret" {
+		t.Errorf("openSecret = %q, %v", plain, err)
+	}
+	if plain, err := openSecret(key, "not sealed"); err != nil || plain != "not sealed" {
+		t.Errorf("openSecret(plaintext) = %q, %v", plain, err)
+	}
+
+	otherKey, err := enc.deriveKey("wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSecret(otherKey, sealed); err == nil {
+		t.Errorf("opened with the wrong key")
+	}
+	tampered := sealed[:len(sealed)-4] + "AAA="
+	if _, err := openSecret(key, tampered); err == nil {
+		t.Errorf("opened a tampered value")
+	}
+	for _, bad := range []string{sealedPrefix + "!!", sealedPrefix + "AAAA"} {
+		if _, err := openSecret(key, bad); err == nil {
+			t.Errorf("openSecret(%q) succeeded", bad)
+		}
+	}
+
+	if _, err := enc.unlock("wrong"); err == nil {
+		t.Errorf("unlocked with the wrong passphrase")
+	}
+	if unlocked, err := enc.unlock("correct horse"); err != nil || string(unlocked) != string(key) {
+		t.Errorf("unlock = %x, %v; want the derived key", unlocked, err)
+	}
+}
+
+func TestStorePassphrase(t *testing.T) {
+	store := newTestStore(t)
+	conn := SavedConnection{Name: "prod", Config: ConnectionConfig{Type: PostgreSQL, Host: "db", User: "app", Password: "pg-pass"}}
+	conn.Config.SSH.Password = "ssh-pass"
+	if err := store.Save(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetPassphrase("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(store.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "pg-pass") || strings.Contains(string(data), "ssh-pass") {
+		t.Fatalf("secrets written in plaintext:\n%s", data)
+	}
+
+	// A fresh store reads the file locked
+	reopened := &ConnectionStore{filePath: store.filePath}
+	if err := reopened.load(); err != nil {
+		t.Fatal(err)
+	}
+	if state := reopened.State(); !state.Encrypted || !state.Locked {
+		t.Errorf("state = %+v, want encrypted and locked", state)
+	}
+	if got, _ := reopened.Get("prod"); got.Config.Password != "" || got.Config.Host != "db" {
+		t.Errorf("locked store revealed %+v", got.Config)
+	}
+	if err := reopened.Save(conn); err == nil {
+		t.Errorf("saved into a locked store")
+	}
+	if err := reopened.Unlock("wrong"); err == nil {
+		t.Errorf("unlocked with the wrong passphrase")
+	}
+	if err := reopened.Unlock("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.Get("prod"); got.Config.Password != "pg-pass" || got.Config.SSH.Password != "ssh-pass" {
+		t.Errorf("unlocked store revealed %q and %q", got.Config.Password, got.Config.SSH.Password)
+	}
+
+	// Removing the passphrase writes plaintext again
+	if err := reopened.SetPassphrase(""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(store.filePath); !strings.Contains(string(data), "pg-pass") {
+		t.Errorf("secrets still sealed after removing the passphrase:\n%s", data)
+	}
+	if state := reopened.State(); state.Encrypted || state.Locked {
+		t.Errorf("state = %+v, want plaintext", state)
+	}
+}
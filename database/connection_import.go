@@ -0,0 +1,271 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultPorts fills in the port of imported connections that leave it out
+var defaultPorts = map[DBType]int{
+	MySQL:      3306,
+	PostgreSQL: 5432,
+	SQLServer:  1433,
+}
+
+// dbeaverDataSources is the part of DBeaver's data-sources.json that is
+// imported
+type dbeaverDataSources struct {
+	Connections map[string]struct {
+		Provider      string `json:"provider"`
+		Driver        string `json:"driver"`
+		Name          string `json:"name"`
+		Configuration struct {
+			Host     string          `json:"host"`
+			Port     json.RawMessage `json:"port"`
+			Database string          `json:"database"`
+			URL      string          `json:"url"`
+			User     string          `json:"user"`
+			Password string          `json:"password"`
+			Handlers map[string]struct {
+				Type       string                     `json:"type"`
+				Enabled    bool                       `json:"enabled"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"handlers"`
+		} `json:"configuration"`
+	} `json:"connections"`
+}
+
+// readDBeaverConnections reads a DBeaver data-sources.json. DBeaver keeps
+// credentials in a separate encrypted file, so only those still written
+// inline by older versions come along.
+func readDBeaverConnections(data []byte) ([]SavedConnection, []string, error) {
+	var sources dbeaverDataSources
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, nil, fmt.Errorf("failed to read DBeaver connections: %v", err)
+	}
+
+	var conns []SavedConnection
+	var warnings []string
+	withoutPassword := false
+	for id, source := range sources.Connections {
+		name := source.Name
+		if name == "" {
+			name = id
+		}
+		cfg := source.Configuration
+
+		var config ConnectionConfig
+		switch {
+		case source.Provider == "mysql":
+			config.Type = MySQL
+		case source.Provider == "postgresql":
+			config.Type = PostgreSQL
+		case source.Provider == "sqlserver" || source.Provider == "mssql":
+			config.Type = SQLServer
+		case source.Provider == "sqlite" || strings.Contains(source.Driver, "sqlite"):
+			config.Type = SQLite
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s skipped: unsupported DBeaver driver %s", name, source.Driver))
+			continue
+		}
+
+		if config.Type == SQLite {
+			config.FilePath = cfg.Database
+			if config.FilePath == "" {
+				config.FilePath = strings.TrimPrefix(cfg.URL, "jdbc:sqlite:")
+			}
+		} else {
+			config.Host = cfg.Host
+			config.Port = looseInt(cfg.Port)
+			config.User = cfg.User
+			config.Password = cfg.Password
+			config.Database = cfg.Database
+			if config.Port == 0 {
+				config.Port = defaultPorts[config.Type]
+			}
+			withoutPassword = withoutPassword || config.Password == ""
+		}
+
+		for handlerID, handler := range cfg.Handlers {
+			if !handler.Enabled {
+				continue
+			}
+			switch {
+			case handlerID == "ssh_tunnel":
+				props := handler.Properties
+				config.SSH = SSHConfig{
+					Host:       looseString(props["host"]),
+					Port:       looseInt(props["port"]),
+					User:       looseString(props["user"]),
+					PrivateKey: looseString(props["keyPath"]),
+				}
+			case strings.Contains(handlerID, "ssl"):
+				warnings = append(warnings, fmt.Sprintf("%s: TLS settings were not imported", name))
+			}
+		}
+		conns = append(conns, SavedConnection{Name: name, Config: config})
+	}
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Name < conns[j].Name })
+	sort.Strings(warnings)
+	if withoutPassword {
+		warnings = append(warnings, "DBeaver keeps passwords apart from data-sources.json; enter them before connecting")
+	}
+	return conns, warnings, nil
+}
+
+// looseInt reads a JSON number that may be written as a string
+func looseInt(raw json.RawMessage) int {
+	n, _ := strconv.Atoi(looseString(raw))
+	return n
+}
+
+// looseString reads a JSON string, number or boolean as text
+func looseString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// navicatConnections is the layout of a Navicat .ncx export
+type navicatConnections struct {
+	Version     string `xml:"Ver,attr"`
+	Connections []struct {
+		Name             string `xml:"ConnectionName,attr"`
+		Type             string `xml:"ConnType,attr"`
+		Host             string `xml:"Host,attr"`
+		Port             string `xml:"Port,attr"`
+		Database         string `xml:"Database,attr"`
+		DatabaseFileName string `xml:"DatabaseFileName,attr"`
+		UserName         string `xml:"UserName,attr"`
+		Password         string `xml:"Password,attr"`
+		SSH              string `xml:"SSH,attr"`
+		SSHHost          string `xml:"SSH_Host,attr"`
+		SSHPort          string `xml:"SSH_Port,attr"`
+		SSHUserName      string `xml:"SSH_UserName,attr"`
+		SSHPassword      string `xml:"SSH_Password,attr"`
+		SSHPrivateKey    string `xml:"SSH_PrivateKey,attr"`
+		SSHPassphrase    string `xml:"SSH_Passphrase,attr"`
+		SSL              string `xml:"SSL,attr"`
+		SSLCACert        string `xml:"SSL_CACert,attr"`
+		SSLClientCert    string `xml:"SSL_ClientCert,attr"`
+		SSLClientKey     string `xml:"SSL_ClientKey,attr"`
+		SSLPGSSLMode     string `xml:"SSL_PGSSLMode,attr"`
+	} `xml:"Connection"`
+}
+
+// readNavicatConnections reads a Navicat .ncx export. Passwords are
+// decrypted when they use the scheme of Navicat 12 and later.
+func readNavicatConnections(data []byte) ([]SavedConnection, []string, error) {
+	var export navicatConnections
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, nil, fmt.Errorf("failed to read Navicat connections: %v", err)
+	}
+
+	var conns []SavedConnection
+	var warnings []string
+	for _, nc := range export.Connections {
+		var config ConnectionConfig
+		switch strings.ToUpper(nc.Type) {
+		case "MYSQL", "MARIADB":
+			config.Type = MySQL
+		case "POSTGRESQL":
+			config.Type = PostgreSQL
+		case "SQLSERVER", "MSSQL":
+			config.Type = SQLServer
+		case "SQLITE":
+			config.Type = SQLite
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s skipped: unsupported Navicat connection type %s", nc.Name, nc.Type))
+			continue
+		}
+
+		password := func(field, value string) string {
+			plain, err := navicatPassword(value)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %s could not be decrypted and was not imported", nc.Name, field))
+			}
+			return plain
+		}
+
+		if config.Type == SQLite {
+			config.FilePath = nc.DatabaseFileName
+		} else {
+			config.Host = nc.Host
+			config.Port, _ = strconv.Atoi(nc.Port)
+			if config.Port == 0 {
+				config.Port = defaultPorts[config.Type]
+			}
+			config.User = nc.UserName
+			config.Password = password("password", nc.Password)
+			config.Database = nc.Database
+		}
+
+		if strings.EqualFold(nc.SSH, "true") {
+			config.SSH = SSHConfig{
+				Host:       nc.SSHHost,
+				User:       nc.SSHUserName,
+				Password:   password("SSH password", nc.SSHPassword),
+				PrivateKey: nc.SSHPrivateKey,
+				Passphrase: password("SSH passphrase", nc.SSHPassphrase),
+			}
+			config.SSH.Port, _ = strconv.Atoi(nc.SSHPort)
+		}
+
+		if strings.EqualFold(nc.SSL, "true") {
+			config.TLS = TLSConfig{
+				Mode:       TLSRequire,
+				CACert:     nc.SSLCACert,
+				ClientCert: nc.SSLClientCert,
+				ClientKey:  nc.SSLClientKey,
+			}
+			if config.Type == PostgreSQL {
+				switch mode := strings.ReplaceAll(strings.ToLower(nc.SSLPGSSLMode), "_", "-"); mode {
+				case TLSDisable, TLSPrefer, TLSVerifyCA, TLSVerifyFull:
+					config.TLS.Mode = mode
+				case "allow":
+					config.TLS.Mode = TLSPrefer
+				}
+			}
+		}
+		conns = append(conns, SavedConnection{Name: nc.Name, Config: config})
+	}
+	return conns, warnings, nil
+}
+
+// navicatPassword decrypts a password of a Navicat 12+ export: hex of
+// AES-128-CBC under the fixed key and IV every Navicat installation uses
+func navicatPassword(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("unrecognized password encoding")
+	}
+	block, err := aes.NewCipher([]byte("libcckeylibcckey"))
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCDecrypter(block, []byte("libcciv libcciv ")).CryptBlocks(data, data)
+
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return "", fmt.Errorf("unrecognized password encoding")
+	}
+	for _, b := range data[len(data)-pad:] {
+		if int(b) != pad {
+			return "", fmt.Errorf("unrecognized password encoding")
+		}
+	}
+	return string(data[:len(data)-pad]), nil
+}
@@ -0,0 +1,289 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// exportFormat identifies a file of exported connections
+const exportFormat = "syncforge-connections"
+
+// How Import treats a connection named like a saved one
+const (
+	ConflictRename    = "rename"
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+)
+
+// connectionExport is the layout of an exported connections file. Its
+// secrets are plaintext, or sealed as in an encrypted store when the
+// export has a passphrase.
+type connectionExport struct {
+	Format      string            `json:"format"`
+	Version     int               `json:"version"`
+	Encryption  *StoreEncryption  `json:"encryption,omitempty"`
+	Connections []SavedConnection `json:"connections"`
+}
+
+// ExportOptions selects the connections to export and how their secrets
+// are written
+type ExportOptions struct {
+	// Connections to export; empty exports all
+	Names []string `json:"names"`
+	// Leave passwords out; references to env variables and files are kept
+	StripPasswords bool `json:"stripPasswords"`
+	// Encrypt passwords with this passphrase instead of writing them in
+	// plaintext
+	Passphrase string `json:"passphrase"`
+}
+
+// ImportOptions tells Import how to read a file and merge it
+type ImportOptions struct {
+	// Passphrase of an encrypted export
+	Passphrase string `json:"passphrase"`
+	// rename (default), overwrite or skip
+	OnConflict string `json:"onConflict"`
+	// Keep ${env:...} and ${file:...} references in imported secrets.
+	// They are removed by default: a file from elsewhere could otherwise
+	// send a local variable or file to its server as a password.
+	KeepReferences bool `json:"keepReferences"`
+}
+
+// ImportResult reports what an import did with each connection
+type ImportResult struct {
+	Added       []string `json:"added"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+	// Original names of connections added under a new name
+	Renamed  map[string]string `json:"renamed,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+// Export writes the selected connections to a portable file
+func (s *ConnectionStore) Export(options ExportOptions) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.locked() && !options.StripPasswords {
+		return nil, fmt.Errorf("saved connections are locked")
+	}
+
+	selected := s.Connections
+	if len(options.Names) > 0 {
+		selected = nil
+		for _, name := range options.Names {
+			found := false
+			for _, c := range s.Connections {
+				if c.Name == name {
+					selected = append(selected, c)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no saved connection named %q", name)
+			}
+		}
+	}
+
+	export := connectionExport{Format: exportFormat, Version: 1}
+	var key []byte
+	if options.Passphrase != "" && !options.StripPasswords {
+		var err error
+		if export.Encryption, key, err = newStoreEncryption(options.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range selected {
+		conn, err := s.reveal(c)
+		if err != nil {
+			return nil, err
+		}
+		if options.StripPasswords {
+			for _, field := range secretFields(&conn.Config) {
+				if !isReference(*field) {
+					*field = ""
+				}
+			}
+		} else if key != nil {
+			if conn, err = seal(conn, key); err != nil {
+				return nil, err
+			}
+		}
+		export.Connections = append(export.Connections, conn)
+	}
+	if export.Connections == nil {
+		export.Connections = []SavedConnection{}
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// Import adds the connections of a file: a syncforge export or
+// connections.json, a DBeaver data-sources.json or a Navicat .ncx export
+func (s *ConnectionStore) Import(data []byte, options ImportOptions) (*ImportResult, error) {
+	conns, warnings, err := readConnectionFile(data, options.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	onConflict := options.OnConflict
+	switch onConflict {
+	case "":
+		onConflict = ConflictRename
+	case ConflictRename, ConflictOverwrite, ConflictSkip:
+	default:
+		return nil, fmt.Errorf("unsupported conflict resolution: %s", onConflict)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked() {
+		return nil, fmt.Errorf("saved connections are locked")
+	}
+
+	result := &ImportResult{
+		Added:       []string{},
+		Overwritten: []string{},
+		Skipped:     []string{},
+		Warnings:    warnings,
+	}
+	connections := append([]SavedConnection(nil), s.Connections...)
+	for _, conn := range conns {
+		if conn.Name == "" {
+			conn.Name = "Imported connection"
+		}
+		referenced := false
+		for _, field := range secretFields(&conn.Config) {
+			// Redacted secrets of another machine's store mean nothing here
+			if _, ok := savedReference(*field); ok {
+				*field = ""
+			}
+			if isReference(*field) {
+				referenced = true
+				if !options.KeepReferences {
+					*field = ""
+				}
+			}
+		}
+		switch {
+		case referenced && options.KeepReferences:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s reads environment variables or files when connecting", conn.Name))
+		case referenced:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: references to environment variables or files were removed", conn.Name))
+		}
+		if s.key != nil {
+			if conn, err = seal(conn, s.key); err != nil {
+				return nil, err
+			}
+		}
+
+		existing := -1
+		for i, c := range connections {
+			if c.Name == conn.Name {
+				existing = i
+				break
+			}
+		}
+		switch {
+		case existing < 0:
+			connections = append(connections, conn)
+			result.Added = append(result.Added, conn.Name)
+		case onConflict == ConflictOverwrite:
+			connections[existing] = conn
+			result.Overwritten = append(result.Overwritten, conn.Name)
+		case onConflict == ConflictSkip:
+			result.Skipped = append(result.Skipped, conn.Name)
+		default:
+			name := uniqueConnectionName(connections, conn.Name)
+			if result.Renamed == nil {
+				result.Renamed = make(map[string]string)
+			}
+			result.Renamed[name] = conn.Name
+			conn.Name = name
+			connections = append(connections, conn)
+			result.Added = append(result.Added, name)
+		}
+	}
+
+	previous := s.Connections
+	s.Connections = connections
+	if err := s.save(); err != nil {
+		s.Connections = previous
+		return nil, err
+	}
+	return result, nil
+}
+
+// uniqueConnectionName returns name with the first free " (n)" suffix
+func uniqueConnectionName(connections []SavedConnection, name string) string {
+	taken := make(map[string]bool)
+	for _, c := range connections {
+		taken[c.Name] = true
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// readConnectionFile reads connections from any of the supported formats,
+// with warnings about what could not be carried over
+func readConnectionFile(data []byte, passphrase string) ([]SavedConnection, []string, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return readNavicatConnections(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		// connections.json from before encryption was added
+		var conns []SavedConnection
+		if err := json.Unmarshal(trimmed, &conns); err != nil {
+			return nil, nil, fmt.Errorf("failed to read connections: %v", err)
+		}
+		return conns, nil, nil
+	case !bytes.HasPrefix(trimmed, []byte("{")):
+		return nil, nil, fmt.Errorf("unrecognized connections file")
+	}
+
+	var probe struct {
+		Connections json.RawMessage `json:"connections"`
+	}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return nil, nil, fmt.Errorf("failed to read connections: %v", err)
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(probe.Connections)), "{") {
+		return readDBeaverConnections(trimmed)
+	}
+	return readSyncforgeConnections(trimmed, passphrase)
+}
+
+// readSyncforgeConnections reads an export or a connections.json, whose
+// secrets are sealed when they have a passphrase
+func readSyncforgeConnections(data []byte, passphrase string) ([]SavedConnection, []string, error) {
+	var export connectionExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, nil, fmt.Errorf("failed to read connections: %v", err)
+	}
+	if export.Encryption == nil {
+		return export.Connections, nil, nil
+	}
+
+	if passphrase == "" {
+		return nil, nil, fmt.Errorf("the file is encrypted: a passphrase is needed")
+	}
+	key, err := export.Encryption.unlock(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range export.Connections {
+		for _, field := range secretFields(&export.Connections[i].Config) {
+			if *field, err = openSecret(key, *field); err != nil {
+				return nil, nil, fmt.Errorf("connection %s: %v", export.Connections[i].Name, err)
+			}
+		}
+	}
+	return export.Connections, nil, nil
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNavicatPassword(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		// Published Navicat 12 vectors
+		{value: "833E4ABBC56C89041A9070F043641E3B", want: "123456"},
+		{value: "B75D320B6211468D63EB3B67C9E85933", want: "This is a test"},
+		{value: "", want: ""},
+		{value: "not hex", wantErr: true},
+		{value: "833E4ABB", wantErr: true},
+		// Navicat 11 used a different scheme
+		{value: "15057D7BA390", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := navicatPassword(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("navicatPassword(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("navicatPassword(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReadNavicatConnections(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<Connections Ver="1.5">
+	<Connection ConnectionName="shop" ConnType="MYSQL" Host="db.example.com" Port="3307" Database="shop"
+		UserName="app" Password="833E4ABBC56C89041A9070F043641E3B" SSH="true" SSH_Host="bastion" SSH_Port="2222"
+		SSH_UserName="ops" SSH_Password="" SSH_PrivateKey="/keys/id" SSH_Passphrase="B75D320B6211468D63EB3B67C9E85933"/>
+	<Connection ConnectionName="reports" ConnType="POSTGRESQL" Host="pg" Port="" UserName="r" Password="zz"
+		SSL="true" SSL_CACert="/ca.pem" SSL_PGSSLMode="verify_full"/>
+	<Connection ConnectionName="local" ConnType="SQLITE" DatabaseFileName="/data/app.db"/>
+	<Connection ConnectionName="legacy" ConnType="ORACLE" Host="ora"/>
+</Connections>`
+	conns, warnings, err := readConnectionFile([]byte(data), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SavedConnection{
+		{Name: "shop", Config: ConnectionConfig{
+			Type: MySQL, Host: "db.example.com", Port: 3307, Database: "shop", User: "app", Password: "123456",
+			SSH: SSHConfig{Host: "bastion", Port: 2222, User: "ops", PrivateKey: "/keys/id", Passphrase: "This is a test"},
+		}},
+		{Name: "reports", Config: ConnectionConfig{
+			Type: PostgreSQL, Host: "pg", Port: 5432, User: "r",
+			TLS: TLSConfig{Mode: TLSVerifyFull, CACert: "/ca.pem"},
+		}},
+		{Name: "local", Config: ConnectionConfig{Type: SQLite, FilePath: "/data/app.db"}},
+	}
+	if !reflect.DeepEqual(conns, want) {
+		t.Errorf("connections =\n%+v\nwant\n%+v", conns, want)
+	}
+	wantWarnings := []string{
+		"reports: password could not be decrypted and was not imported",
+		"legacy skipped: unsupported Navicat connection type ORACLE",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestReadDBeaverConnections(t *testing.T) {
+	data := `{
+	"folders": {},
+	"connections": {
+		"mysql8-1": {
+			"provider": "mysql", "driver": "mysql8", "name": "shop",
+			"configuration": {
+				"host": "db.example.com", "port": "3307", "database": "shop", "user": "app",
+				"handlers": {
+					"ssh_tunnel": {"type": "TUNNEL", "enabled": true,
+						"properties": {"host": "bastion", "port": 22, "user": "ops", "keyPath": "/keys/id"}},
+					"postgre_ssl": {"type": "CONFIG", "enabled": false}
+				}
+			}
+		},
+		"postgres-jdbc-1": {
+			"provider": "postgresql", "driver": "postgres-jdbc", "name": "reports",
+			"configuration": {"host": "pg", "database": "reports", "user": "r", "password": "inline",
+				"handlers": {"openssl": {"enabled": true}}}
+		},
+		"sqlite-1": {
+			"provider": "generic", "driver": "sqlite_jdbc", "name": "local",
+			"configuration": {"url": "jdbc:sqlite:/data/app.db"}
+		},
+		"oracle-1": {"provider": "oracle", "driver": "oracle_thin", "name": "legacy", "configuration": {}}
+	}
+}`
+	conns, warnings, err := readConnectionFile([]byte(data), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SavedConnection{
+		{Name: "local", Config: ConnectionConfig{Type: SQLite, FilePath: "/data/app.db"}},
+		{Name: "reports", Config: ConnectionConfig{
+			Type: PostgreSQL, Host: "pg", Port: 5432, Database: "reports", User: "r", Password: "inline",
+		}},
+		{Name: "shop", Config: ConnectionConfig{
+			Type: MySQL, Host: "db.example.com", Port: 3307, Database: "shop", User: "app",
+			SSH: SSHConfig{Host: "bastion", Port: 22, User: "ops", PrivateKey: "/keys/id"},
+		}},
+	}
+	if !reflect.DeepEqual(conns, want) {
+		t.Errorf("connections =\n%+v\nwant\n%+v", conns, want)
+	}
+	wantWarnings := []string{
+		"legacy skipped: unsupported DBeaver driver oracle_thin",
+		"reports: TLS settings were not imported",
+		"DBeaver keeps passwords apart from data-sources.json; enter them before connecting",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func savedNames(store *ConnectionStore) []string {
+	var names []string
+	for _, c := range store.GetAll() {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newTestStore(t)
+	for _, conn := range []SavedConnection{
+		{Name: "prod", Config: ConnectionConfig{Type: PostgreSQL, Host: "pg", User: "app", Password: "hunter2",
+			SSH: SSHConfig{Host: "bastion", Passphrase: "${env:KEY_PASS}"}}},
+		{Name: "dev", Config: ConnectionConfig{Type: MySQL, Host: "localhost", Password: "dev"}},
+	} {
+		if err := source.Save(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		export       ExportOptions
+		import_      ImportOptions
+		wantPassword string
+		wantErr      string
+	}{
+		{name: "plaintext", wantPassword: "hunter2"},
+		{name: "encrypted", export: ExportOptions{Passphrase: "s3cret"}, import_: ImportOptions{Passphrase: "s3cret"}, wantPassword: "hunter2"},
+		{name: "encrypted without passphrase", export: ExportOptions{Passphrase: "s3cret"}, wantErr: "passphrase is needed"},
+		{name: "encrypted with wrong passphrase", export: ExportOptions{Passphrase: "s3cret"}, import_: ImportOptions{Passphrase: "nope"}, wantErr: "passphrase"},
+		{name: "stripped", export: ExportOptions{StripPasswords: true}, wantPassword: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.export.Names = []string{"prod"}
+			data, err := source.Export(tt.export)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.export.Passphrase != "" && strings.Contains(string(data), "hunter2") {
+				t.Error("encrypted export holds the plaintext password")
+			}
+
+			target := newTestStore(t)
+			tt.import_.KeepReferences = true
+			result, err := target.Import(data, tt.import_)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Import() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Added, []string{"prod"}) {
+				t.Errorf("added %q", result.Added)
+			}
+			got, _ := target.Get("prod")
+			if got.Config.Password != tt.wantPassword || got.Config.SSH.Passphrase != "${env:KEY_PASS}" || got.Config.Host != "pg" {
+				t.Errorf("imported %+v", got.Config)
+			}
+		})
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	data := []byte(`[{"name": "prod", "config": {"host": "new"}}, {"name": "other", "config": {"host": "other"}}]`)
+	tests := []struct {
+		onConflict string
+		wantNames  []string
+		wantHost   string
+		check      func(*ImportResult) bool
+	}{
+		{
+			onConflict: "",
+			wantNames:  []string{"other", "prod", "prod (2)"},
+			wantHost:   "old",
+			check: func(r *ImportResult) bool {
+				return reflect.DeepEqual(r.Added, []string{"prod (2)", "other"}) && r.Renamed["prod (2)"] == "prod"
+			},
+		},
+		{
+			onConflict: ConflictOverwrite,
+			wantNames:  []string{"other", "prod"},
+			wantHost:   "new",
+			check: func(r *ImportResult) bool {
+				return reflect.DeepEqual(r.Overwritten, []string{"prod"}) && reflect.DeepEqual(r.Added, []string{"other"})
+			},
+		},
+		{
+			onConflict: ConflictSkip,
+			wantNames:  []string{"other", "prod"},
+			wantHost:   "old",
+			check: func(r *ImportResult) bool {
+				return reflect.DeepEqual(r.Skipped, []string{"prod"}) && reflect.DeepEqual(r.Added, []string{"other"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		store := newTestStore(t)
+		if err := store.Save(SavedConnection{Name: "prod", Config: ConnectionConfig{Host: "old"}}); err != nil {
+			t.Fatal(err)
+		}
+		result, err := store.Import(data, ImportOptions{OnConflict: tt.onConflict})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tt.check(result) {
+			t.Errorf("%q: result %+v", tt.onConflict, result)
+		}
+		if names := savedNames(store); !reflect.DeepEqual(names, tt.wantNames) {
+			t.Errorf("%q: saved %q, want %q", tt.onConflict, names, tt.wantNames)
+		}
+		if got, _ := store.Get("prod"); got.Config.Host != tt.wantHost {
+			t.Errorf("%q: prod host = %q, want %q", tt.onConflict, got.Config.Host, tt.wantHost)
+		}
+	}
+
+	store := newTestStore(t)
+	if _, err := store.Import(data, ImportOptions{OnConflict: "merge"}); err == nil {
+		t.Error("unsupported conflict resolution accepted")
+	}
+}
+
+func TestImportStripsReferences(t *testing.T) {
+	data := []byte(`[{"name": "evil", "config": {
+		"host": "attacker.example.com", "user": "${env:AWS_ACCESS_KEY_ID}",
+		"password": "${env:AWS_SECRET_ACCESS_KEY}",
+		"ssh": {"host": "bastion", "password": "${file:/home/u/.ssh/id_rsa}", "passphrase": "${saved:prod}"}
+	}}]`)
+
+	store := newTestStore(t)
+	result, err := store.Import(data, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Get("evil")
+	if got.Config.Password != "" || got.Config.SSH.Password != "" || got.Config.SSH.Passphrase != "" {
+		t.Errorf("references kept: %+v", got.Config)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "removed") {
+		t.Errorf("warnings = %q", result.Warnings)
+	}
+	// Other settings are never resolved, so they are kept as written
+	if got.Config.User != "${env:AWS_ACCESS_KEY_ID}" {
+		t.Errorf("user = %q", got.Config.User)
+	}
+
+	store = newTestStore(t)
+	if _, err := store.Import(data, ImportOptions{KeepReferences: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = store.Get("evil")
+	if got.Config.Password != "${env:AWS_SECRET_ACCESS_KEY}" || got.Config.SSH.Password != "${file:/home/u/.ssh/id_rsa}" {
+		t.Errorf("references not kept with KeepReferences: %+v", got.Config)
+	}
+	if got.Config.SSH.Passphrase != "" {
+		t.Errorf("another store's redacted secret kept: %q", got.Config.SSH.Passphrase)
+	}
+}
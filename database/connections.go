@@ -1,7 +1,9 @@
 package database
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -13,13 +15,31 @@ type SavedConnection struct {
 	Config   ConnectionConfig `json:"config"`
 }
 
-// ConnectionStore manages saved connections
+// ConnectionStore manages saved connections. With a passphrase set, their
+// secrets are encrypted in the file and in memory, and only readable once
+// the store is unlocked.
 type ConnectionStore struct {
 	Connections []SavedConnection `json:"connections"`
 	filePath    string
+	encryption  *StoreEncryption
+	key         []byte
 	mu          sync.RWMutex
 }
 
+// connectionFile is the layout of connections.json. Older files hold just
+// the array of connections, with plaintext secrets.
+type connectionFile struct {
+	Encryption  *StoreEncryption  `json:"encryption,omitempty"`
+	Connections []SavedConnection `json:"connections"`
+}
+
+// StoreState tells whether saved secrets are encrypted, and whether they
+// are locked until the passphrase is given
+type StoreState struct {
+	Encrypted bool `json:"encrypted"`
+	Locked    bool `json:"locked"`
+}
+
 // NewConnectionStore creates a new connection store
 func NewConnectionStore() (*ConnectionStore, error) {
 	homeDir, err := os.UserHomeDir()
@@ -56,33 +76,224 @@ func (s *ConnectionStore) load() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &s.Connections)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &s.Connections)
+	}
+	var file connectionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	s.Connections = file.Connections
+	s.encryption = file.Encryption
+	if s.Connections == nil {
+		s.Connections = []SavedConnection{}
+	}
+	return nil
 }
 
 // save writes connections to file
 func (s *ConnectionStore) save() error {
-	data, err := json.MarshalIndent(s.Connections, "", "  ")
+	data, err := json.MarshalIndent(connectionFile{
+		Encryption:  s.encryption,
+		Connections: s.Connections,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(s.filePath, data, 0600)
 }
 
+// locked reports whether secrets are encrypted and the key is not known
+func (s *ConnectionStore) locked() bool {
+	return s.encryption != nil && s.key == nil
+}
+
+// reveal decrypts the secrets of a stored connection. While the store is
+// locked they are left empty.
+func (s *ConnectionStore) reveal(conn SavedConnection) (SavedConnection, error) {
+	if s.encryption == nil {
+		return conn, nil
+	}
+	for _, field := range secretFields(&conn.Config) {
+		if s.key == nil {
+			if isSealed(*field) {
+				*field = ""
+			}
+			continue
+		}
+		value, err := openSecret(s.key, *field)
+		if err != nil {
+			return conn, fmt.Errorf("connection %s: %v", conn.Name, err)
+		}
+		*field = value
+	}
+	return conn, nil
+}
+
+// revealed decrypts what it can of a stored connection, leaving out a
+// secret that fails to decrypt rather than the whole connection
+func (s *ConnectionStore) revealed(c SavedConnection) SavedConnection {
+	conn, err := s.reveal(c)
+	if err != nil {
+		for _, field := range secretFields(&conn.Config) {
+			if isSealed(*field) {
+				*field = ""
+			}
+		}
+	}
+	return conn
+}
+
+// seal encrypts the secrets of a connection with key
+func seal(conn SavedConnection, key []byte) (SavedConnection, error) {
+	for _, field := range secretFields(&conn.Config) {
+		if *field == "" || isSealed(*field) {
+			continue
+		}
+		value, err := sealSecret(key, *field)
+		if err != nil {
+			return conn, err
+		}
+		*field = value
+	}
+	return conn, nil
+}
+
+// State returns whether secrets are encrypted and locked
+func (s *ConnectionStore) State() StoreState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return StoreState{Encrypted: s.encryption != nil, Locked: s.locked()}
+}
+
+// Unlock derives the key from the passphrase so secrets can be read and
+// saved. Secrets still in plaintext, such as ones added to the file by
+// hand, are encrypted on the way.
+func (s *ConnectionStore) Unlock(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.encryption == nil {
+		return nil
+	}
+	key, err := s.encryption.unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	s.key = key
+
+	migrated := false
+	for i, conn := range s.Connections {
+		for _, field := range secretFields(&conn.Config) {
+			if *field != "" && !isSealed(*field) {
+				migrated = true
+			}
+		}
+		if s.Connections[i], err = seal(conn, key); err != nil {
+			return err
+		}
+	}
+	if migrated {
+		return s.save()
+	}
+	return nil
+}
+
+// Lock forgets the key until the next Unlock
+func (s *ConnectionStore) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.key = nil
+}
+
+// SetPassphrase encrypts the saved secrets with a new passphrase, or
+// stores them in plaintext again if it is empty. Setting the first
+// passphrase migrates a plaintext file. The store must be unlocked.
+func (s *ConnectionStore) SetPassphrase(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked() {
+		return fmt.Errorf("saved connections are locked")
+	}
+
+	var encryption *StoreEncryption
+	var key []byte
+	if passphrase != "" {
+		var err error
+		if encryption, key, err = newStoreEncryption(passphrase); err != nil {
+			return err
+		}
+	}
+
+	connections := make([]SavedConnection, len(s.Connections))
+	for i, conn := range s.Connections {
+		conn, err := s.reveal(conn)
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			if conn, err = seal(conn, key); err != nil {
+				return err
+			}
+		}
+		connections[i] = conn
+	}
+
+	previous, previousEncryption, previousKey := s.Connections, s.encryption, s.key
+	s.Connections, s.encryption, s.key = connections, encryption, key
+	if err := s.save(); err != nil {
+		s.Connections, s.encryption, s.key = previous, previousEncryption, previousKey
+		return err
+	}
+	return nil
+}
+
 // GetAll returns all saved connections
 func (s *ConnectionStore) GetAll() []SavedConnection {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	result := make([]SavedConnection, len(s.Connections))
-	copy(result, s.Connections)
+	result := make([]SavedConnection, 0, len(s.Connections))
+	for _, c := range s.Connections {
+		result = append(result, s.revealed(c))
+	}
 	return result
 }
 
+// Get returns the connection with the given name
+func (s *ConnectionStore) Get(name string) (SavedConnection, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.Connections {
+		if c.Name == name {
+			return s.revealed(c), true
+		}
+	}
+	return SavedConnection{}, false
+}
+
 // Save adds or updates a connection
 func (s *ConnectionStore) Save(conn SavedConnection) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.locked() {
+		return fmt.Errorf("saved connections are locked")
+	}
+	if err := s.unredact(&conn); err != nil {
+		return err
+	}
+	if s.key != nil {
+		var err error
+		if conn, err = seal(conn, s.key); err != nil {
+			return err
+		}
+	}
+
 	// Check if connection with same name exists
 	for i, c := range s.Connections {
 		if c.Name == conn.Name {
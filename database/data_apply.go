@@ -0,0 +1,160 @@
+package database
+
+import "fmt"
+
+// DataSyncResult reports what ApplyDataSync changed in the target
+type DataSyncResult struct {
+	// Rows the committed changes wrote per type, as the target reports
+	// them. An update that leaves a row as it was may not count.
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Deleted  int `json:"deleted"`
+	// Rows written per table
+	Tables map[string]int `json:"tables"`
+	// The change that failed, and whether the transaction was rolled back
+	Failed        *DataSyncFailure `json:"failed,omitempty"`
+	RolledBack    bool             `json:"rolledBack"`
+	RollbackError string           `json:"rollbackError,omitempty"`
+}
+
+// DataSyncFailure identifies the row whose change failed. When a batch of
+// inserts fails it is the first row of the batch, and Error says how many
+// rows the batch held.
+type DataSyncFailure struct {
+	TableName  string                 `json:"tableName"`
+	Type       string                 `json:"type"`
+	PrimaryKey map[string]interface{} `json:"primaryKey"`
+	SQL        string                 `json:"sql"`
+	Error      string                 `json:"error"`
+}
+
+// PlanDataSync returns the differences CompareDataSync finds in the order
+// ApplyDataSync runs them: deletes first, children before the tables they
+// reference, and then inserts and updates, parents first, so foreign keys
+// hold throughout
+func PlanDataSync(config DataSyncConfig) ([]DataDiffResult, error) {
+	diffs, err := CompareDataSync(config)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := targetTableInfo(config.TargetConfig, diffs)
+	if err != nil {
+		return nil, err
+	}
+	return orderDiffsForApply(diffs, tables), nil
+}
+
+// ApplyDataSync compares the tables of a sync configuration and applies the
+// differences of the kinds it enables to the target, in one transaction and
+// in the order of PlanDataSync
+func ApplyDataSync(config DataSyncConfig) (*DataSyncResult, error) {
+	diffs, err := PlanDataSync(config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DataSyncResult{Tables: make(map[string]int)}
+	if len(diffs) == 0 {
+		return result, nil
+	}
+
+	exec, err := ExecuteDataDiffs(config.TargetConfig, diffs, config.Apply)
+	if err != nil {
+		return nil, err
+	}
+	if exec.Failed != nil {
+		diff := diffs[exec.Failed.Index-1]
+		result.Failed = &DataSyncFailure{
+			TableName:  diff.TableName,
+			Type:       diff.Type,
+			PrimaryKey: diff.PrimaryKey,
+			SQL:        diff.SQL,
+			Error:      exec.Failed.Error,
+		}
+		result.RolledBack = exec.RolledBack
+		result.RollbackError = exec.RollbackError
+		return result, nil
+	}
+
+	for _, run := range exec.runs {
+		diff := diffs[run.index]
+		rows := int(run.rows)
+		switch diff.Type {
+		case "insert":
+			result.Inserted += rows
+		case "update":
+			result.Updated += rows
+		case "delete":
+			result.Deleted += rows
+		}
+		result.Tables[diff.TableName] += rows
+	}
+	return result, nil
+}
+
+// targetTableInfo reads the foreign keys of the target tables the
+// differences write to, when there are several to order
+func targetTableInfo(config ConnectionConfig, diffs []DataDiffResult) (map[string]TableInfo, error) {
+	names := diffTargetTables(diffs)
+	if len(names) < 2 {
+		return nil, nil
+	}
+	db, err := Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tables := make(map[string]TableInfo)
+	for _, name := range names {
+		table, err := tableInfo(db, config.Type, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s: %v", name, err)
+		}
+		tables[name] = *table
+	}
+	return tables, nil
+}
+
+// diffTargetTables returns the tables differences write to, in the order
+// they first appear
+func diffTargetTables(diffs []DataDiffResult) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, diff := range diffs {
+		if name := diff.targetTable(); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// orderDiffsForApply puts deletes first, tables that reference others
+// before the tables they reference, and then inserts and updates with
+// referenced tables first, using the order the migration plan creates
+// tables in. The differences of one table keep their order.
+func orderDiffsForApply(diffs []DataDiffResult, tables map[string]TableInfo) []DataDiffResult {
+	order, _ := orderByReferences(diffTargetTables(diffs), tables)
+	byTable := make(map[string][]DataDiffResult)
+	for _, diff := range diffs {
+		byTable[diff.targetTable()] = append(byTable[diff.targetTable()], diff)
+	}
+
+	ordered := make([]DataDiffResult, 0, len(diffs))
+	for i := len(order) - 1; i >= 0; i-- {
+		for _, diff := range byTable[order[i]] {
+			if diff.Type == "delete" {
+				ordered = append(ordered, diff)
+			}
+		}
+	}
+	for _, name := range order {
+		for _, diff := range byTable[name] {
+			if diff.Type != "delete" {
+				ordered = append(ordered, diff)
+			}
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOrderDiffsForApply(t *testing.T) {
+	tables := map[string]TableInfo{
+		"orders":    {ForeignKeys: []ForeignKeyInfo{{Name: "fk_customer", Columns: []string{"customer_id"}, ReferencedTable: "customers"}}},
+		"customers": {},
+		"lines":     {ForeignKeys: []ForeignKeyInfo{{Name: "fk_order", Columns: []string{"order_id"}, ReferencedTable: "orders"}}},
+	}
+	diffs := []DataDiffResult{
+		{Type: "insert", TableName: "lines", SQL: "insert line"},
+		{Type: "delete", TableName: "customers", SQL: "delete customer"},
+		{Type: "insert", TableName: "orders", SQL: "insert order 1"},
+		{Type: "delete", TableName: "orders", SQL: "delete order"},
+		{Type: "insert", TableName: "orders", SQL: "insert order 2"},
+		{Type: "update", TableName: "customers", SQL: "update customer"},
+		{Type: "delete", TableName: "lines", SQL: "delete line"},
+		{Type: "insert", TableName: "src_customers", TargetTable: "customers", SQL: "insert customer"},
+	}
+	var got []string
+	for _, diff := range orderDiffsForApply(diffs, tables) {
+		got = append(got, diff.SQL)
+	}
+	want := []string{
+		"delete line", "delete order", "delete customer",
+		"update customer", "insert customer", "insert order 1", "insert order 2", "insert line",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+}
+
+func TestApplyDataSyncForeignKeys(t *testing.T) {
+	dir := t.TempDir()
+	sqlite := func(name string) ConnectionConfig {
+		return ConnectionConfig{Type: SQLite, FilePath: "file:" + filepath.Join(dir, name) + "?_foreign_keys=1"}
+	}
+	source, target := sqlite("source.db"), sqlite("target.db")
+	schema := "CREATE TABLE parents (id INTEGER PRIMARY KEY, name TEXT);\n" +
+		"CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER NOT NULL REFERENCES parents (id), name TEXT);\n"
+	if err := ExecuteSQL(source, schema+
+		"INSERT INTO parents VALUES (2, 'new'), (3, 'same');\n"+
+		"INSERT INTO children VALUES (20, 2, 'new child'), (30, 3, 'renamed');"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExecuteSQL(target, schema+
+		"INSERT INTO parents VALUES (1, 'old'), (3, 'same');\n"+
+		"INSERT INTO children VALUES (10, 1, 'old child'), (30, 3, 'child');"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Children come first alphabetically, so request order would break the keys
+	result, err := ApplyDataSync(DataSyncConfig{
+		SourceConfig: source,
+		TargetConfig: target,
+		Tables:       []string{"children", "parents"},
+		SyncInsert:   true,
+		SyncUpdate:   true,
+		SyncDelete:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != nil {
+		t.Fatalf("sync failed: %+v", result.Failed)
+	}
+	if result.Inserted != 2 || result.Updated != 1 || result.Deleted != 2 {
+		t.Errorf("inserted %d, updated %d, deleted %d", result.Inserted, result.Updated, result.Deleted)
+	}
+	if want := map[string]int{"children": 3, "parents": 2}; !reflect.DeepEqual(result.Tables, want) {
+		t.Errorf("tables = %v, want %v", result.Tables, want)
+	}
+
+	diffs, err := CompareDataSync(DataSyncConfig{
+		SourceConfig: source, TargetConfig: target, Tables: []string{"children", "parents"},
+		SyncInsert: true, SyncUpdate: true, SyncDelete: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("%d differences left after sync", len(diffs))
+	}
+}
+
+func TestExecuteDataDiffsRowsAffected(t *testing.T) {
+	target := ConnectionConfig{Type: SQLite, FilePath: filepath.Join(t.TempDir(), "target.db")}
+	if err := ExecuteSQL(target, "CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t VALUES (1, 'a');"); err != nil {
+		t.Fatal(err)
+	}
+	diffs := []DataDiffResult{
+		{Type: "update", TableName: "t", SQL: "UPDATE t SET v = 'b' WHERE id = 1;"},
+		// Matches no row
+		{Type: "delete", TableName: "t", SQL: "DELETE FROM t WHERE id = 99;"},
+		{Type: "insert", TableName: "t", SQL: "INSERT INTO t VALUES (2, 'c');"},
+	}
+	result, err := ExecuteDataDiffs(target, diffs, DataApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Executed != 3 || result.RowsAffected != 2 {
+		t.Errorf("executed %d, rows affected %d", result.Executed, result.RowsAffected)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// checksumBlockSize is the number of source rows covered by one checksum
+const checksumBlockSize = 10000
+
+// compareBlocks walks the source table in blocks of blockSize keys and merges
+// the rows of the blocks whose checksums differ between the two sides, in
+// the manner of pt-table-checksum
+func (c *tableComparison) compareBlocks(blockSize int, emit func(DataDiffResult) error) error {
+	if c.sourceType != c.targetType || checksumExpr(c.sourceType, c.columns, c.primaryKeys) == "" {
+		return c.stream(dataChunkSize, emit)
+	}
+	if blockSize <= 0 {
+		blockSize = checksumBlockSize
+	}
+
+	var lower []interface{}
+	for {
+		// The last block is open-ended so it also covers target rows past
+		// the end of the source
+		upper, err := c.blockEnd(lower, blockSize)
+		if err != nil {
+			return fmt.Errorf("failed to split source into blocks: %v", err)
+		}
+
+		sourceSum, err := c.blockChecksum(c.sourceDB, c.tableName, c.columns, c.primaryKeys, c.values.kinds, c.options.Filter, lower, upper)
+		if err != nil {
+			return fmt.Errorf("failed to checksum source: %v", err)
+		}
+		targetSum, err := c.blockChecksum(c.targetDB, c.targetTable, c.targetColumns, c.targetKeys, c.targetKinds, c.targetFilter, lower, upper)
+		if err != nil {
+			return fmt.Errorf("failed to checksum target: %v", err)
+		}
+		if sourceSum != targetSum {
+			if err := c.merge(lower, upper, dataChunkSize, emit); err != nil {
+				return err
+			}
+		}
+
+		if upper == nil {
+			return nil
+		}
+		lower = upper
+	}
+}
+
+// blockEnd returns the key of the blockSize-th source row after lower, or nil
+// when fewer rows are left
+func (c *tableComparison) blockEnd(lower []interface{}, blockSize int) ([]interface{}, error) {
+	exprs := keyExprs(c.sourceType, c.primaryKeys, c.values.kinds)
+	where, args := keyRange(c.sourceType, exprs, lower, nil)
+	where = withFilter(where, c.options.Filter)
+	keys := quotedKeyList(c.sourceType, c.primaryKeys)
+	order := strings.Join(exprs, ", ")
+	table := quoteTableName(c.sourceType, c.tableName)
+
+	var query string
+	switch c.sourceType {
+	case SQLServer:
+		query = fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s OFFSET %d ROWS FETCH NEXT 1 ROWS ONLY",
+			keys, table, where, order, blockSize-1)
+	default:
+		query = fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT 1 OFFSET %d",
+			keys, table, where, order, blockSize-1)
+	}
+
+	rows, err := c.sourceDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	row, err := scanRow(rows, c.primaryKeys)
+	if err != nil {
+		return nil, err
+	}
+	return keyValues(row, c.primaryKeys), nil
+}
+
+// blockChecksum returns the row count and checksum of a block on one side,
+// given that side's names of the table, columns and key, its column kinds
+// and its filter
+func (c *tableComparison) blockChecksum(db *sql.DB, tableName string, columns, primaryKeys []string, kinds map[string]valueKind, filter string, lower, upper []interface{}) (string, error) {
+	where, args := keyRange(c.sourceType, keyExprs(c.sourceType, primaryKeys, kinds), lower, upper)
+	where = withFilter(where, filter)
+	query := fmt.Sprintf("SELECT COUNT(*), %s FROM %s%s",
+		checksumExpr(c.sourceType, columns, primaryKeys), quoteTableName(c.sourceType, tableName), where)
+
+	var count int64
+	var sum interface{}
+	if err := db.QueryRow(query, args...).Scan(&count, &sum); err != nil {
+		return "", err
+	}
+	if b, ok := sum.([]byte); ok {
+		sum = string(b)
+	}
+	return fmt.Sprintf("%d:%v", count, sum), nil
+}
+
+// checksumExpr returns an aggregate hashing every column of the rows it runs
+// over, or "" for engines without one
+func checksumExpr(dbType DBType, columns, primaryKeys []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(dbType, col)
+	}
+	cols := strings.Join(quoted, ", ")
+
+	switch dbType {
+	case MySQL, "":
+		// CONCAT_WS skips NULLs, so a NULL flag per column is hashed too
+		nulls := make([]string, len(quoted))
+		for i, col := range quoted {
+			nulls[i] = fmt.Sprintf("ISNULL(%s)", col)
+		}
+		return fmt.Sprintf("BIT_XOR(CAST(CONV(SUBSTRING(MD5(CONCAT_WS('#', %s, CONCAT(%s))), 1, 16), 16, 10) AS UNSIGNED))",
+			cols, strings.Join(nulls, ", "))
+	case PostgreSQL:
+		return fmt.Sprintf("md5(string_agg(md5(ROW(%s)::text), '' ORDER BY %s))",
+			cols, quotedKeyList(dbType, primaryKeys))
+	case SQLServer:
+		return fmt.Sprintf("CHECKSUM_AGG(BINARY_CHECKSUM(%s))", cols)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestChecksumExpr(t *testing.T) {
+	columns, keys := []string{"id", "name"}, []string{"id"}
+	tests := []struct {
+		dbType DBType
+		want   string
+	}{
+		{MySQL, "BIT_XOR(CAST(CONV(SUBSTRING(MD5(CONCAT_WS('#', `id`, `name`, CONCAT(ISNULL(`id`), ISNULL(`name`)))), 1, 16), 16, 10) AS UNSIGNED))"},
+		{PostgreSQL, `md5(string_agg(md5(ROW("id", "name")::text), '' ORDER BY "id"))`},
+		{SQLServer, "CHECKSUM_AGG(BINARY_CHECKSUM([id], [name]))"},
+		{SQLite, ""},
+	}
+	for _, tt := range tests {
+		if got := checksumExpr(tt.dbType, columns, keys); got != tt.want {
+			t.Errorf("%s: checksumExpr =\n%s\nwant\n%s", tt.dbType, got, tt.want)
+		}
+	}
+}
+
+// openBlockComparison compares two SQLite tables of (id, v) rows
+func openBlockComparison(t *testing.T, options DataCompareOptions, sourceRows, targetRows string) *tableComparison {
+	t.Helper()
+	create := "CREATE TABLE items (id INTEGER PRIMARY KEY, v TEXT)"
+	source := newSQLiteFile(t, "source.db", create, "INSERT INTO items VALUES "+sourceRows)
+	target := newSQLiteFile(t, "target.db", create, "INSERT INTO items VALUES "+targetRows)
+	c, err := openTableComparison(source, target, "items", "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.close)
+	return c
+}
+
+func TestBlockEnd(t *testing.T) {
+	c := openBlockComparison(t, DataCompareOptions{Filter: "id <> 3"},
+		"(1, 'a'), (2, 'b'), (3, 'c'), (4, 'd'), (5, 'e'), (6, 'f')", "(1, 'a')")
+
+	// Blocks hold two filtered source rows each; the last one is open-ended
+	var bounds [][]interface{}
+	var lower []interface{}
+	for {
+		upper, err := c.blockEnd(lower, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upper == nil {
+			break
+		}
+		bounds = append(bounds, upper)
+		lower = upper
+	}
+	want := [][]interface{}{{int64(2)}, {int64(5)}}
+	if !reflect.DeepEqual(bounds, want) {
+		t.Errorf("block ends = %v, want %v", bounds, want)
+	}
+}
+
+func TestMergeBlock(t *testing.T) {
+	c := openBlockComparison(t, DataCompareOptions{},
+		"(1, 'a'), (2, 'b'), (3, 'c'), (4, 'd')",
+		"(1, 'x'), (3, 'c'), (4, 'y'), (7, 'g')")
+
+	collect := func(lower, upper []interface{}) []string {
+		var got []string
+		err := c.merge(lower, upper, 1, func(diff DataDiffResult) error {
+			got = append(got, diff.Type)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	// A block covers the keys after its lower bound and up to its upper one
+	if got, want := collect([]interface{}{int64(1)}, []interface{}{int64(3)}), []string{"insert"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("block (1, 3] = %v, want %v", got, want)
+	}
+	if got, want := collect(nil, []interface{}{int64(1)}), []string{"update"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("block (, 1] = %v, want %v", got, want)
+	}
+	// The open-ended last block takes the target rows past the source's end
+	if got, want := collect([]interface{}{int64(3)}, nil), []string{"delete", "update"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("block (3, ) = %v, want %v", got, want)
+	}
+}
+
+func TestCompareBlocksWithoutChecksum(t *testing.T) {
+	// SQLite has no checksum aggregate, so blocks fall back to reading every row
+	c := openBlockComparison(t, DataCompareOptions{Checksum: true, BlockSize: 2},
+		"(1, 'a'), (2, 'b'), (3, 'c')", "(2, 'x'), (3, 'c'), (4, 'd')")
+	var got []string
+	err := c.compareBlocks(2, func(diff DataDiffResult) error {
+		got = append(got, diff.Type)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if want := []string{"delete", "insert", "update"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("differences = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,390 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// dataChunkSize is the number of rows read per query when streaming a table
+const dataChunkSize = 1000
+
+// ErrKeyOrder is returned by CompareTableDataStream when a database returns
+// primary keys out of the order the comparison merges them in. Text keys are
+// read in binary order, so this takes keys the engines cannot order by
+// bytes, such as SQL Server uniqueidentifier.
+var ErrKeyOrder = errors.New("the databases order the primary key differently")
+
+// rowStream reads a table in primary key order, one chunk at a time, using
+// the last key read as the starting point of the next query
+type rowStream struct {
+	db          *sql.DB
+	dbType      DBType
+	tableName   string
+	columns     []string
+	primaryKeys []string
+	// Key expressions the rows are ordered and ranged by, see keyExprs
+	keys   []string
+	filter string
+	// Names the rows' columns are renamed to once read, or nil
+	rename    map[string]string
+	chunkSize int
+	// Inclusive key the stream stops at, nil to read to the end
+	upper []interface{}
+	// Whether each primary key column holds numbers, read from the first chunk
+	numeric []bool
+	chunk   []map[string]interface{}
+	pos     int
+	last    []interface{}
+	done    bool
+}
+
+// newRowStream starts reading the rows of a table that match filter, which
+// may be "", with keys after lower and up to upper, either of which may be
+// nil, and fetches the first chunk. kinds gives the kind of each column, so
+// text keys are ordered by their bytes.
+func newRowStream(db *sql.DB, dbType DBType, tableName string, columns, primaryKeys []string, kinds map[string]valueKind, filter string, rename map[string]string, lower, upper []interface{}, chunkSize int) (*rowStream, error) {
+	s := &rowStream{
+		db:          db,
+		dbType:      dbType,
+		tableName:   tableName,
+		columns:     columns,
+		primaryKeys: primaryKeys,
+		keys:        keyExprs(dbType, primaryKeys, kinds),
+		filter:      filter,
+		rename:      rename,
+		chunkSize:   chunkSize,
+		upper:       upper,
+		last:        lower,
+	}
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// next returns the next row, or nil once the table is exhausted
+func (s *rowStream) next() (map[string]interface{}, error) {
+	if s.pos == len(s.chunk) {
+		if s.done {
+			return nil, nil
+		}
+		if err := s.fetch(); err != nil {
+			return nil, err
+		}
+		if len(s.chunk) == 0 {
+			return nil, nil
+		}
+	}
+	row := s.chunk[s.pos]
+	s.pos++
+	return row, nil
+}
+
+func (s *rowStream) fetch() error {
+	query, args := s.chunkQuery()
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if s.numeric == nil {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		s.numeric = make([]bool, len(s.primaryKeys))
+		for i, pk := range s.primaryKeys {
+			for j, col := range s.columns {
+				if col == pk {
+					s.numeric[i] = isNumericType(types[j].DatabaseTypeName())
+				}
+			}
+		}
+	}
+
+	s.chunk = s.chunk[:0]
+	s.pos = 0
+	for rows.Next() {
+		row, err := scanRow(rows, s.columns)
+		if err != nil {
+			return err
+		}
+		s.chunk = append(s.chunk, row)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(s.chunk) < s.chunkSize {
+		s.done = true
+	}
+	if len(s.chunk) > 0 {
+		s.last = keyValues(s.chunk[len(s.chunk)-1], s.primaryKeys)
+	}
+	for i, row := range s.chunk {
+		s.chunk[i] = renameKeys(row, s.rename)
+	}
+	return nil
+}
+
+// chunkQuery selects the next chunkSize rows after the last key read
+func (s *rowStream) chunkQuery() (string, []interface{}) {
+	quotedCols := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		quotedCols[i] = quoteIdentifier(s.dbType, col)
+	}
+	where, args := keyRange(s.dbType, s.keys, s.last, s.upper)
+	where = withFilter(where, s.filter)
+
+	cols := strings.Join(quotedCols, ", ")
+	table := quoteTableName(s.dbType, s.tableName)
+	order := strings.Join(s.keys, ", ")
+	switch s.dbType {
+	case SQLServer:
+		return fmt.Sprintf("SELECT TOP (%d) %s FROM %s%s ORDER BY %s", s.chunkSize, cols, table, where, order), args
+	default:
+		return fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT %d", cols, table, where, order, s.chunkSize), args
+	}
+}
+
+// stream merges the source and target tables, both read in primary key
+// order, emitting differences as it goes. Tables without a key are
+// compared in memory instead.
+func (c *tableComparison) stream(chunkSize int, emit func(DataDiffResult) error) error {
+	if c.multiset {
+		return c.compareMultiset(emit)
+	}
+	return c.merge(nil, nil, chunkSize, emit)
+}
+
+// merge is stream restricted to the keys after lower and up to upper
+func (c *tableComparison) merge(lower, upper []interface{}, chunkSize int, emit func(DataDiffResult) error) error {
+	if chunkSize <= 0 {
+		chunkSize = dataChunkSize
+	}
+
+	source, err := newRowStream(c.sourceDB, c.sourceType, c.tableName, c.columns, c.primaryKeys, c.values.kinds, c.options.Filter, nil, lower, upper, chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to get source data: %v", err)
+	}
+	target, err := newRowStream(c.targetDB, c.targetType, c.targetTable, c.targetColumns, c.targetKeys, c.targetKinds, c.targetFilter, c.toSource, lower, upper, chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to get target data: %v", err)
+	}
+
+	// Keys are compared as numbers only when both sides store them as numbers
+	numeric := make([]bool, len(c.primaryKeys))
+	for i := range numeric {
+		numeric[i] = source.numeric[i] && target.numeric[i]
+	}
+	compare := func(a, b map[string]interface{}) int {
+		return compareKeys(keyValues(a, c.primaryKeys), keyValues(b, c.primaryKeys), numeric)
+	}
+
+	// advance reads the next row of a side and checks it sorts after the last
+	advance := func(s *rowStream, prev map[string]interface{}) (map[string]interface{}, error) {
+		row, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			row = c.values.normalizeRow(row)
+		}
+		if row != nil && prev != nil && compare(prev, row) >= 0 {
+			return nil, ErrKeyOrder
+		}
+		return row, nil
+	}
+
+	sourceRow, err := advance(source, nil)
+	if err != nil {
+		return err
+	}
+	targetRow, err := advance(target, nil)
+	if err != nil {
+		return err
+	}
+
+	for sourceRow != nil || targetRow != nil {
+		// A side that ran out sorts after every key of the other
+		var cmp int
+		switch {
+		case targetRow == nil:
+			cmp = -1
+		case sourceRow == nil:
+			cmp = 1
+		default:
+			cmp = compare(sourceRow, targetRow)
+		}
+
+		switch {
+		case cmp < 0:
+			err = emit(c.insertDiff(sourceRow))
+		case cmp > 0:
+			err = emit(c.deleteDiff(targetRow))
+		case !c.values.rowsEqual(sourceRow, targetRow):
+			err = emit(c.updateDiff(sourceRow, targetRow))
+		}
+		if err != nil {
+			return err
+		}
+
+		if cmp <= 0 {
+			if sourceRow, err = advance(source, sourceRow); err != nil {
+				return err
+			}
+		}
+		if cmp >= 0 {
+			if targetRow, err = advance(target, targetRow); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keyRange returns a WHERE clause, or "", matching the key expressions after
+// lower and up to upper, either of which may be nil. Key comparisons are spelled out
+// column by column, since SQL Server has no row value comparison.
+func keyRange(dbType DBType, keys []string, lower, upper []interface{}) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if lower != nil {
+		var cond string
+		cond, args = keysAfter(dbType, keys, lower, args)
+		conds = append(conds, cond)
+	}
+	if upper != nil {
+		var cond string
+		cond, args = keysAfter(dbType, keys, upper, args)
+		conds = append(conds, "NOT "+cond)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// keysAfter returns a condition matching keys that sort after values, with
+// its bind arguments appended to args
+func keysAfter(dbType DBType, keys []string, values, args []interface{}) (string, []interface{}) {
+	var ors []string
+	for i := range keys {
+		var ands []string
+		for j := 0; j <= i; j++ {
+			op := "="
+			if j == i {
+				op = ">"
+			}
+			args = append(args, values[j])
+			ands = append(ands, fmt.Sprintf("%s %s %s", keys[j], op, placeholder(dbType, len(args))))
+		}
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// keyExprs returns the primary key columns as the expressions rows are
+// ordered and ranged by. Text columns compare by their bytes rather than the
+// column's collation, matching the order compareKeys merges them in: a _ci
+// collation would put "B" between "a" and "c".
+func keyExprs(dbType DBType, primaryKeys []string, kinds map[string]valueKind) []string {
+	exprs := make([]string, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		exprs[i] = quoteIdentifier(dbType, pk)
+		if kinds[pk] != kindText {
+			continue
+		}
+		switch dbType {
+		case MySQL, "":
+			// A cast works whatever the column's character set
+			exprs[i] = fmt.Sprintf("CAST(%s AS BINARY)", exprs[i])
+		case PostgreSQL:
+			exprs[i] += ` COLLATE "C"`
+		case SQLServer:
+			exprs[i] += " COLLATE Latin1_General_BIN2"
+		case SQLite:
+			exprs[i] += " COLLATE BINARY"
+		}
+	}
+	return exprs
+}
+
+// quotedKeyList returns the primary key columns as an ORDER BY list
+func quotedKeyList(dbType DBType, primaryKeys []string) string {
+	quoted := make([]string, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		quoted[i] = quoteIdentifier(dbType, pk)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// keyValues returns a row's primary key values in key order
+func keyValues(row map[string]interface{}, primaryKeys []string) []interface{} {
+	values := make([]interface{}, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		values[i] = row[pk]
+	}
+	return values
+}
+
+// compareKeys orders two primary keys column by column, comparing numeric
+// columns by value and everything else as text
+func compareKeys(a, b []interface{}, numeric []bool) int {
+	for i := range a {
+		if cmp := compareKeyValue(a[i], b[i], numeric[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareKeyValue(a, b interface{}, numeric bool) int {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	sa, sb := fmt.Sprintf("%v", a), fmt.Sprintf("%v", b)
+	if numeric {
+		ra, okA := new(big.Rat).SetString(sa)
+		rb, okB := new(big.Rat).SetString(sb)
+		if okA && okB {
+			return ra.Cmp(rb)
+		}
+	}
+	return strings.Compare(sa, sb)
+}
+
+// isNumericType reports whether a column type reported by a driver holds
+// numbers, so its keys sort by value rather than as text
+func isNumericType(typeName string) bool {
+	t := strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED ")
+	if i := strings.IndexAny(t, "( "); i >= 0 {
+		t = t[:i]
+	}
+	switch t {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT",
+		"INT2", "INT4", "INT8", "DECIMAL", "NUMERIC", "FLOAT", "FLOAT4", "FLOAT8",
+		"DOUBLE", "REAL", "MONEY", "SMALLMONEY":
+		return true
+	}
+	return false
+}
+
+// placeholder returns the n-th (1-based) bind parameter in the engine's syntax
+func placeholder(dbType DBType, n int) string {
+	switch dbType {
+	case PostgreSQL:
+		return fmt.Sprintf("$%d", n)
+	case SQLServer:
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return "?"
+	}
+}
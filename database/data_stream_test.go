@@ -0,0 +1,63 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestKeyExprs(t *testing.T) {
+	kinds := map[string]valueKind{"id": kindInteger, "code": kindText}
+	tests := []struct {
+		dbType DBType
+		want   []string
+	}{
+		{MySQL, []string{"`id`", "CAST(`code` AS BINARY)"}},
+		{PostgreSQL, []string{`"id"`, `"code" COLLATE "C"`}},
+		{SQLServer, []string{"[id]", "[code] COLLATE Latin1_General_BIN2"}},
+		{SQLite, []string{`"id"`, `"code" COLLATE BINARY`}},
+	}
+	for _, tt := range tests {
+		if got := keyExprs(tt.dbType, []string{"id", "code"}, kinds); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keyExprs = %q, want %q", tt.dbType, got, tt.want)
+		}
+	}
+}
+
+func TestStreamMixedCaseKeys(t *testing.T) {
+	open := func(name string, codes ...string) ConnectionConfig {
+		config := ConnectionConfig{Type: SQLite, FilePath: filepath.Join(t.TempDir(), name)}
+		db, err := Connect(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		// NOCASE orders keys the way MySQL _ci collations do
+		if _, err := db.Exec("CREATE TABLE items (code TEXT COLLATE NOCASE PRIMARY KEY, qty INTEGER)"); err != nil {
+			t.Fatal(err)
+		}
+		for _, code := range codes {
+			if _, err := db.Exec("INSERT INTO items VALUES (?, 1)", code); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return config
+	}
+	source := open("source.db", "a", "B", "c", "D", "f")
+	target := open("target.db", "A", "B", "c", "e", "f")
+
+	var got []string
+	err := CompareTableDataStream(source, target, "items", "", 2, func(diff DataDiffResult) error {
+		got = append(got, diff.Type+" "+diff.PrimaryKey["code"].(string))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"delete A", "delete e", "insert D", "insert a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffs = %q, want %q", got, want)
+	}
+}
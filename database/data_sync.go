@@ -4,28 +4,81 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
 // DataSyncConfig holds sync configuration
 type DataSyncConfig struct {
-	SourceConfig ConnectionConfig `json:"sourceConfig"`
-	TargetConfig ConnectionConfig `json:"targetConfig"`
-	TableName    string           `json:"tableName"`
-	SyncInsert   bool             `json:"syncInsert"`
-	SyncUpdate   bool             `json:"syncUpdate"`
-	SyncDelete   bool             `json:"syncDelete"`
+	SourceConfig ConnectionConfig         `json:"sourceConfig"`
+	TargetConfig ConnectionConfig         `json:"targetConfig"`
+	TableName    string                   `json:"tableName"`
+	Tables       []string                 `json:"tables,omitempty"`       // several tables synced together, instead of TableName
+	TargetTables map[string]string        `json:"targetTables,omitempty"` // target table names by source table, where they differ
+	Filters      map[string]string        `json:"filters,omitempty"`      // row filter conditions by table
+	Columns      map[string]ColumnMapping `json:"columns,omitempty"`      // compared columns by table
+	Keys         map[string][]string      `json:"keys,omitempty"`         // declared key columns by table
+	SyncInsert   bool                     `json:"syncInsert"`
+	SyncUpdate   bool                     `json:"syncUpdate"`
+	SyncDelete   bool                     `json:"syncDelete"`
+	// Upsert writes inserted and updated rows with one statement that
+	// inserts the row or updates it if its key already exists, so a sync
+	// script can be re-run after a partial failure. The key must be the
+	// target's primary key or a unique index.
+	Upsert  bool               `json:"upsert"`
+	Options DataCompareOptions `json:"options"`
+	Apply   DataApplyOptions   `json:"apply"`
+}
+
+// DataCompareOptions tunes how CompareTableDataWithOptions compares a table
+type DataCompareOptions struct {
+	// Checksum compares blocks of rows by a checksum computed on each server
+	// and only reads the rows of blocks that differ. It needs both sides on
+	// the same engine; SQLite and cross-engine comparisons read every row.
+	Checksum bool `json:"checksum"`
+	// Source rows per checksum block, 0 for the default
+	BlockSize int `json:"blockSize"`
+
+	// Largest difference between two approximate numbers that still match
+	FloatEpsilon float64 `json:"floatEpsilon"`
+	// Timestamps less than one unit apart match: "s", "ms", "us", or "" to
+	// compare them exactly
+	TimestampPrecision string `json:"timestampPrecision"`
+	// Ignore trailing spaces in text, as PAD SPACE collations and CHAR do
+	IgnoreTrailingSpace bool `json:"ignoreTrailingSpace"`
+	// Match text case-insensitively, as _ci collations do
+	IgnoreCase bool `json:"ignoreCase"`
+
+	// SQL condition limiting the rows compared on both sides, such as
+	// "tenant_id = 42", naming columns as in the source; on the target they
+	// are renamed per Columns. DataSyncConfig sets it per table from
+	// Filters. It runs with the privileges of each connection; see
+	// validateFilter.
+	Filter string `json:"filter,omitempty"`
+	// Columns to compare and their target names. DataSyncConfig sets it per
+	// table from Columns.
+	Columns ColumnMapping `json:"columns"`
+	// Columns that identify a row, unique in both tables, for tables whose
+	// primary key is missing or not the one to match on. DataSyncConfig sets
+	// it per table from Keys.
+	KeyColumns []string `json:"keyColumns,omitempty"`
 }
 
 // TableDataInfo holds table data comparison info
 type TableDataInfo struct {
 	TableName    string   `json:"tableName"`
+	TargetTable  string   `json:"targetTable,omitempty"`
 	PrimaryKeys  []string `json:"primaryKeys"`
+	KeyColumns   []string `json:"keyColumns,omitempty"` // unique index used without a primary key
 	Columns      []string `json:"columns"`
 	SourceCount  int      `json:"sourceCount"`
 	TargetCount  int      `json:"targetCount"`
 	InsertCount  int      `json:"insertCount"`
 	UpdateCount  int      `json:"updateCount"`
 	DeleteCount  int      `json:"deleteCount"`
+	// The databases returned the key out of order, so every row was read
+	// and matched in memory instead of streamed
+	InMemory bool `json:"inMemory,omitempty"`
 }
 
 // DataDiffResult holds data difference details
@@ -35,7 +88,23 @@ type DataDiffResult struct {
 	PrimaryKey map[string]interface{} `json:"primaryKey"`
 	OldValues  map[string]interface{} `json:"oldValues,omitempty"`
 	NewValues  map[string]interface{} `json:"newValues,omitempty"`
-	SQL        string                 `json:"sql"`
+	SQL        string                 `json:"sql"` // literal SQL, for preview and export
+	// The same change as a parameterized statement, run by ExecuteDataDiffs
+	Statement string   `json:"statement"`
+	Args      []SQLArg `json:"args"`
+	// Columns of an insert, in Args order, so inserts can be batched
+	Columns []string `json:"columns,omitempty"`
+	// The table the statement writes to, when named differently from the
+	// source table in TableName
+	TargetTable string `json:"targetTable,omitempty"`
+}
+
+// targetTable returns the table a difference is applied to
+func (d DataDiffResult) targetTable() string {
+	if d.TargetTable != "" {
+		return d.TargetTable
+	}
+	return d.TableName
 }
 
 // GetTablesForSync returns list of tables available for data sync
@@ -51,7 +120,7 @@ func GetTablesForSync(config ConnectionConfig) ([]TableDataInfo, error) {
 		dbType = MySQL
 	}
 
-	tableNames, err := getTableNames(db, dbType, config.Database)
+	tableNames, err := getTableNames(db, dbType, config.Database, selectedSchemas(config))
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +134,13 @@ func GetTablesForSync(config ConnectionConfig) ([]TableDataInfo, error) {
 		if err != nil {
 			return nil, err
 		}
+		if len(info.PrimaryKeys) == 0 {
+			table, err := tableInfo(db, dbType, tableName)
+			if err != nil {
+				return nil, err
+			}
+			info.KeyColumns = uniqueKeyColumns(*table)
+		}
 
 		// Get columns
 		info.Columns, err = getColumns(db, dbType, config.Database, tableName)
@@ -74,7 +150,7 @@ func GetTablesForSync(config ConnectionConfig) ([]TableDataInfo, error) {
 
 		// Get row count
 		var count int
-		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(dbType, tableName))
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteTableName(dbType, tableName))
 		err = db.QueryRow(countQuery).Scan(&count)
 		if err != nil {
 			return nil, err
@@ -87,20 +163,24 @@ func GetTablesForSync(config ConnectionConfig) ([]TableDataInfo, error) {
 	return tables, nil
 }
 
-// getTableNames returns table names for the given database type
-func getTableNames(db *sql.DB, dbType DBType, database string) ([]string, error) {
+// getTableNames returns table names for the given database type, qualified
+// with their schema outside the default one
+func getTableNames(db *sql.DB, dbType DBType, database string, schemas []string) ([]string, error) {
 	var query string
 	var args []interface{}
 
 	switch dbType {
 	case MySQL, "":
-		query = "SHOW TABLES"
+		query = "SELECT '', TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = DATABASE()"
 	case PostgreSQL:
-		query = "SELECT tablename FROM pg_tables WHERE schemaname = 'public'"
+		query = "SELECT schemaname, tablename FROM pg_tables WHERE schemaname = ANY($1)"
+		args = []interface{}{pq.Array(schemas)}
 	case SQLite:
-		query = "SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'"
+		query = "SELECT '', name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'"
 	case SQLServer:
-		query = "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'"
+		var filter string
+		filter, args = sqlServerSchemaFilter(schemas, 1)
+		query = "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA " + filter
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -113,11 +193,11 @@ func getTableNames(db *sql.DB, dbType DBType, database string) ([]string, error)
 
 	var tableNames []string
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
 			return nil, err
 		}
-		tableNames = append(tableNames, name)
+		tableNames = append(tableNames, tableKey(localSchema(dbType, schema), name))
 	}
 	return tableNames, nil
 }
@@ -138,142 +218,477 @@ func quoteIdentifier(dbType DBType, name string) string {
 	}
 }
 
-// CompareTableData compares data between source and target tables
-func CompareTableData(sourceConfig, targetConfig ConnectionConfig, tableName string) ([]DataDiffResult, error) {
+// tableComparison holds both sides of a table being compared
+type tableComparison struct {
+	tableName   string
+	targetTable string
+	sourceDB    *sql.DB
+	targetDB    *sql.DB
+	sourceType  DBType
+	targetType  DBType
+	primaryKeys []string
+	columns     []string
+	options     DataCompareOptions
+	values      *valueComparer
+	// Write inserts and updates as upserts
+	upsert bool
+	// The target names of the key and columns, their kinds, and the renamed
+	// columns in both directions, which are nil when none are renamed.
+	// Rows are keyed by source names once read.
+	targetKeys    []string
+	targetColumns []string
+	targetKinds   map[string]valueKind
+	toTarget      map[string]string
+	toSource      map[string]string
+	// options.Filter with the target's column names
+	targetFilter string
+	// No key: rows are matched by all their values
+	multiset bool
+	// Set by compare when the keys came back out of order and the rows
+	// were matched in memory
+	inMemory bool
+}
+
+// openTableComparison connects to both databases and reads the table's key
+// and columns from the source, and the column types from both sides. An
+// empty targetTable means the target table has the source's name.
+func openTableComparison(sourceConfig, targetConfig ConnectionConfig, tableName, targetTable string, options DataCompareOptions) (*tableComparison, error) {
 	sourceDB, err := Connect(sourceConfig)
 	if err != nil {
 		return nil, fmt.Errorf("source connection failed: %v", err)
 	}
-	defer sourceDB.Close()
 
 	targetDB, err := Connect(targetConfig)
 	if err != nil {
+		sourceDB.Close()
 		return nil, fmt.Errorf("target connection failed: %v", err)
 	}
-	defer targetDB.Close()
 
-	sourceType := sourceConfig.Type
-	if sourceType == "" {
-		sourceType = MySQL
+	if targetTable == "" {
+		targetTable = tableName
 	}
-	targetType := targetConfig.Type
-	if targetType == "" {
-		targetType = MySQL
+	c := &tableComparison{
+		tableName:   tableName,
+		targetTable: targetTable,
+		sourceDB:    sourceDB,
+		targetDB:    targetDB,
+		sourceType:  sourceConfig.Type,
+		targetType:  targetConfig.Type,
+		options:     options,
+	}
+	if c.sourceType == "" {
+		c.sourceType = MySQL
+	}
+	if c.targetType == "" {
+		c.targetType = MySQL
+	}
+	if options.Filter != "" {
+		for _, dbType := range []DBType{c.sourceType, c.targetType} {
+			if err := validateFilter(dbType, options.Filter); err != nil {
+				c.close()
+				return nil, err
+			}
+		}
 	}
 
-	// Get primary keys
-	primaryKeys, err := getPrimaryKeys(sourceDB, sourceType, sourceConfig.Database, tableName)
+	// Get columns and the key
+	sourceColumns, err := getColumnInfo(sourceDB, c.sourceType, sourceConfig.Database, tableName)
 	if err != nil {
+		c.close()
 		return nil, err
 	}
-	if len(primaryKeys) == 0 {
-		return nil, fmt.Errorf("table %s has no primary key", tableName)
+	if err := c.resolveKey(sourceConfig.Database, sourceColumns); err != nil {
+		c.close()
+		return nil, err
 	}
-
-	// Get columns
-	columns, err := getColumns(sourceDB, sourceType, sourceConfig.Database, tableName)
+	targetColumns, err := getColumnInfo(targetDB, c.targetType, targetConfig.Database, c.targetTable)
 	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to read target columns: %v", err)
+	}
+	if err := c.mapColumns(sourceColumns, targetColumns); err != nil {
+		c.close()
 		return nil, err
 	}
+	c.targetFilter = renameFilterColumns(c.targetType, options.Filter, c.filterNames())
+	return c, nil
+}
 
-	var results []DataDiffResult
+// mapColumns picks the columns to compare per options.Columns and finds
+// each of them in the target
+func (c *tableComparison) mapColumns(sourceColumns, targetColumns []ColumnInfo) error {
+	mapping := c.options.Columns
+	selected, err := mapping.selectColumns(sourceColumns, c.primaryKeys)
+	if err != nil {
+		return err
+	}
+
+	// Target columns under their source names, for the value comparer
+	var matched []ColumnInfo
+	for _, col := range selected {
+		target, ok := findColumn(targetColumns, mapping.target(col.Name))
+		if !ok {
+			return fmt.Errorf("target has no column %s; exclude or rename it", mapping.target(col.Name))
+		}
+		c.columns = append(c.columns, col.Name)
+		c.targetColumns = append(c.targetColumns, target.Name)
+		matched = append(matched, ColumnInfo{Name: col.Name, Type: target.Type})
+		if target.Name != col.Name {
+			if c.toTarget == nil {
+				c.toTarget = make(map[string]string)
+				c.toSource = make(map[string]string)
+			}
+			c.toTarget[col.Name] = target.Name
+			c.toSource[target.Name] = col.Name
+		}
+	}
+	for _, pk := range c.primaryKeys {
+		c.targetKeys = append(c.targetKeys, c.targetName(pk))
+	}
+
+	c.values = newValueComparer(selected, matched, c.options)
+	c.targetKinds = make(map[string]valueKind)
+	for i, col := range c.columns {
+		c.targetKinds[c.targetColumns[i]] = c.values.kinds[col]
+	}
+	return nil
+}
+
+// filterNames maps the source columns a filter may name to their differing
+// target names: every renamed column, compared or not, and those the target
+// spells in another case
+func (c *tableComparison) filterNames() map[string]string {
+	names := make(map[string]string)
+	for col, name := range c.options.Columns.Rename {
+		names[col] = name
+	}
+	for col, name := range c.toTarget {
+		names[col] = name
+	}
+	return names
+}
+
+// targetName returns the target name of a source column
+func (c *tableComparison) targetName(col string) string {
+	if name, ok := c.toTarget[col]; ok {
+		return name
+	}
+	return col
+}
+
+// findColumn looks a column up by name, falling back to a case-insensitive
+// match since MySQL and SQL Server resolve names regardless of case
+func findColumn(columns []ColumnInfo, name string) (ColumnInfo, bool) {
+	for _, col := range columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	for _, col := range columns {
+		if strings.EqualFold(col.Name, name) {
+			return col, true
+		}
+	}
+	return ColumnInfo{}, false
+}
 
+func (c *tableComparison) close() {
+	c.sourceDB.Close()
+	c.targetDB.Close()
+}
+
+// compare emits every difference, streaming both tables in key order when
+// the two engines sort the keys alike and matching them in memory otherwise,
+// which it records in c.inMemory. restart is called before falling back, to
+// drop what was already emitted.
+func (c *tableComparison) compare(emit func(DataDiffResult) error, restart func()) error {
+	if c.multiset {
+		return c.compareMultiset(emit)
+	}
+	var err error
+	if c.options.Checksum {
+		err = c.compareBlocks(c.options.BlockSize, emit)
+	} else {
+		err = c.stream(dataChunkSize, emit)
+	}
+	if err == ErrKeyOrder {
+		restart()
+		c.inMemory = true
+		return c.compareInMemory(emit)
+	}
+	return err
+}
+
+// compareInMemory loads both tables and matches their rows by primary key.
+// Keys are matched by their normalized values, so a key read as text on
+// one side and as a number or timestamp on the other still matches.
+func (c *tableComparison) compareInMemory(emit func(DataDiffResult) error) error {
 	// Get source data
-	sourceData, err := getTableData(sourceDB, sourceType, tableName, columns, primaryKeys)
+	sourceData, err := c.keyedRows(c.sourceDB, c.sourceType, c.tableName, c.columns, c.options.Filter, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get source data: %v", err)
+		return fmt.Errorf("failed to get source data: %v", err)
 	}
 
 	// Get target data
-	targetData, err := getTableData(targetDB, targetType, tableName, columns, primaryKeys)
+	targetData, err := c.keyedRows(c.targetDB, c.targetType, c.targetTable, c.targetColumns, c.targetFilter, c.toSource)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get target data: %v", err)
+		return fmt.Errorf("failed to get target data: %v", err)
 	}
 
 	// Find inserts and updates
 	for pkKey, sourceRow := range sourceData {
 		if targetRow, exists := targetData[pkKey]; exists {
 			// Check for updates
-			if !rowsEqual(sourceRow, targetRow) {
-				pk := extractPrimaryKey(sourceRow, primaryKeys)
-				results = append(results, DataDiffResult{
-					Type:       "update",
-					TableName:  tableName,
-					PrimaryKey: pk,
-					OldValues:  targetRow,
-					NewValues:  sourceRow,
-					SQL:        generateUpdateSQL(targetType, tableName, sourceRow, primaryKeys),
-				})
+			if !c.values.rowsEqual(sourceRow, targetRow) {
+				if err := emit(c.updateDiff(sourceRow, targetRow)); err != nil {
+					return err
+				}
 			}
-		} else {
-			// Insert
-			pk := extractPrimaryKey(sourceRow, primaryKeys)
-			results = append(results, DataDiffResult{
-				Type:       "insert",
-				TableName:  tableName,
-				PrimaryKey: pk,
-				NewValues:  sourceRow,
-				SQL:        generateInsertSQL(targetType, tableName, sourceRow, columns),
-			})
+		} else if err := emit(c.insertDiff(sourceRow)); err != nil {
+			return err
 		}
 	}
 
 	// Find deletes
 	for pkKey, targetRow := range targetData {
 		if _, exists := sourceData[pkKey]; !exists {
-			pk := extractPrimaryKey(targetRow, primaryKeys)
-			results = append(results, DataDiffResult{
-				Type:       "delete",
-				TableName:  tableName,
-				PrimaryKey: pk,
-				OldValues:  targetRow,
-				SQL:        generateDeleteSQL(targetType, tableName, primaryKeys, pk),
-			})
+			if err := emit(c.deleteDiff(targetRow)); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	return results, nil
+// keyedRows reads the rows of one side matching that side's filter,
+// normalized and keyed by primary key
+func (c *tableComparison) keyedRows(db *sql.DB, dbType DBType, tableName string, columns []string, filter string, rename map[string]string) (map[string]map[string]interface{}, error) {
+	rows, err := getTableRows(db, dbType, tableName, columns, filter, rename)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		row = c.values.normalizeRow(row)
+		data[c.values.rowKey(c.primaryKeys, row)] = row
+	}
+	return data, nil
 }
 
-// GetDataSyncSummary returns a summary of data differences for a table
-func GetDataSyncSummary(sourceConfig, targetConfig ConnectionConfig, tableName string) (*TableDataInfo, error) {
-	diffs, err := CompareTableData(sourceConfig, targetConfig, tableName)
+func (c *tableComparison) insertDiff(sourceRow map[string]interface{}) DataDiffResult {
+	if c.upsert && !c.multiset {
+		return c.upsertDiff("insert", sourceRow, nil)
+	}
+	stmt := generateInsertSQL(c.targetType, c.targetTable, renameKeys(sourceRow, c.toTarget), c.targetColumns, c.targetKinds)
+	return DataDiffResult{
+		Type:        "insert",
+		TableName:   c.tableName,
+		TargetTable: c.targetTable,
+		PrimaryKey:  extractPrimaryKey(sourceRow, c.keyColumns()),
+		NewValues:   sourceRow,
+		SQL:         stmt.sql,
+		Statement:   stmt.template,
+		Args:        stmt.args,
+		Columns:     stmt.columns,
+	}
+}
+
+func (c *tableComparison) updateDiff(sourceRow, targetRow map[string]interface{}) DataDiffResult {
+	if c.upsert {
+		return c.upsertDiff("update", sourceRow, targetRow)
+	}
+	stmt := generateUpdateSQL(c.targetType, c.targetTable, renameKeys(sourceRow, c.toTarget), c.targetColumns, c.targetKeys, c.targetKinds)
+	return DataDiffResult{
+		Type:        "update",
+		TableName:   c.tableName,
+		TargetTable: c.targetTable,
+		PrimaryKey:  extractPrimaryKey(sourceRow, c.primaryKeys),
+		OldValues:   targetRow,
+		NewValues:   sourceRow,
+		SQL:         stmt.sql,
+		Statement:   stmt.template,
+		Args:        stmt.args,
+	}
+}
+
+// upsertDiff carries no Columns, so ExecuteDataDiffs does not batch it into
+// a plain INSERT
+func (c *tableComparison) upsertDiff(diffType string, sourceRow, targetRow map[string]interface{}) DataDiffResult {
+	stmt := generateUpsertSQL(c.targetType, c.targetTable, renameKeys(sourceRow, c.toTarget), c.targetColumns, c.targetKeys, c.targetKinds)
+	return DataDiffResult{
+		Type:        diffType,
+		TableName:   c.tableName,
+		TargetTable: c.targetTable,
+		PrimaryKey:  extractPrimaryKey(sourceRow, c.primaryKeys),
+		OldValues:   targetRow,
+		NewValues:   sourceRow,
+		SQL:         stmt.sql,
+		Statement:   stmt.template,
+		Args:        stmt.args,
+	}
+}
+
+func (c *tableComparison) deleteDiff(targetRow map[string]interface{}) DataDiffResult {
+	pk := extractPrimaryKey(targetRow, c.keyColumns())
+	var stmt dataStatement
+	if c.multiset {
+		stmt = generateDeleteRowSQL(c.targetType, c.targetTable, c.targetColumns, renameKeys(targetRow, c.toTarget), c.targetKinds)
+	} else {
+		stmt = generateDeleteSQL(c.targetType, c.targetTable, c.targetKeys, renameKeys(pk, c.toTarget), c.targetKinds)
+	}
+	return DataDiffResult{
+		Type:        "delete",
+		TableName:   c.tableName,
+		TargetTable: c.targetTable,
+		PrimaryKey:  pk,
+		OldValues:   targetRow,
+		SQL:         stmt.sql,
+		Statement:   stmt.template,
+		Args:        stmt.args,
+	}
+}
+
+// CompareTableData compares data between source and target tables. An empty
+// targetTable compares with the target table named like the source table.
+func CompareTableData(sourceConfig, targetConfig ConnectionConfig, sourceTable, targetTable string) ([]DataDiffResult, error) {
+	return CompareTableDataWithOptions(sourceConfig, targetConfig, sourceTable, targetTable, DataCompareOptions{})
+}
+
+// CompareTableDataWithOptions compares data between source and target tables
+// like CompareTableData, with the given options
+func CompareTableDataWithOptions(sourceConfig, targetConfig ConnectionConfig, sourceTable, targetTable string, options DataCompareOptions) ([]DataDiffResult, error) {
+	c, err := openTableComparison(sourceConfig, targetConfig, sourceTable, targetTable, options)
 	if err != nil {
 		return nil, err
 	}
+	defer c.close()
 
-	sourceDB, err := Connect(sourceConfig)
+	var results []DataDiffResult
+	err = c.compare(func(diff DataDiffResult) error {
+		results = append(results, diff)
+		return nil
+	}, func() {
+		results = nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer sourceDB.Close()
+	return results, nil
+}
 
-	targetDB, err := Connect(targetConfig)
+// CompareDataSync compares the tables of a sync configuration and returns
+// the differences of the kinds it enables, as upserts in upsert mode
+func CompareDataSync(config DataSyncConfig) ([]DataDiffResult, error) {
+	var results []DataDiffResult
+	for _, tableName := range config.tables() {
+		diffs, err := compareForSync(config, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %v", tableName, err)
+		}
+		results = append(results, diffs...)
+	}
+	return results, nil
+}
+
+func compareForSync(config DataSyncConfig, tableName string) ([]DataDiffResult, error) {
+	options := config.Options
+	if filter := config.Filters[tableName]; filter != "" {
+		options.Filter = filter
+	}
+	if mapping, ok := config.Columns[tableName]; ok {
+		options.Columns = mapping
+	}
+	if keys := config.Keys[tableName]; len(keys) > 0 {
+		options.KeyColumns = keys
+	}
+	c, err := openTableComparison(config.SourceConfig, config.TargetConfig, tableName, config.TargetTables[tableName], options)
 	if err != nil {
 		return nil, err
 	}
-	defer targetDB.Close()
+	defer c.close()
+	if config.Upsert && !c.multiset {
+		if err := c.checkUpsertKey(); err != nil {
+			return nil, err
+		}
+	}
+	c.upsert = config.Upsert
 
-	sourceType := sourceConfig.Type
-	if sourceType == "" {
-		sourceType = MySQL
+	var results []DataDiffResult
+	err = c.compare(func(diff DataDiffResult) error {
+		if config.enabled(diff.Type) {
+			results = append(results, diff)
+		}
+		return nil
+	}, func() {
+		results = nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	targetType := targetConfig.Type
-	if targetType == "" {
-		targetType = MySQL
+	return results, nil
+}
+
+// tables returns the tables the configuration syncs
+func (config DataSyncConfig) tables() []string {
+	if len(config.Tables) > 0 {
+		return config.Tables
 	}
+	return []string{config.TableName}
+}
 
-	info := &TableDataInfo{TableName: tableName}
+// enabled reports whether the configuration syncs differences of a type
+func (config DataSyncConfig) enabled(diffType string) bool {
+	switch diffType {
+	case "insert":
+		return config.SyncInsert
+	case "update":
+		return config.SyncUpdate
+	case "delete":
+		return config.SyncDelete
+	}
+	return false
+}
 
-	// Get primary keys
-	info.PrimaryKeys, _ = getPrimaryKeys(sourceDB, sourceType, sourceConfig.Database, tableName)
-	info.Columns, _ = getColumns(sourceDB, sourceType, sourceConfig.Database, tableName)
+// CompareTableDataStream compares data between source and target tables like
+// CompareTableData, but reads both tables in primary key order, chunkSize rows
+// at a time, and passes each difference to emit as soon as it is found, so
+// memory use depends on the chunk size rather than the table size. It stops
+// at the first error emit returns. ErrKeyOrder means the two databases sort
+// the keys differently and the differences emitted so far are incomplete.
+func CompareTableDataStream(sourceConfig, targetConfig ConnectionConfig, sourceTable, targetTable string, chunkSize int, emit func(DataDiffResult) error) error {
+	c, err := openTableComparison(sourceConfig, targetConfig, sourceTable, targetTable, DataCompareOptions{})
+	if err != nil {
+		return err
+	}
+	defer c.close()
 
-	// Get counts
-	sourceDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(sourceType, tableName))).Scan(&info.SourceCount)
-	targetDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(targetType, tableName))).Scan(&info.TargetCount)
+	return c.stream(chunkSize, emit)
+}
 
-	for _, diff := range diffs {
+// GetDataSyncSummary returns a summary of data differences for a table
+func GetDataSyncSummary(sourceConfig, targetConfig ConnectionConfig, sourceTable, targetTable string) (*TableDataInfo, error) {
+	return GetDataSyncSummaryWithOptions(sourceConfig, targetConfig, sourceTable, targetTable, DataCompareOptions{})
+}
+
+// GetDataSyncSummaryWithOptions returns a summary like GetDataSyncSummary,
+// counting only the rows that match options.Filter
+func GetDataSyncSummaryWithOptions(sourceConfig, targetConfig ConnectionConfig, sourceTable, targetTable string, options DataCompareOptions) (*TableDataInfo, error) {
+	c, err := openTableComparison(sourceConfig, targetConfig, sourceTable, targetTable, options)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	info := &TableDataInfo{
+		TableName:   sourceTable,
+		PrimaryKeys: c.primaryKeys,
+		Columns:     c.columns,
+	}
+	if c.targetTable != sourceTable {
+		info.TargetTable = c.targetTable
+	}
+
+	err = c.compare(func(diff DataDiffResult) error {
 		switch diff.Type {
 		case "insert":
 			info.InsertCount++
@@ -282,6 +697,21 @@ func GetDataSyncSummary(sourceConfig, targetConfig ConnectionConfig, tableName s
 		case "delete":
 			info.DeleteCount++
 		}
+		return nil
+	}, func() {
+		info.InsertCount, info.UpdateCount, info.DeleteCount = 0, 0, 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.InMemory = c.inMemory
+
+	// Get counts
+	if err := c.sourceDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteTableName(c.sourceType, c.tableName), withFilter("", options.Filter))).Scan(&info.SourceCount); err != nil {
+		return nil, fmt.Errorf("failed to count source rows: %v", err)
+	}
+	if err := c.targetDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteTableName(c.targetType, c.targetTable), withFilter("", c.targetFilter))).Scan(&info.TargetCount); err != nil {
+		return nil, fmt.Errorf("failed to count target rows: %v", err)
 	}
 
 	return info, nil
@@ -307,7 +737,7 @@ func getPrimaryKeys(db *sql.DB, dbType DBType, database, tableName string) ([]st
 			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
 			WHERE i.indrelid = $1::regclass AND i.indisprimary
 			ORDER BY array_position(i.indkey, a.attnum)`
-		args = []interface{}{tableName}
+		args = []interface{}{quoteTableName(dbType, tableName)}
 	case SQLite:
 		// SQLite uses PRAGMA, handled separately
 		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info('%s')", tableName))
@@ -334,10 +764,12 @@ func getPrimaryKeys(db *sql.DB, dbType DBType, database, tableName string) ([]st
 		query = `
 			SELECT c.COLUMN_NAME
 			FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
-			JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE c ON tc.CONSTRAINT_NAME = c.CONSTRAINT_NAME
-			WHERE tc.TABLE_NAME = @p1 AND tc.CONSTRAINT_TYPE = 'PRIMARY KEY'
+			JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE c
+				ON tc.CONSTRAINT_SCHEMA = c.CONSTRAINT_SCHEMA AND tc.CONSTRAINT_NAME = c.CONSTRAINT_NAME
+			WHERE tc.TABLE_SCHEMA = @p1 AND tc.TABLE_NAME = @p2 AND tc.CONSTRAINT_TYPE = 'PRIMARY KEY'
 			ORDER BY c.ORDINAL_POSITION`
-		args = []interface{}{tableName}
+		schema, name := splitTableKey(dbType, tableName)
+		args = []interface{}{schemaOrDefault(dbType, schema), name}
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -360,24 +792,39 @@ func getPrimaryKeys(db *sql.DB, dbType DBType, database, tableName string) ([]st
 }
 
 func getColumns(db *sql.DB, dbType DBType, database, tableName string) ([]string, error) {
+	columns, err := getColumnInfo(db, dbType, database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names, nil
+}
+
+// getColumnInfo returns the name and type of each column, in table order
+func getColumnInfo(db *sql.DB, dbType DBType, database, tableName string) ([]ColumnInfo, error) {
 	var query string
 	var args []interface{}
 
 	switch dbType {
 	case MySQL, "":
+		// COLUMN_TYPE keeps tinyint(1), which MySQL uses for booleans
 		query = `
-			SELECT COLUMN_NAME
+			SELECT COLUMN_NAME, COLUMN_TYPE
 			FROM INFORMATION_SCHEMA.COLUMNS
 			WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
 			ORDER BY ORDINAL_POSITION`
 		args = []interface{}{database, tableName}
 	case PostgreSQL:
 		query = `
-			SELECT column_name
+			SELECT column_name, data_type
 			FROM information_schema.columns
-			WHERE table_schema = 'public' AND table_name = $1
+			WHERE table_schema = $1 AND table_name = $2
 			ORDER BY ordinal_position`
-		args = []interface{}{tableName}
+		schema, name := splitTableKey(dbType, tableName)
+		args = []interface{}{schemaOrDefault(dbType, schema), name}
 	case SQLite:
 		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info('%s')", tableName))
 		if err != nil {
@@ -385,7 +832,7 @@ func getColumns(db *sql.DB, dbType DBType, database, tableName string) ([]string
 		}
 		defer rows.Close()
 
-		var cols []string
+		var cols []ColumnInfo
 		for rows.Next() {
 			var cid int
 			var name, colType string
@@ -394,16 +841,17 @@ func getColumns(db *sql.DB, dbType DBType, database, tableName string) ([]string
 			if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
 				return nil, err
 			}
-			cols = append(cols, name)
+			cols = append(cols, ColumnInfo{Name: name, Type: colType, Position: cid + 1})
 		}
 		return cols, nil
 	case SQLServer:
 		query = `
-			SELECT COLUMN_NAME
+			SELECT COLUMN_NAME, DATA_TYPE
 			FROM INFORMATION_SCHEMA.COLUMNS
-			WHERE TABLE_NAME = @p1
+			WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2
 			ORDER BY ORDINAL_POSITION`
-		args = []interface{}{tableName}
+		schema, name := splitTableKey(dbType, tableName)
+		args = []interface{}{schemaOrDefault(dbType, schema), name}
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -414,75 +862,40 @@ func getColumns(db *sql.DB, dbType DBType, database, tableName string) ([]string
 	}
 	defer rows.Close()
 
-	var cols []string
+	var cols []ColumnInfo
 	for rows.Next() {
-		var col string
-		if err := rows.Scan(&col); err != nil {
+		var col ColumnInfo
+		if err := rows.Scan(&col.Name, &col.Type); err != nil {
 			return nil, err
 		}
+		col.Position = len(cols) + 1
 		cols = append(cols, col)
 	}
 	return cols, nil
 }
 
-func getTableData(db *sql.DB, dbType DBType, tableName string, columns, primaryKeys []string) (map[string]map[string]interface{}, error) {
-	quotedCols := make([]string, len(columns))
-	for i, col := range columns {
-		quotedCols[i] = quoteIdentifier(dbType, col)
+// scanRow reads the current row into a map keyed by column name
+func scanRow(rows *sql.Rows, columns []string) (map[string]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
 	}
 
-	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quotedCols, ", "), quoteIdentifier(dbType, tableName))
-	rows, err := db.Query(query)
-	if err != nil {
+	if err := rows.Scan(valuePtrs...); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	data := make(map[string]map[string]interface{})
-
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
-		}
-
-		row := make(map[string]interface{})
-		var pkParts []string
-		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
-		}
-
-		// Build primary key string
-		for _, pk := range primaryKeys {
-			pkParts = append(pkParts, fmt.Sprintf("%v", row[pk]))
-		}
-		pkKey := strings.Join(pkParts, "|")
-		data[pkKey] = row
-	}
 
-	return data, nil
-}
-
-func rowsEqual(a, b map[string]interface{}) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for k, v := range a {
-		if fmt.Sprintf("%v", v) != fmt.Sprintf("%v", b[k]) {
-			return false
+	row := make(map[string]interface{})
+	for i, col := range columns {
+		val := values[i]
+		if b, ok := val.([]byte); ok {
+			row[col] = string(b)
+		} else {
+			row[col] = val
 		}
 	}
-	return true
+	return row, nil
 }
 
 func extractPrimaryKey(row map[string]interface{}, primaryKeys []string) map[string]interface{} {
@@ -493,73 +906,77 @@ func extractPrimaryKey(row map[string]interface{}, primaryKeys []string) map[str
 	return pk
 }
 
-func generateInsertSQL(dbType DBType, tableName string, row map[string]interface{}, columns []string) string {
+func generateInsertSQL(dbType DBType, tableName string, row map[string]interface{}, columns []string, kinds map[string]valueKind) dataStatement {
 	var cols []string
-	var vals []string
-
 	for _, col := range columns {
-		if val, ok := row[col]; ok {
-			cols = append(cols, quoteIdentifier(dbType, col))
-			vals = append(vals, escapeValue(val))
+		if _, ok := row[col]; ok {
+			cols = append(cols, col)
 		}
 	}
 
-	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
-		quoteIdentifier(dbType, tableName),
-		strings.Join(cols, ", "),
-		strings.Join(vals, ", "))
+	b := newStatementBuilder(dbType)
+	b.sql(fmt.Sprintf("INSERT INTO %s (%s) VALUES (", quoteTableName(dbType, tableName), quotedColumnList(dbType, cols)))
+	for i, col := range cols {
+		if i > 0 {
+			b.sql(", ")
+		}
+		b.value(row[col], kinds[col])
+	}
+	b.sql(")")
+	stmt := b.statement()
+	stmt.columns = cols
+	return stmt
 }
 
-func generateUpdateSQL(dbType DBType, tableName string, row map[string]interface{}, primaryKeys []string) string {
-	var sets []string
-	var wheres []string
+func generateUpdateSQL(dbType DBType, tableName string, row map[string]interface{}, columns, primaryKeys []string, kinds map[string]valueKind) dataStatement {
+	isPK := make(map[string]bool)
+	for _, pk := range primaryKeys {
+		isPK[pk] = true
+	}
 
-	for col, val := range row {
-		isPK := false
-		for _, pk := range primaryKeys {
-			if col == pk {
-				isPK = true
-				break
-			}
+	b := newStatementBuilder(dbType)
+	b.sql(fmt.Sprintf("UPDATE %s SET ", quoteTableName(dbType, tableName)))
+	first := true
+	for _, col := range columns {
+		val, ok := row[col]
+		if !ok || isPK[col] {
+			continue
 		}
-		if !isPK {
-			sets = append(sets, fmt.Sprintf("%s = %s", quoteIdentifier(dbType, col), escapeValue(val)))
+		if !first {
+			b.sql(", ")
 		}
+		first = false
+		b.sql(quoteIdentifier(dbType, col) + " = ")
+		b.value(val, kinds[col])
 	}
+	writeKeyCondition(b, primaryKeys, row, kinds)
+	return b.statement()
+}
 
-	for _, pk := range primaryKeys {
-		wheres = append(wheres, fmt.Sprintf("%s = %s", quoteIdentifier(dbType, pk), escapeValue(row[pk])))
-	}
-
-	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
-		quoteIdentifier(dbType, tableName),
-		strings.Join(sets, ", "),
-		strings.Join(wheres, " AND "))
+func generateDeleteSQL(dbType DBType, tableName string, primaryKeys []string, pk map[string]interface{}, kinds map[string]valueKind) dataStatement {
+	b := newStatementBuilder(dbType)
+	b.sql(fmt.Sprintf("DELETE FROM %s", quoteTableName(dbType, tableName)))
+	writeKeyCondition(b, primaryKeys, pk, kinds)
+	return b.statement()
 }
 
-func generateDeleteSQL(dbType DBType, tableName string, primaryKeys []string, pk map[string]interface{}) string {
-	var wheres []string
-	for _, key := range primaryKeys {
-		wheres = append(wheres, fmt.Sprintf("%s = %s", quoteIdentifier(dbType, key), escapeValue(pk[key])))
+// writeKeyCondition appends a WHERE clause matching a row by primary key
+func writeKeyCondition(b *statementBuilder, primaryKeys []string, row map[string]interface{}, kinds map[string]valueKind) {
+	b.sql(" WHERE ")
+	for i, key := range primaryKeys {
+		if i > 0 {
+			b.sql(" AND ")
+		}
+		b.sql(quoteIdentifier(b.dbType, key) + " = ")
+		b.value(row[key], kinds[key])
 	}
-	return fmt.Sprintf("DELETE FROM %s WHERE %s;", quoteIdentifier(dbType, tableName), strings.Join(wheres, " AND "))
 }
 
-func escapeValue(val interface{}) string {
-	if val == nil {
-		return "NULL"
-	}
-	switch v := val.(type) {
-	case int, int32, int64, float32, float64:
-		return fmt.Sprintf("%v", v)
-	case bool:
-		if v {
-			return "1"
-		}
-		return "0"
-	default:
-		s := fmt.Sprintf("%v", v)
-		s = strings.ReplaceAll(s, "'", "''")
-		return fmt.Sprintf("'%s'", s)
+// quotedColumnList quotes columns for a column list
+func quotedColumnList(dbType DBType, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(dbType, col)
 	}
+	return strings.Join(quoted, ", ")
 }
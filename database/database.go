@@ -10,7 +10,7 @@ import (
 
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -34,14 +34,22 @@ type ConnectionConfig struct {
 	Database string `json:"database"`
 	// SQLite specific
 	FilePath string `json:"filePath,omitempty"`
+	// PostgreSQL/SQL Server schemas to read; defaults to public/dbo
+	Schemas []string `json:"schemas,omitempty"`
+	// Encryption of MySQL, PostgreSQL and SQL Server connections
+	TLS TLSConfig `json:"tls"`
+	// SSH tunnel to reach MySQL, PostgreSQL and SQL Server servers through
+	SSH SSHConfig `json:"ssh"`
 }
 
 // TableInfo holds table structure information
 type TableInfo struct {
-	Name      string       `json:"name"`
-	CreateSQL string       `json:"createSql"`
-	Columns   []ColumnInfo `json:"columns"`
-	Indexes   []IndexInfo  `json:"indexes"`
+	Name        string           `json:"name"`
+	Schema      string           `json:"schema,omitempty"` // empty for the default schema
+	CreateSQL   string           `json:"createSql"`
+	Columns     []ColumnInfo     `json:"columns"`
+	Indexes     []IndexInfo      `json:"indexes"`
+	ForeignKeys []ForeignKeyInfo `json:"foreignKeys"`
 }
 
 // ColumnInfo holds column details
@@ -55,26 +63,49 @@ type ColumnInfo struct {
 	Position int     `json:"position"`
 }
 
-// IndexInfo holds index details
+// IndexInfo holds index details, one entry per indexed column
 type IndexInfo struct {
 	Name      string `json:"name"`
 	NonUnique int    `json:"nonUnique"`
 	Column    string `json:"column"`
 	SeqInIdx  int    `json:"seqInIndex"`
+	Primary   bool   `json:"primary"`
+	// Backs a UNIQUE or PRIMARY KEY constraint, which owns it and must be
+	// dropped in its place
+	Constraint bool `json:"constraint,omitempty"`
+	// Condition of a SQL Server filtered index
+	Filter string `json:"filter,omitempty"`
+	// Native CREATE INDEX statement, when the engine exposes one
+	Definition string `json:"definition,omitempty"`
+}
+
+// isPartialIndex reports whether an index covers only the rows matching a
+// condition, given as a filter or in its definition
+func isPartialIndex(filter, definition string) bool {
+	return filter != "" || strings.Contains(strings.ToUpper(definition), " WHERE ")
 }
 
 // SchemaInfo holds complete database schema
 type SchemaInfo struct {
-	Database string               `json:"database"`
-	Tables   map[string]TableInfo `json:"tables"`
+	Database string                 `json:"database"`
+	Type     DBType                 `json:"type"`
+	Schemas  []string               `json:"schemas,omitempty"`
+	Tables   map[string]TableInfo   `json:"tables"`
+	Views    map[string]ViewInfo    `json:"views"`
+	Triggers map[string]TriggerInfo `json:"triggers"`
+	Routines map[string]RoutineInfo `json:"routines"`
 }
 
 // DiffResult holds comparison result
 type DiffResult struct {
-	Type      string `json:"type"` // "added", "removed", "modified"
-	TableName string `json:"tableName"`
-	Detail    string `json:"detail"`
-	SQL       string `json:"sql"`
+	Type       string `json:"type"` // "added", "removed", "modified"
+	TableName  string `json:"tableName"`
+	ObjectType string `json:"objectType"` // "table", "column", "index", "foreignKey", "view", "trigger", "routine"
+	Action     string `json:"action"`     // "create", "drop", "alter"
+	Detail     string `json:"detail"`
+	SQL        string `json:"sql"`
+	// Lossy type changes of a table created on a different engine
+	Conversions []TypeConversion `json:"conversions,omitempty"`
 }
 
 // buildDSN builds the connection string for the given database type
@@ -83,12 +114,21 @@ func buildDSN(config ConnectionConfig) (string, string, error) {
 	case MySQL, "":
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true",
 			config.User, config.Password, config.Host, config.Port, config.Database)
-		return "mysql", dsn, nil
+		tlsParams, err := mysqlTLSParams(config)
+		if err != nil {
+			return "", "", err
+		}
+		return "mysql", dsn + tlsParams, nil
 
 	case PostgreSQL:
-		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			config.Host, config.Port, config.User, config.Password, config.Database)
-		return "postgres", dsn, nil
+		tlsParams, err := postgresTLSParams(config.TLS)
+		if err != nil {
+			return "", "", err
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
+			postgresDSNValue(config.Host), config.Port, postgresDSNValue(config.User),
+			postgresDSNValue(config.Password), postgresDSNValue(config.Database))
+		return "postgres", dsn + tlsParams, nil
 
 	case SQLite:
 		if config.FilePath == "" {
@@ -97,9 +137,13 @@ func buildDSN(config ConnectionConfig) (string, string, error) {
 		return "sqlite3", config.FilePath, nil
 
 	case SQLServer:
+		tlsParams, err := sqlServerTLSParams(config.TLS)
+		if err != nil {
+			return "", "", err
+		}
 		dsn := fmt.Sprintf("server=%s;port=%d;user id=%s;password=%s;database=%s",
 			config.Host, config.Port, config.User, config.Password, config.Database)
-		return "sqlserver", dsn, nil
+		return "sqlserver", dsn + tlsParams, nil
 
 	default:
 		return "", "", fmt.Errorf("unsupported database type: %s", config.Type)
@@ -108,12 +152,39 @@ func buildDSN(config ConnectionConfig) (string, string, error) {
 
 // Connect creates a database connection
 func Connect(config ConnectionConfig) (*sql.DB, error) {
-	driver, dsn, err := buildDSN(config)
+	config, err := resolveReferences(config)
+	if err != nil {
+		return nil, err
+	}
+	return connect(config)
+}
+
+// connect opens a connection once references are resolved
+func connect(config ConnectionConfig) (*sql.DB, error) {
+	dialConfig := config
+	var tunnel *sshTunnel
+	if config.SSH.Enabled() {
+		var err error
+		tunnel, dialConfig, err = startTunnel(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	driver, dsn, err := buildDSN(dialConfig)
 	if err != nil {
+		if tunnel != nil {
+			tunnel.Close()
+		}
 		return nil, err
 	}
 
-	db, err := sql.Open(driver, dsn)
+	var db *sql.DB
+	if tunnel != nil {
+		db, err = openTunnelDB(driver, dsn, tunnel)
+	} else {
+		db, err = sql.Open(driver, dsn)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -122,6 +193,13 @@ func Connect(config ConnectionConfig) (*sql.DB, error) {
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
+		// Also closes the tunnel
+		db.Close()
+		// lib/pq has no prefer mode, so it is tried as require first
+		if err == pq.ErrSSLNotSupported && config.TLS.Mode == TLSPrefer {
+			config.TLS = TLSConfig{Mode: TLSDisable}
+			return connect(config)
+		}
 		return nil, err
 	}
 
@@ -159,10 +237,7 @@ func getMySQLDatabases(config ConnectionConfig) ([]string, error) {
 	cfg := config
 	cfg.Database = ""
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port)
-
-	db, err := sql.Open("mysql", dsn)
+	db, err := Connect(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -271,10 +346,15 @@ func getMySQLSchema(config ConnectionConfig) (*SchemaInfo, error) {
 
 	schema := &SchemaInfo{
 		Database: config.Database,
+		Type:     MySQL,
 		Tables:   make(map[string]TableInfo),
+		Views:    make(map[string]ViewInfo),
+		Triggers: make(map[string]TriggerInfo),
+		Routines: make(map[string]RoutineInfo),
 	}
 
-	rows, err := db.Query("SHOW TABLES")
+	// Views are collected separately with the other schema objects
+	rows, err := db.Query("SHOW FULL TABLES WHERE Table_type = 'BASE TABLE'")
 	if err != nil {
 		return nil, err
 	}
@@ -282,8 +362,8 @@ func getMySQLSchema(config ConnectionConfig) (*SchemaInfo, error) {
 
 	var tableNames []string
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		var name, tableType string
+		if err := rows.Scan(&name, &tableType); err != nil {
 			return nil, err
 		}
 		tableNames = append(tableNames, name)
@@ -297,6 +377,11 @@ func getMySQLSchema(config ConnectionConfig) (*SchemaInfo, error) {
 		schema.Tables[tableName] = *tableInfo
 	}
 
+	if err := getMySQLSchemaObjects(db, schema); err != nil {
+		return nil, err
+	}
+	resolveViewDependencies(schema)
+
 	return schema, nil
 }
 
@@ -357,6 +442,7 @@ func getMySQLTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 			case "Key_name":
 				if v, ok := val.([]byte); ok {
 					idx.Name = string(v)
+					idx.Primary = idx.Name == "PRIMARY"
 				}
 			case "Non_unique":
 				if v, ok := val.(int64); ok {
@@ -375,6 +461,11 @@ func getMySQLTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 		info.Indexes = append(info.Indexes, idx)
 	}
 
+	info.ForeignKeys, err = getMySQLForeignKeys(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
 	return info, nil
 }
 
@@ -387,48 +478,54 @@ func getPostgreSQLSchema(config ConnectionConfig) (*SchemaInfo, error) {
 
 	schema := &SchemaInfo{
 		Database: config.Database,
+		Type:     PostgreSQL,
+		Schemas:  selectedSchemas(config),
 		Tables:   make(map[string]TableInfo),
+		Views:    make(map[string]ViewInfo),
+		Triggers: make(map[string]TriggerInfo),
+		Routines: make(map[string]RoutineInfo),
 	}
 
-	rows, err := db.Query(`
-		SELECT tablename FROM pg_tables
-		WHERE schemaname = 'public'`)
+	filter, args := postgresSchemaFilter(schema.Schemas, 1)
+	tables, err := queryStrings(db, `
+		SELECT schemaname, tablename FROM pg_tables
+		WHERE schemaname `+filter, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var tableNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+	for _, row := range tables {
+		tableInfo, err := getPostgreSQLTableInfo(db, localSchema(PostgreSQL, row[0]), row[1])
+		if err != nil {
 			return nil, err
 		}
-		tableNames = append(tableNames, name)
+		schema.Tables[tableKey(tableInfo.Schema, tableInfo.Name)] = *tableInfo
 	}
 
-	for _, tableName := range tableNames {
-		tableInfo, err := getPostgreSQLTableInfo(db, tableName)
-		if err != nil {
-			return nil, err
-		}
-		schema.Tables[tableName] = *tableInfo
+	if err := getPostgreSQLSchemaObjects(db, schema); err != nil {
+		return nil, err
 	}
+	resolveViewDependencies(schema)
 
 	return schema, nil
 }
 
-func getPostgreSQLTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
+func getPostgreSQLTableInfo(db *sql.DB, schema, tableName string) (*TableInfo, error) {
 	info := &TableInfo{
-		Name: tableName,
+		Name:   tableName,
+		Schema: schema,
 	}
+	namespace := schemaOrDefault(PostgreSQL, schema)
 
 	// PostgreSQL doesn't have SHOW CREATE TABLE, we need to build it
+	// format_type keeps length/precision modifiers that data_type drops
 	colRows, err := db.Query(`
-		SELECT column_name, data_type, is_nullable, column_default, ordinal_position
-		FROM information_schema.columns
-		WHERE table_schema = 'public' AND table_name = $1
-		ORDER BY ordinal_position`, tableName)
+		SELECT c.column_name, format_type(a.atttypid, a.atttypmod), c.is_nullable, c.column_default, c.ordinal_position
+		FROM information_schema.columns c
+		JOIN pg_attribute a ON a.attrelid = format('%I.%I', c.table_schema, c.table_name)::regclass
+			AND a.attname = c.column_name
+		WHERE c.table_schema = $1 AND c.table_name = $2
+		ORDER BY c.ordinal_position`, namespace, tableName)
 	if err != nil {
 		return nil, err
 	}
@@ -457,27 +554,41 @@ func getPostgreSQLTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 		createParts = append(createParts, colDef)
 	}
 
-	info.CreateSQL = fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", tableName, strings.Join(createParts, ",\n  "))
+	info.CreateSQL = fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", qualifiedName(PostgreSQL, schema, tableName), strings.Join(createParts, ",\n  "))
 
-	// Get indexes
+	// Get indexes, one row per key column
 	idxRows, err := db.Query(`
-		SELECT indexname, indexdef
-		FROM pg_indexes
-		WHERE schemaname = 'public' AND tablename = $1`, tableName)
+		SELECT ic.relname, ix.indisunique, ix.indisprimary,
+			EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = ix.indexrelid
+				AND con.conrelid = ix.indrelid AND con.contype IN ('p', 'u', 'x')),
+			k.n, pg_get_indexdef(ix.indexrelid, k.n, true), pg_get_indexdef(ix.indexrelid)
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class ic ON ic.oid = ix.indexrelid
+		JOIN pg_namespace ns ON ns.oid = t.relnamespace
+		CROSS JOIN LATERAL generate_series(1, ix.indnkeyatts) AS k(n)
+		WHERE ns.nspname = $1 AND t.relname = $2
+		ORDER BY ic.relname, k.n`, namespace, tableName)
 	if err != nil {
 		return nil, err
 	}
 	defer idxRows.Close()
 
 	for idxRows.Next() {
-		var idxName, idxDef string
-		if err := idxRows.Scan(&idxName, &idxDef); err != nil {
+		var idx IndexInfo
+		var isUnique bool
+		if err := idxRows.Scan(&idx.Name, &isUnique, &idx.Primary, &idx.Constraint, &idx.SeqInIdx, &idx.Column, &idx.Definition); err != nil {
 			return nil, err
 		}
-		info.Indexes = append(info.Indexes, IndexInfo{
-			Name:   idxName,
-			Column: idxDef,
-		})
+		if !isUnique {
+			idx.NonUnique = 1
+		}
+		info.Indexes = append(info.Indexes, idx)
+	}
+
+	info.ForeignKeys, err = getPostgreSQLForeignKeys(db, namespace, tableName)
+	if err != nil {
+		return nil, err
 	}
 
 	return info, nil
@@ -492,7 +603,11 @@ func getSQLiteSchema(config ConnectionConfig) (*SchemaInfo, error) {
 
 	schema := &SchemaInfo{
 		Database: "main",
+		Type:     SQLite,
 		Tables:   make(map[string]TableInfo),
+		Views:    make(map[string]ViewInfo),
+		Triggers: make(map[string]TriggerInfo),
+		Routines: make(map[string]RoutineInfo),
 	}
 
 	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'")
@@ -518,6 +633,11 @@ func getSQLiteSchema(config ConnectionConfig) (*SchemaInfo, error) {
 		schema.Tables[tableName] = *tableInfo
 	}
 
+	if err := getSQLiteSchemaObjects(db, schema); err != nil {
+		return nil, err
+	}
+	resolveViewDependencies(schema)
+
 	return schema, nil
 }
 
@@ -564,7 +684,7 @@ func getSQLiteTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 		if dfltValue.Valid {
 			col.Default = &dfltValue.String
 		}
-		if pk == 1 {
+		if pk > 0 {
 			col.Key = "PRI"
 		}
 		info.Columns = append(info.Columns, col)
@@ -577,6 +697,7 @@ func getSQLiteTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 	}
 	defer idxRows.Close()
 
+	var indexes []IndexInfo
 	for idxRows.Next() {
 		var seq int
 		var name string
@@ -585,11 +706,46 @@ func getSQLiteTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 		if err := idxRows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
 			return nil, err
 		}
-		info.Indexes = append(info.Indexes, IndexInfo{
+		indexes = append(indexes, IndexInfo{
 			Name:      name,
 			NonUnique: 1 - unique,
+			Primary:   origin == "pk",
 		})
 	}
+	idxRows.Close()
+
+	// Expand each index into its columns; auto-indexes have no stored SQL
+	for _, idx := range indexes {
+		var def sql.NullString
+		err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type='index' AND name=?", idx.Name).Scan(&def)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		idx.Definition = def.String
+
+		colRows, err := db.Query(fmt.Sprintf("PRAGMA index_info('%s')", idx.Name))
+		if err != nil {
+			return nil, err
+		}
+		for colRows.Next() {
+			var seqNo, cid int
+			var colName sql.NullString
+			if err := colRows.Scan(&seqNo, &cid, &colName); err != nil {
+				colRows.Close()
+				return nil, err
+			}
+			col := idx
+			col.Column = colName.String
+			col.SeqInIdx = seqNo + 1
+			info.Indexes = append(info.Indexes, col)
+		}
+		colRows.Close()
+	}
+
+	info.ForeignKeys, err = getSQLiteForeignKeys(db, tableName)
+	if err != nil {
+		return nil, err
+	}
 
 	return info, nil
 }
@@ -603,46 +759,53 @@ func getSQLServerSchema(config ConnectionConfig) (*SchemaInfo, error) {
 
 	schema := &SchemaInfo{
 		Database: config.Database,
+		Type:     SQLServer,
+		Schemas:  selectedSchemas(config),
 		Tables:   make(map[string]TableInfo),
+		Views:    make(map[string]ViewInfo),
+		Triggers: make(map[string]TriggerInfo),
+		Routines: make(map[string]RoutineInfo),
 	}
 
-	rows, err := db.Query("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'")
+	filter, args := sqlServerSchemaFilter(schema.Schemas, 1)
+	tables, err := queryStrings(db, `
+		SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA `+filter, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var tableNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+	for _, row := range tables {
+		tableInfo, err := getSQLServerTableInfo(db, localSchema(SQLServer, row[0]), row[1])
+		if err != nil {
 			return nil, err
 		}
-		tableNames = append(tableNames, name)
+		schema.Tables[tableKey(tableInfo.Schema, tableInfo.Name)] = *tableInfo
 	}
 
-	for _, tableName := range tableNames {
-		tableInfo, err := getSQLServerTableInfo(db, tableName)
-		if err != nil {
-			return nil, err
-		}
-		schema.Tables[tableName] = *tableInfo
+	if err := getSQLServerSchemaObjects(db, schema); err != nil {
+		return nil, err
 	}
+	resolveViewDependencies(schema)
 
 	return schema, nil
 }
 
-func getSQLServerTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
+func getSQLServerTableInfo(db *sql.DB, schema, tableName string) (*TableInfo, error) {
 	info := &TableInfo{
-		Name: tableName,
+		Name:   tableName,
+		Schema: schema,
 	}
+	namespace := schemaOrDefault(SQLServer, schema)
 
 	// Get columns
 	colRows, err := db.Query(`
-		SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE, COLUMN_DEFAULT, ORDINAL_POSITION
+		SELECT COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE,
+			IS_NULLABLE, COLUMN_DEFAULT, ORDINAL_POSITION,
+			COLUMNPROPERTY(OBJECT_ID(QUOTENAME(TABLE_SCHEMA) + '.' + QUOTENAME(TABLE_NAME)), COLUMN_NAME, 'IsIdentity')
 		FROM INFORMATION_SCHEMA.COLUMNS
-		WHERE TABLE_NAME = @p1
-		ORDER BY ORDINAL_POSITION`, tableName)
+		WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2
+		ORDER BY ORDINAL_POSITION`, namespace, tableName)
 	if err != nil {
 		return nil, err
 	}
@@ -651,16 +814,26 @@ func getSQLServerTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 	var createParts []string
 	for colRows.Next() {
 		var col ColumnInfo
+		var dataType string
+		var charLen, precision, scale, isIdentity sql.NullInt64
 		var colDefault sql.NullString
-		if err := colRows.Scan(&col.Name, &col.Type, &col.Nullable, &colDefault, &col.Position); err != nil {
+		if err := colRows.Scan(&col.Name, &dataType, &charLen, &precision, &scale,
+			&col.Nullable, &colDefault, &col.Position, &isIdentity); err != nil {
 			return nil, err
 		}
+		col.Type = sqlServerColumnType(dataType, charLen, precision, scale)
 		if colDefault.Valid {
 			col.Default = &colDefault.String
 		}
+		if isIdentity.Int64 == 1 {
+			col.Extra = "IDENTITY"
+		}
 		info.Columns = append(info.Columns, col)
 
 		colDef := fmt.Sprintf("[%s] %s", col.Name, col.Type)
+		if col.Extra != "" {
+			colDef += " IDENTITY(1,1)"
+		}
 		if col.Nullable == "NO" {
 			colDef += " NOT NULL"
 		}
@@ -670,15 +843,17 @@ func getSQLServerTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 		createParts = append(createParts, colDef)
 	}
 
-	info.CreateSQL = fmt.Sprintf("CREATE TABLE [%s] (\n  %s\n);", tableName, strings.Join(createParts, ",\n  "))
+	info.CreateSQL = fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", qualifiedName(SQLServer, schema, tableName), strings.Join(createParts, ",\n  "))
 
 	// Get indexes
 	idxRows, err := db.Query(`
-		SELECT i.name, c.name as column_name, i.is_unique
+		SELECT i.name, c.name as column_name, i.is_unique, i.is_primary_key, i.is_unique_constraint,
+			i.filter_definition, ic.key_ordinal
 		FROM sys.indexes i
 		JOIN sys.index_columns ic ON i.object_id = ic.object_id AND i.index_id = ic.index_id
 		JOIN sys.columns c ON ic.object_id = c.object_id AND ic.column_id = c.column_id
-		WHERE i.object_id = OBJECT_ID(@p1) AND i.name IS NOT NULL`, tableName)
+		WHERE i.object_id = OBJECT_ID(QUOTENAME(@p1) + '.' + QUOTENAME(@p2)) AND i.name IS NOT NULL AND ic.key_ordinal > 0
+		ORDER BY i.name, ic.key_ordinal`, namespace, tableName)
 	if err != nil {
 		return nil, err
 	}
@@ -686,8 +861,10 @@ func getSQLServerTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 
 	for idxRows.Next() {
 		var idxName, colName string
-		var isUnique bool
-		if err := idxRows.Scan(&idxName, &colName, &isUnique); err != nil {
+		var isUnique, isPrimary, isConstraint bool
+		var filter sql.NullString
+		var ordinal int
+		if err := idxRows.Scan(&idxName, &colName, &isUnique, &isPrimary, &isConstraint, &filter, &ordinal); err != nil {
 			return nil, err
 		}
 		nonUnique := 1
@@ -695,53 +872,84 @@ func getSQLServerTableInfo(db *sql.DB, tableName string) (*TableInfo, error) {
 			nonUnique = 0
 		}
 		info.Indexes = append(info.Indexes, IndexInfo{
-			Name:      idxName,
-			Column:    colName,
-			NonUnique: nonUnique,
+			Name:       idxName,
+			Column:     colName,
+			NonUnique:  nonUnique,
+			SeqInIdx:   ordinal,
+			Primary:    isPrimary,
+			Constraint: isPrimary || isConstraint,
+			Filter:     filter.String,
 		})
 	}
 
+	info.ForeignKeys, err = getSQLServerForeignKeys(db, namespace, tableName)
+	if err != nil {
+		return nil, err
+	}
+
 	return info, nil
 }
 
-// CompareSchemas compares two schemas and returns differences
+// sqlServerColumnType rebuilds a full type such as nvarchar(50) or decimal(10,2)
+// from the parts INFORMATION_SCHEMA.COLUMNS reports separately
+func sqlServerColumnType(dataType string, charLen, precision, scale sql.NullInt64) string {
+	switch strings.ToLower(dataType) {
+	case "char", "varchar", "nchar", "nvarchar", "binary", "varbinary":
+		if !charLen.Valid {
+			return dataType
+		}
+		if charLen.Int64 == -1 {
+			return dataType + "(max)"
+		}
+		return fmt.Sprintf("%s(%d)", dataType, charLen.Int64)
+	case "decimal", "numeric":
+		if precision.Valid {
+			return fmt.Sprintf("%s(%d,%d)", dataType, precision.Int64, scale.Int64)
+		}
+	}
+	return dataType
+}
+
+// CompareSchemas compares two schemas and returns differences, with SQL
+// written for the target's database type
 func CompareSchemas(source, target *SchemaInfo) []DiffResult {
 	var results []DiffResult
+	gen := newDDLGenerator(target.Type, source.Type)
 
 	// Find tables only in source (need to add to target)
-	for tableName, sourceTable := range source.Tables {
+	for _, tableName := range sortedTableNames(source.Tables) {
 		if _, exists := target.Tables[tableName]; !exists {
-			results = append(results, DiffResult{
-				Type:      "added",
-				TableName: tableName,
-				Detail:    "Table exists in source but not in target",
-				SQL:       sourceTable.CreateSQL + ";",
-			})
+			results = append(results, createTableDiff(gen, source.Type, target.Type, tableName, source.Tables[tableName]))
 		}
 	}
 
 	// Find tables only in target (need to remove from target)
-	for tableName := range target.Tables {
+	for _, tableName := range sortedTableNames(target.Tables) {
 		if _, exists := source.Tables[tableName]; !exists {
 			results = append(results, DiffResult{
-				Type:      "removed",
-				TableName: tableName,
-				Detail:    "Table exists in target but not in source",
-				SQL:       fmt.Sprintf("DROP TABLE `%s`;", tableName),
+				Type:       "removed",
+				TableName:  tableName,
+				ObjectType: "table",
+				Action:     "drop",
+				Detail:     "Table exists in target but not in source",
+				SQL:        joinStatements(gen.dropTable(target.Tables[tableName])),
 			})
 		}
 	}
 
 	// Compare existing tables
-	for tableName, sourceTable := range source.Tables {
+	for _, tableName := range sortedTableNames(source.Tables) {
 		if targetTable, exists := target.Tables[tableName]; exists {
-			tableDiffs := compareTableStructure(tableName, sourceTable, targetTable)
+			deps := rebuildDependents(source, target, tableName)
+			tableDiffs := compareTableStructure(gen, tableName, source.Tables[tableName], targetTable, deps)
 			results = append(results, tableDiffs...)
 		}
 	}
 
+	results = append(results, compareSchemaObjects(gen, source, target)...)
+
 	// Sort results by type and table name
-	sort.Slice(results, func(i, j int) bool {
+	sort.SliceStable(results, func(i, j int) bool {
 		if results[i].Type != results[j].Type {
 			order := map[string]int{"added": 0, "modified": 1, "removed": 2}
 			return order[results[i].Type] < order[results[j].Type]
@@ -752,9 +960,37 @@ func CompareSchemas(source, target *SchemaInfo) []DiffResult {
 	return results
 }
 
-func compareTableStructure(tableName string, source, target TableInfo) []DiffResult {
+func sortedTableNames(tables map[string]TableInfo) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func compareTableStructure(gen ddlGenerator, tableName string, source, target TableInfo, deps tableDependents) []DiffResult {
 	var results []DiffResult
 
+	// Changes the engine cannot ALTER in place are collected and applied
+	// together by rebuilding the table
+	var rebuildReasons []DiffResult
+	addDiff := func(objectType, action, detail string, stmts []string) {
+		diff := DiffResult{
+			Type:       "modified",
+			TableName:  tableName,
+			ObjectType: objectType,
+			Action:     action,
+			Detail:     detail,
+		}
+		if stmts == nil {
+			rebuildReasons = append(rebuildReasons, diff)
+			return
+		}
+		diff.SQL = joinStatements(stmts)
+		results = append(results, diff)
+	}
+
 	sourceColMap := make(map[string]ColumnInfo)
 	targetColMap := make(map[string]ColumnInfo)
 
@@ -765,116 +1001,116 @@ func compareTableStructure(tableName string, source, target TableInfo) []DiffRes
 		targetColMap[col.Name] = col
 	}
 
-	// Find added columns
-	for colName, sourceCol := range sourceColMap {
-		if _, exists := targetColMap[colName]; !exists {
-			afterClause := ""
-			if sourceCol.Position > 1 {
-				for _, c := range source.Columns {
-					if c.Position == sourceCol.Position-1 {
-						afterClause = fmt.Sprintf(" AFTER `%s`", c.Name)
-						break
-					}
-				}
-			} else {
-				afterClause = " FIRST"
-			}
+	// Drop removed or changed foreign keys first, as they can block column
+	// and index changes
+	targetFKMap := make(map[string]ForeignKeyInfo)
+	for _, fk := range target.ForeignKeys {
+		targetFKMap[fk.Name] = fk
+	}
+	sourceFKMap := make(map[string]ForeignKeyInfo)
+	for _, fk := range source.ForeignKeys {
+		sourceFKMap[fk.Name] = fk
+	}
+	for _, targetFK := range target.ForeignKeys {
+		if sourceFK, exists := sourceFKMap[targetFK.Name]; !exists {
+			addDiff("foreignKey", "drop", fmt.Sprintf("Drop foreign key: %s", targetFK.Name), gen.dropForeignKey(target, targetFK))
+		} else if !foreignKeysEqual(sourceFK, targetFK) {
+			addDiff("foreignKey", "drop", fmt.Sprintf("Drop changed foreign key: %s", targetFK.Name), gen.dropForeignKey(target, targetFK))
+		}
+	}
 
-			results = append(results, DiffResult{
-				Type:      "modified",
-				TableName: tableName,
-				Detail:    fmt.Sprintf("Add column: %s", colName),
-				SQL:       fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s%s;", tableName, colName, buildColumnDef(sourceCol), afterClause),
-			})
+	// Find added columns
+	for _, sourceCol := range source.Columns {
+		if _, exists := targetColMap[sourceCol.Name]; !exists {
+			addDiff("column", "create", fmt.Sprintf("Add column: %s", sourceCol.Name), gen.addColumn(source, sourceCol))
 		}
 	}
 
 	// Find removed columns
-	for colName := range targetColMap {
-		if _, exists := sourceColMap[colName]; !exists {
-			results = append(results, DiffResult{
-				Type:      "modified",
-				TableName: tableName,
-				Detail:    fmt.Sprintf("Drop column: %s", colName),
-				SQL:       fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`;", tableName, colName),
-			})
+	for _, targetCol := range target.Columns {
+		if _, exists := sourceColMap[targetCol.Name]; !exists {
+			addDiff("column", "drop", fmt.Sprintf("Drop column: %s", targetCol.Name), gen.dropColumn(target, targetCol))
 		}
 	}
 
 	// Find modified columns
-	for colName, sourceCol := range sourceColMap {
-		if targetCol, exists := targetColMap[colName]; exists {
+	for _, sourceCol := range source.Columns {
+		if targetCol, exists := targetColMap[sourceCol.Name]; exists {
 			if !columnsEqual(sourceCol, targetCol) {
-				results = append(results, DiffResult{
-					Type:      "modified",
-					TableName: tableName,
-					Detail:    fmt.Sprintf("Modify column: %s (%s -> %s)", colName, targetCol.Type, sourceCol.Type),
-					SQL:       fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s;", tableName, colName, buildColumnDef(sourceCol)),
-				})
+				addDiff("column", "alter", fmt.Sprintf("Modify column: %s (%s -> %s)", sourceCol.Name, targetCol.Type, sourceCol.Type),
+					gen.modifyColumn(target, targetCol, sourceCol))
 			}
 		}
 	}
 
-	// Compare indexes
-	sourceIdxMap := buildIndexMap(source.Indexes)
-	targetIdxMap := buildIndexMap(target.Indexes)
+	// Compare indexes; primary keys are left alone
+	sourceIdxs := buildIndexDefs(source.Indexes)
+	targetIdxs := buildIndexDefs(target.Indexes)
+	targetIdxMap := make(map[string]indexDef)
+	for _, idx := range targetIdxs {
+		targetIdxMap[idx.Name] = idx
+	}
+	sourceIdxMap := make(map[string]indexDef)
+	for _, idx := range sourceIdxs {
+		sourceIdxMap[idx.Name] = idx
+	}
 
-	for idxName, sourceCols := range sourceIdxMap {
-		if idxName == "PRIMARY" {
-			continue // Skip primary key for now
+	for _, sourceIdx := range sourceIdxs {
+		if sourceIdx.Primary {
+			continue
 		}
-		if targetCols, exists := targetIdxMap[idxName]; !exists {
-			results = append(results, DiffResult{
-				Type:      "modified",
-				TableName: tableName,
-				Detail:    fmt.Sprintf("Add index: %s", idxName),
-				SQL:       fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `%s` (%s);", tableName, idxName, strings.Join(sourceCols, ", ")),
-			})
-		} else if !stringSlicesEqual(sourceCols, targetCols) {
-			results = append(results, DiffResult{
-				Type:      "modified",
-				TableName: tableName,
-				Detail:    fmt.Sprintf("Recreate index: %s", idxName),
-				SQL:       fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`, ADD INDEX `%s` (%s);", tableName, idxName, idxName, strings.Join(sourceCols, ", ")),
-			})
+		if targetIdx, exists := targetIdxMap[sourceIdx.Name]; !exists {
+			addDiff("index", "create", fmt.Sprintf("Add index: %s", sourceIdx.Name), gen.addIndex(source, sourceIdx))
+		} else if !indexesEqual(sourceIdx, targetIdx) {
+			drop := gen.dropIndex(target, targetIdx)
+			add := gen.addIndex(source, sourceIdx)
+			if drop == nil || add == nil {
+				addDiff("index", "alter", fmt.Sprintf("Recreate index: %s", sourceIdx.Name), nil)
+			} else {
+				addDiff("index", "alter", fmt.Sprintf("Recreate index: %s", sourceIdx.Name), append(drop, add...))
+			}
 		}
 	}
 
-	for idxName := range targetIdxMap {
-		if idxName == "PRIMARY" {
+	for _, targetIdx := range targetIdxs {
+		if targetIdx.Primary {
 			continue
 		}
-		if _, exists := sourceIdxMap[idxName]; !exists {
-			results = append(results, DiffResult{
-				Type:      "modified",
-				TableName: tableName,
-				Detail:    fmt.Sprintf("Drop index: %s", idxName),
-				SQL:       fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`;", tableName, idxName),
-			})
+		if _, exists := sourceIdxMap[targetIdx.Name]; !exists {
+			addDiff("index", "drop", fmt.Sprintf("Drop index: %s", targetIdx.Name), gen.dropIndex(target, targetIdx))
 		}
 	}
 
-	return results
-}
-
-func buildColumnDef(col ColumnInfo) string {
-	def := col.Type
-	if col.Nullable == "NO" {
-		def += " NOT NULL"
-	}
-	if col.Default != nil {
-		defaultVal := *col.Default
-		// Don't quote numeric defaults, NULL, or function calls like CURRENT_TIMESTAMP
-		if isNumericDefault(defaultVal) || isSpecialDefault(defaultVal) {
-			def += fmt.Sprintf(" DEFAULT %s", defaultVal)
-		} else {
-			def += fmt.Sprintf(" DEFAULT '%s'", defaultVal)
+	// Add foreign keys last, once the columns and indexes they use exist
+	for _, sourceFK := range source.ForeignKeys {
+		if targetFK, exists := targetFKMap[sourceFK.Name]; !exists || !foreignKeysEqual(sourceFK, targetFK) {
+			addDiff("foreignKey", "create", fmt.Sprintf("Add foreign key: %s", sourceFK.Name), gen.addForeignKey(source, sourceFK))
 		}
 	}
-	if col.Extra != "" {
-		def += " " + col.Extra
+
+	if len(rebuildReasons) > 0 {
+		if rebuilder, ok := gen.(tableRebuilder); ok {
+			// The rebuild recreates every column and index from the source
+			var reasons []string
+			for _, reason := range rebuildReasons {
+				reasons = append(reasons, reason.Detail)
+			}
+			return []DiffResult{{
+				Type:       "modified",
+				TableName:  tableName,
+				ObjectType: "table",
+				Action:     "alter",
+				Detail:     fmt.Sprintf("Rebuild table: %s", strings.Join(reasons, "; ")),
+				SQL:        joinStatements(rebuilder.rebuildTable(source, target, deps)),
+			}}
+		}
+		for _, reason := range rebuildReasons {
+			reason.Detail += " (not supported by ALTER TABLE, migrate manually)"
+			results = append(results, reason)
+		}
 	}
-	return def
+
+	return results
 }
 
 func isNumericDefault(val string) bool {
@@ -908,6 +1144,10 @@ func isSpecialDefault(val string) bool {
 	if strings.HasSuffix(upper, "()") || strings.HasPrefix(upper, "(") {
 		return true
 	}
+	// Fractional second precision, as in CURRENT_TIMESTAMP(3)
+	if strings.HasPrefix(upper, "CURRENT_TIMESTAMP(") && strings.HasSuffix(upper, ")") {
+		return true
+	}
 	return false
 }
 
@@ -926,12 +1166,8 @@ func defaultsEqual(a, b *string) bool {
 	return *a == *b
 }
 
-func buildIndexMap(indexes []IndexInfo) map[string][]string {
-	result := make(map[string][]string)
-	for _, idx := range indexes {
-		result[idx.Name] = append(result[idx.Name], fmt.Sprintf("`%s`", idx.Column))
-	}
-	return result
+func indexesEqual(a, b indexDef) bool {
+	return a.Unique == b.Unique && a.Filter == b.Filter && stringSlicesEqual(a.Columns, b.Columns)
 }
 
 func stringSlicesEqual(a, b []string) bool {
@@ -963,10 +1199,10 @@ func CreateDatabase(config ConnectionConfig, dbName, charset, collation string)
 }
 
 func createMySQLDatabase(config ConnectionConfig, dbName, charset, collation string) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/",
-		config.User, config.Password, config.Host, config.Port)
+	cfg := config
+	cfg.Database = ""
 
-	db, err := sql.Open("mysql", dsn)
+	db, err := Connect(cfg)
 	if err != nil {
 		return err
 	}
@@ -1016,9 +1252,9 @@ func createSQLServerDatabase(config ConnectionConfig, dbName string) error {
 func DropDatabase(config ConnectionConfig, dbName string) error {
 	switch config.Type {
 	case MySQL, "":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/",
-			config.User, config.Password, config.Host, config.Port)
-		db, err := sql.Open("mysql", dsn)
+		cfg := config
+		cfg.Database = ""
+		db, err := Connect(cfg)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,725 @@
+package database
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// ddlGenerator renders schema changes as statements for one database engine.
+// A nil result means the engine cannot apply the change with ALTER TABLE.
+type ddlGenerator interface {
+	createTable(table TableInfo) []string
+	dropTable(table TableInfo) []string
+	addColumn(table TableInfo, col ColumnInfo) []string
+	dropColumn(table TableInfo, col ColumnInfo) []string
+	modifyColumn(table TableInfo, from, to ColumnInfo) []string
+	addIndex(table TableInfo, idx indexDef) []string
+	dropIndex(table TableInfo, idx indexDef) []string
+	addForeignKey(table TableInfo, fk ForeignKeyInfo) []string
+	dropForeignKey(table TableInfo, fk ForeignKeyInfo) []string
+	createObject(obj schemaObject) []string
+	dropObject(obj schemaObject) []string
+	replaceObject(from, to schemaObject) []string
+}
+
+// tableRebuilder is implemented by engines that recreate a table for changes
+// they cannot alter in place
+type tableRebuilder interface {
+	rebuildTable(source, target TableInfo, deps tableDependents) []string
+}
+
+// tableDependents are the target objects a table rebuild drops along with the
+// table. Views are listed in creation order; recreate holds the views and
+// triggers the schema comparison leaves in place, so the rebuild restores them.
+type tableDependents struct {
+	views    []schemaObject
+	recreate []schemaObject
+}
+
+// indexDef is an index assembled from its per-column IndexInfo rows
+type indexDef struct {
+	Name       string
+	Unique     bool
+	Primary    bool
+	Constraint bool
+	Filter     string
+	Columns    []string
+	Definition string
+}
+
+// newDDLGenerator returns the generator for the target engine. srcType is the
+// engine the column definitions were read from, which decides how defaults are written.
+func newDDLGenerator(dbType, srcType DBType) ddlGenerator {
+	if srcType == "" {
+		srcType = MySQL
+	}
+	switch dbType {
+	case PostgreSQL:
+		return postgresDDL{srcType: srcType}
+	case SQLite:
+		return sqliteDDL{srcType: srcType}
+	case SQLServer:
+		return sqlServerDDL{srcType: srcType}
+	default:
+		return mysqlDDL{srcType: srcType}
+	}
+}
+
+// buildIndexDefs groups index columns by index name, keeping first-seen order
+func buildIndexDefs(indexes []IndexInfo) []indexDef {
+	var defs []indexDef
+	pos := make(map[string]int)
+	for _, idx := range indexes {
+		i, ok := pos[idx.Name]
+		if !ok {
+			i = len(defs)
+			pos[idx.Name] = i
+			defs = append(defs, indexDef{
+				Name:       idx.Name,
+				Unique:     idx.NonUnique == 0,
+				Primary:    idx.Primary,
+				Constraint: idx.Constraint,
+				Filter:     idx.Filter,
+				Definition: idx.Definition,
+			})
+		}
+		defs[i].Columns = append(defs[i].Columns, idx.Column)
+	}
+	return defs
+}
+
+// primaryKeyColumns returns the primary key columns of a table
+func primaryKeyColumns(table TableInfo) []string {
+	for _, idx := range buildIndexDefs(table.Indexes) {
+		if idx.Primary {
+			return idx.Columns
+		}
+	}
+	var cols []string
+	for _, col := range table.Columns {
+		if col.Key == "PRI" {
+			cols = append(cols, col.Name)
+		}
+	}
+	return cols
+}
+
+// joinStatements terminates each statement and puts one per line
+func joinStatements(stmts []string) string {
+	var lines []string
+	for _, stmt := range stmts {
+		stmt = strings.TrimRight(strings.TrimSpace(stmt), ";")
+		if stmt != "" {
+			lines = append(lines, stmt+";")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quoteColumns quotes a list of column names
+func quoteColumns(dbType DBType, cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdentifier(dbType, col)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// defaultClause renders a column default. MySQL reports defaults as bare
+// values, the other engines report the expression as written in DDL.
+func defaultClause(srcType DBType, val string) string {
+	if srcType != MySQL || isNumericDefault(val) || isSpecialDefault(val) {
+		return " DEFAULT " + val
+	}
+	return fmt.Sprintf(" DEFAULT '%s'", strings.ReplaceAll(val, "'", "''"))
+}
+
+// createTableFromColumns builds CREATE TABLE plus index statements from the
+// column list, for engines whose stored CreateSQL is missing or not portable
+func createTableFromColumns(gen ddlGenerator, dbType DBType, table TableInfo, columnDef func(ColumnInfo) string) []string {
+	var parts []string
+	for _, col := range table.Columns {
+		parts = append(parts, quoteIdentifier(dbType, col.Name)+" "+columnDef(col))
+	}
+	if pks := primaryKeyColumns(table); len(pks) > 0 {
+		parts = append(parts, fmt.Sprintf("PRIMARY KEY (%s)", quoteColumns(dbType, pks)))
+	}
+	for _, fk := range table.ForeignKeys {
+		parts = append(parts, foreignKeyClause(dbType, fk))
+	}
+
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", qualifiedTable(dbType, table), strings.Join(parts, ",\n  "))}
+	for _, idx := range buildIndexDefs(table.Indexes) {
+		if !idx.Primary {
+			stmts = append(stmts, gen.addIndex(table, idx)...)
+		}
+	}
+	return stmts
+}
+
+// MySQL
+
+type mysqlDDL struct {
+	srcType DBType
+}
+
+func (g mysqlDDL) columnDef(col ColumnInfo) string {
+	def := col.Type
+	if col.Nullable == "NO" {
+		def += " NOT NULL"
+	}
+	if col.Default != nil {
+		def += defaultClause(g.srcType, *col.Default)
+	}
+	// DEFAULT_GENERATED is informational in MySQL 8 and not valid DDL
+	extra := strings.TrimSpace(strings.ReplaceAll(col.Extra, "DEFAULT_GENERATED", ""))
+	if extra != "" && g.srcType == MySQL {
+		def += " " + extra
+	}
+	return def
+}
+
+func (g mysqlDDL) createTable(table TableInfo) []string {
+	if g.srcType == MySQL && table.CreateSQL != "" {
+		return []string{stripForeignKeyLines(table.CreateSQL, table.ForeignKeys)}
+	}
+	return createTableFromColumns(g, MySQL, table, g.columnDef)
+}
+
+// stripForeignKeyLines removes CONSTRAINT lines from SHOW CREATE TABLE output
+// for foreign keys not in keep, so they can be added later with ALTER TABLE
+func stripForeignKeyLines(createSQL string, keep []ForeignKeyInfo) string {
+	kept := make(map[string]bool)
+	for _, fk := range keep {
+		kept[quoteIdentifier(MySQL, fk.Name)] = true
+	}
+
+	var lines []string
+	for _, line := range strings.Split(createSQL, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "CONSTRAINT ") && strings.Contains(trimmed, " FOREIGN KEY ") {
+			if name := strings.Fields(trimmed)[1]; !kept[name] {
+				continue
+			}
+		}
+		// The definition before the closing parenthesis takes no comma
+		if strings.HasPrefix(trimmed, ")") && len(lines) > 0 {
+			lines[len(lines)-1] = strings.TrimSuffix(lines[len(lines)-1], ",")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g mysqlDDL) dropTable(table TableInfo) []string {
+	return []string{fmt.Sprintf("DROP TABLE %s", qualifiedTable(MySQL, table))}
+}
+
+func (g mysqlDDL) addColumn(table TableInfo, col ColumnInfo) []string {
+	position := " FIRST"
+	for i, c := range table.Columns {
+		if c.Name == col.Name && i > 0 {
+			position = " AFTER " + quoteIdentifier(MySQL, table.Columns[i-1].Name)
+			break
+		}
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s%s",
+		qualifiedTable(MySQL, table), quoteIdentifier(MySQL, col.Name), g.columnDef(col), position)}
+}
+
+func (g mysqlDDL) dropColumn(table TableInfo, col ColumnInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+		qualifiedTable(MySQL, table), quoteIdentifier(MySQL, col.Name))}
+}
+
+func (g mysqlDDL) modifyColumn(table TableInfo, from, to ColumnInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s",
+		qualifiedTable(MySQL, table), quoteIdentifier(MySQL, to.Name), g.columnDef(to))}
+}
+
+func (g mysqlDDL) addIndex(table TableInfo, idx indexDef) []string {
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s %s (%s)",
+		qualifiedTable(MySQL, table), kind, quoteIdentifier(MySQL, idx.Name), quoteColumns(MySQL, idx.Columns))}
+}
+
+func (g mysqlDDL) dropIndex(table TableInfo, idx indexDef) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP INDEX %s",
+		qualifiedTable(MySQL, table), quoteIdentifier(MySQL, idx.Name))}
+}
+
+func (g mysqlDDL) addForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s", qualifiedTable(MySQL, table), foreignKeyClause(MySQL, fk))}
+}
+
+func (g mysqlDDL) dropForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s",
+		qualifiedTable(MySQL, table), quoteIdentifier(MySQL, fk.Name))}
+}
+
+func (g mysqlDDL) createObject(obj schemaObject) []string {
+	return []string{obj.Definition}
+}
+
+func (g mysqlDDL) dropObject(obj schemaObject) []string {
+	return []string{fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(obj.Kind), quoteIdentifier(MySQL, obj.Name))}
+}
+
+func (g mysqlDDL) replaceObject(from, to schemaObject) []string {
+	if to.Kind == "view" {
+		return []string{insertAfterCreate(to.Definition, "OR REPLACE")}
+	}
+	return append(g.dropObject(from), g.createObject(to)...)
+}
+
+// PostgreSQL
+
+type postgresDDL struct {
+	srcType DBType
+}
+
+func (g postgresDDL) columnDef(col ColumnInfo) string {
+	def := col.Type
+	if col.Nullable == "NO" {
+		def += " NOT NULL"
+	}
+	if col.Default != nil {
+		def += defaultClause(g.srcType, *col.Default)
+	}
+	return def
+}
+
+// newColumnDef is columnDef for columns being created, where a sequence
+// default has to become a serial type since the sequence does not exist yet
+func (g postgresDDL) newColumnDef(col ColumnInfo) string {
+	if col.Default != nil && strings.HasPrefix(*col.Default, "nextval(") {
+		serial := map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}
+		if t, ok := serial[strings.ToLower(col.Type)]; ok {
+			col.Type = t
+			col.Default = nil
+		}
+	}
+	return g.columnDef(col)
+}
+
+func (g postgresDDL) createTable(table TableInfo) []string {
+	return createTableFromColumns(g, PostgreSQL, table, g.newColumnDef)
+}
+
+func (g postgresDDL) dropTable(table TableInfo) []string {
+	return []string{fmt.Sprintf("DROP TABLE %s", qualifiedTable(PostgreSQL, table))}
+}
+
+func (g postgresDDL) addColumn(table TableInfo, col ColumnInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+		qualifiedTable(PostgreSQL, table), quoteIdentifier(PostgreSQL, col.Name), g.newColumnDef(col))}
+}
+
+func (g postgresDDL) dropColumn(table TableInfo, col ColumnInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+		qualifiedTable(PostgreSQL, table), quoteIdentifier(PostgreSQL, col.Name))}
+}
+
+func (g postgresDDL) modifyColumn(table TableInfo, from, to ColumnInfo) []string {
+	col := quoteIdentifier(PostgreSQL, to.Name)
+	var actions []string
+	if from.Type != to.Type {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", col, to.Type, col, to.Type))
+	}
+	if from.Nullable != to.Nullable {
+		if to.Nullable == "NO" {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", col))
+		} else {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", col))
+		}
+	}
+	if !defaultsEqual(from.Default, to.Default) {
+		if to.Default != nil {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET%s", col, defaultClause(g.srcType, *to.Default)))
+		} else {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", col))
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s %s", qualifiedTable(PostgreSQL, table), strings.Join(actions, ", "))}
+}
+
+func (g postgresDDL) addIndex(table TableInfo, idx indexDef) []string {
+	if g.srcType == PostgreSQL && idx.Definition != "" {
+		if idx.Constraint && idx.Unique && !idx.Primary {
+			// Attach the index to a constraint again, as in the source
+			return []string{idx.Definition, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE USING INDEX %s",
+				qualifiedTable(PostgreSQL, table), quoteIdentifier(PostgreSQL, idx.Name), quoteIdentifier(PostgreSQL, idx.Name))}
+		}
+		return []string{idx.Definition}
+	}
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return []string{fmt.Sprintf("CREATE %s %s ON %s (%s)",
+		kind, quoteIdentifier(PostgreSQL, idx.Name), qualifiedTable(PostgreSQL, table), quoteColumns(PostgreSQL, idx.Columns))}
+}
+
+func (g postgresDDL) dropIndex(table TableInfo, idx indexDef) []string {
+	// DROP INDEX refuses an index owned by a constraint
+	if idx.Constraint || idx.Primary {
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+			qualifiedTable(PostgreSQL, table), quoteIdentifier(PostgreSQL, idx.Name))}
+	}
+	// Indexes live in their table's schema
+	return []string{fmt.Sprintf("DROP INDEX %s", qualifiedName(PostgreSQL, table.Schema, idx.Name))}
+}
+
+func (g postgresDDL) addForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s", qualifiedTable(PostgreSQL, table), foreignKeyClause(PostgreSQL, fk))}
+}
+
+func (g postgresDDL) dropForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+		qualifiedTable(PostgreSQL, table), quoteIdentifier(PostgreSQL, fk.Name))}
+}
+
+func (g postgresDDL) createObject(obj schemaObject) []string {
+	return []string{obj.Definition}
+}
+
+func (g postgresDDL) dropObject(obj schemaObject) []string {
+	name := qualifiedName(PostgreSQL, obj.Schema, obj.Name)
+	switch obj.Kind {
+	case "trigger":
+		// Triggers belong to their table rather than a schema
+		name = quoteIdentifier(PostgreSQL, obj.Name) + " ON " + qualifiedName(PostgreSQL, obj.Schema, obj.TableName)
+	case "procedure", "function":
+		name += "(" + obj.Arguments + ")"
+	}
+	return []string{fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(obj.Kind), name)}
+}
+
+// replaceObject relies on pg_get_functiondef emitting CREATE OR REPLACE for
+// routines; views and triggers are recreated, since CREATE OR REPLACE VIEW
+// cannot change the column list
+func (g postgresDDL) replaceObject(from, to schemaObject) []string {
+	if to.Kind == "procedure" || to.Kind == "function" {
+		return g.createObject(to)
+	}
+	return append(g.dropObject(from), g.createObject(to)...)
+}
+
+// SQLite
+
+type sqliteDDL struct {
+	srcType DBType
+}
+
+func (g sqliteDDL) columnDef(col ColumnInfo) string {
+	def := col.Type
+	if col.Nullable == "NO" {
+		def += " NOT NULL"
+	}
+	if col.Default != nil {
+		def += defaultClause(g.srcType, *col.Default)
+	}
+	return def
+}
+
+func (g sqliteDDL) createTable(table TableInfo) []string {
+	if g.srcType != SQLite || table.CreateSQL == "" {
+		return createTableFromColumns(g, SQLite, table, g.columnDef)
+	}
+	stmts := []string{table.CreateSQL}
+	for _, idx := range buildIndexDefs(table.Indexes) {
+		if idx.Definition != "" {
+			stmts = append(stmts, idx.Definition)
+		}
+	}
+	return stmts
+}
+
+func (g sqliteDDL) dropTable(table TableInfo) []string {
+	return []string{fmt.Sprintf("DROP TABLE %s", qualifiedTable(SQLite, table))}
+}
+
+// addColumn only works in place for columns SQLite can backfill with a constant
+func (g sqliteDDL) addColumn(table TableInfo, col ColumnInfo) []string {
+	if col.Key == "PRI" {
+		return nil
+	}
+	if col.Default == nil && col.Nullable == "NO" {
+		return nil
+	}
+	if col.Default != nil {
+		upper := strings.ToUpper(*col.Default)
+		if strings.HasPrefix(upper, "CURRENT_") || strings.HasPrefix(upper, "(") {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+		qualifiedTable(SQLite, table), quoteIdentifier(SQLite, col.Name), g.columnDef(col))}
+}
+
+// dropColumn only works in place for columns no key or index depends on
+func (g sqliteDDL) dropColumn(table TableInfo, col ColumnInfo) []string {
+	if col.Key == "PRI" {
+		return nil
+	}
+	for _, idx := range table.Indexes {
+		if idx.Column == col.Name {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+		qualifiedTable(SQLite, table), quoteIdentifier(SQLite, col.Name))}
+}
+
+func (g sqliteDDL) modifyColumn(table TableInfo, from, to ColumnInfo) []string {
+	return nil
+}
+
+func (g sqliteDDL) addIndex(table TableInfo, idx indexDef) []string {
+	if strings.HasPrefix(idx.Name, "sqlite_autoindex_") {
+		return nil
+	}
+	if g.srcType == SQLite && idx.Definition != "" {
+		return []string{idx.Definition}
+	}
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return []string{fmt.Sprintf("CREATE %s %s ON %s (%s)",
+		kind, quoteIdentifier(SQLite, idx.Name), qualifiedTable(SQLite, table), quoteColumns(SQLite, idx.Columns))}
+}
+
+func (g sqliteDDL) dropIndex(table TableInfo, idx indexDef) []string {
+	if strings.HasPrefix(idx.Name, "sqlite_autoindex_") {
+		return nil
+	}
+	return []string{fmt.Sprintf("DROP INDEX %s", quoteIdentifier(SQLite, idx.Name))}
+}
+
+// SQLite foreign keys are part of the table definition and need a rebuild
+func (g sqliteDDL) addForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return nil
+}
+
+func (g sqliteDDL) dropForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return nil
+}
+
+func (g sqliteDDL) createObject(obj schemaObject) []string {
+	return []string{obj.Definition}
+}
+
+func (g sqliteDDL) dropObject(obj schemaObject) []string {
+	return []string{fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(obj.Kind), quoteIdentifier(SQLite, obj.Name))}
+}
+
+func (g sqliteDDL) replaceObject(from, to schemaObject) []string {
+	return append(g.dropObject(from), g.createObject(to)...)
+}
+
+var createTableNameRe = regexp.MustCompile("(?is)^\\s*CREATE\\s+TABLE\\s+(IF\\s+NOT\\s+EXISTS\\s+)?(\"(?:[^\"]|\"\")*\"|`[^`]*`|\\[[^\\]]*\\]|[^\\s(]+)")
+
+// rebuildTable follows SQLite's documented procedure for arbitrary table
+// changes: create the new layout under a temporary name, copy the shared
+// columns, drop the old table, rename, then recreate the indexes, triggers
+// and views. Dependent views are dropped first, as the rename fails while a
+// view refers to a missing table.
+func (g sqliteDDL) rebuildTable(source, target TableInfo, deps tableDependents) []string {
+	tmpName := "_syncforge_new_" + target.Name
+
+	tmp := source
+	tmp.Name = tmpName
+	tmp.Indexes = nil
+	var create []string
+	if g.srcType == SQLite && createTableNameRe.MatchString(source.CreateSQL) {
+		create = []string{createTableNameRe.ReplaceAllLiteralString(source.CreateSQL, "CREATE TABLE "+quoteIdentifier(SQLite, tmpName))}
+	} else {
+		// Primary key comes from the source indexes, which tmp no longer carries
+		pks := make(map[string]bool)
+		for _, pk := range primaryKeyColumns(source) {
+			pks[pk] = true
+		}
+		tmp.Columns = make([]ColumnInfo, len(source.Columns))
+		for i, col := range source.Columns {
+			col.Key = ""
+			if pks[col.Name] {
+				col.Key = "PRI"
+			}
+			tmp.Columns[i] = col
+		}
+		create = createTableFromColumns(g, SQLite, tmp, g.columnDef)
+	}
+
+	targetCols := make(map[string]bool)
+	for _, col := range target.Columns {
+		targetCols[col.Name] = true
+	}
+	var shared []string
+	for _, col := range source.Columns {
+		if targetCols[col.Name] {
+			shared = append(shared, col.Name)
+		}
+	}
+
+	stmts := []string{"PRAGMA foreign_keys=OFF"}
+	stmts = append(stmts, create...)
+	if len(shared) > 0 {
+		cols := quoteColumns(SQLite, shared)
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+			quoteIdentifier(SQLite, tmpName), cols, cols, quoteIdentifier(SQLite, target.Name)))
+	}
+	for i := len(deps.views) - 1; i >= 0; i-- {
+		stmts = append(stmts, g.dropObject(deps.views[i])...)
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("DROP TABLE %s", quoteIdentifier(SQLite, target.Name)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdentifier(SQLite, tmpName), quoteIdentifier(SQLite, target.Name)),
+	)
+	for _, idx := range buildIndexDefs(source.Indexes) {
+		if !idx.Primary {
+			stmts = append(stmts, g.addIndex(target, idx)...)
+		}
+	}
+	for _, obj := range deps.recreate {
+		stmts = append(stmts, g.createObject(obj)...)
+	}
+	return append(stmts, "PRAGMA foreign_keys=ON")
+}
+
+// SQL Server
+
+type sqlServerDDL struct {
+	srcType DBType
+}
+
+func (g sqlServerDDL) columnDef(col ColumnInfo) string {
+	def := col.Type
+	if col.Extra == "IDENTITY" {
+		def += " IDENTITY(1,1)"
+	}
+	if col.Nullable == "NO" {
+		def += " NOT NULL"
+	} else {
+		def += " NULL"
+	}
+	if col.Default != nil {
+		def += defaultClause(g.srcType, *col.Default)
+	}
+	return def
+}
+
+// dropDefaultConstraint drops the column's default constraint, whose name is
+// generated by the server, so that the column can be altered or dropped.
+// Variables live as long as the batch, so each column gets its own, which
+// lets several of these run in one script.
+func (g sqlServerDDL) dropDefaultConstraint(table TableInfo, colName string) string {
+	name := strings.ReplaceAll(qualifiedTable(SQLServer, table), "'", "''")
+	col := strings.ReplaceAll(colName, "'", "''")
+	h := fnv.New32a()
+	h.Write([]byte(qualifiedTable(SQLServer, table) + "." + colName))
+	variable := fmt.Sprintf("@df_%08x", h.Sum32())
+	return fmt.Sprintf("DECLARE %s sysname = (SELECT name FROM sys.default_constraints "+
+		"WHERE parent_object_id = OBJECT_ID('%s') AND parent_column_id = COLUMNPROPERTY(OBJECT_ID('%s'), '%s', 'ColumnId')) "+
+		"IF %s IS NOT NULL EXEC('ALTER TABLE %s DROP CONSTRAINT [' + %s + ']')",
+		variable, name, name, col, variable, name, variable)
+}
+
+func (g sqlServerDDL) createTable(table TableInfo) []string {
+	return createTableFromColumns(g, SQLServer, table, g.columnDef)
+}
+
+func (g sqlServerDDL) dropTable(table TableInfo) []string {
+	return []string{fmt.Sprintf("DROP TABLE %s", qualifiedTable(SQLServer, table))}
+}
+
+func (g sqlServerDDL) addColumn(table TableInfo, col ColumnInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s %s",
+		qualifiedTable(SQLServer, table), quoteIdentifier(SQLServer, col.Name), g.columnDef(col))}
+}
+
+func (g sqlServerDDL) dropColumn(table TableInfo, col ColumnInfo) []string {
+	var stmts []string
+	if col.Default != nil {
+		stmts = append(stmts, g.dropDefaultConstraint(table, col.Name))
+	}
+	return append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+		qualifiedTable(SQLServer, table), quoteIdentifier(SQLServer, col.Name)))
+}
+
+// modifyColumn cannot change IDENTITY, which needs the table recreated
+func (g sqlServerDDL) modifyColumn(table TableInfo, from, to ColumnInfo) []string {
+	typeChanged := from.Type != to.Type || from.Nullable != to.Nullable
+	defaultChanged := !defaultsEqual(from.Default, to.Default)
+
+	var stmts []string
+	// A default constraint blocks ALTER COLUMN, so it is dropped and re-added
+	if from.Default != nil && (typeChanged || defaultChanged) {
+		stmts = append(stmts, g.dropDefaultConstraint(table, to.Name))
+	}
+	if typeChanged {
+		nullable := " NULL"
+		if to.Nullable == "NO" {
+			nullable = " NOT NULL"
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s%s",
+			qualifiedTable(SQLServer, table), quoteIdentifier(SQLServer, to.Name), to.Type, nullable))
+	}
+	if to.Default != nil && (defaultChanged || (typeChanged && from.Default != nil)) {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD%s FOR %s",
+			qualifiedTable(SQLServer, table), defaultClause(g.srcType, *to.Default), quoteIdentifier(SQLServer, to.Name)))
+	}
+	return stmts
+}
+
+func (g sqlServerDDL) addIndex(table TableInfo, idx indexDef) []string {
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	stmt := fmt.Sprintf("CREATE %s %s ON %s (%s)",
+		kind, quoteIdentifier(SQLServer, idx.Name), qualifiedTable(SQLServer, table), quoteColumns(SQLServer, idx.Columns))
+	if idx.Filter != "" {
+		stmt += " WHERE " + idx.Filter
+	}
+	return []string{stmt}
+}
+
+func (g sqlServerDDL) dropIndex(table TableInfo, idx indexDef) []string {
+	if idx.Constraint || idx.Primary {
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+			qualifiedTable(SQLServer, table), quoteIdentifier(SQLServer, idx.Name))}
+	}
+	return []string{fmt.Sprintf("DROP INDEX %s ON %s",
+		quoteIdentifier(SQLServer, idx.Name), qualifiedTable(SQLServer, table))}
+}
+
+func (g sqlServerDDL) addForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s", qualifiedTable(SQLServer, table), foreignKeyClause(SQLServer, fk))}
+}
+
+func (g sqlServerDDL) dropForeignKey(table TableInfo, fk ForeignKeyInfo) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+		qualifiedTable(SQLServer, table), quoteIdentifier(SQLServer, fk.Name))}
+}
+
+func (g sqlServerDDL) createObject(obj schemaObject) []string {
+	return []string{obj.Definition}
+}
+
+func (g sqlServerDDL) dropObject(obj schemaObject) []string {
+	return []string{fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(obj.Kind), qualifiedName(SQLServer, obj.Schema, obj.Name))}
+}
+
+// replaceObject uses CREATE OR ALTER, which keeps permissions on the object
+func (g sqlServerDDL) replaceObject(from, to schemaObject) []string {
+	return []string{insertAfterCreate(to.Definition, "OR ALTER")}
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestPostgresDropIndex(t *testing.T) {
+	table := TableInfo{Schema: "app", Name: "users"}
+	tests := []struct {
+		name string
+		idx  indexDef
+		want string
+	}{
+		{"plain index", indexDef{Name: "users_name_idx"}, `DROP INDEX "app"."users_name_idx"`},
+		{"unique index", indexDef{Name: "users_email_idx", Unique: true}, `DROP INDEX "app"."users_email_idx"`},
+		{"unique constraint", indexDef{Name: "users_email_key", Unique: true, Constraint: true},
+			`ALTER TABLE "app"."users" DROP CONSTRAINT "users_email_key"`},
+		{"primary key", indexDef{Name: "users_pkey", Unique: true, Primary: true, Constraint: true},
+			`ALTER TABLE "app"."users" DROP CONSTRAINT "users_pkey"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postgresDDL{srcType: PostgreSQL}.dropIndex(table, tt.idx)
+			if !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("dropIndex = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRecreateConstraintIndex(t *testing.T) {
+	table := TableInfo{Schema: "public", Name: "users"}
+	idx := indexDef{
+		Name:       "users_email_key",
+		Unique:     true,
+		Constraint: true,
+		Columns:    []string{"email"},
+		Definition: "CREATE UNIQUE INDEX users_email_key ON public.users USING btree (email)",
+	}
+	got := postgresDDL{srcType: PostgreSQL}.addIndex(table, idx)
+	want := []string{
+		idx.Definition,
+		`ALTER TABLE "public"."users" ADD CONSTRAINT "users_email_key" UNIQUE USING INDEX "users_email_key"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("addIndex = %q, want %q", got, want)
+	}
+}
+
+func TestSQLServerDropDefaultConstraints(t *testing.T) {
+	g := sqlServerDDL{srcType: SQLServer}
+	table := TableInfo{Schema: "dbo", Name: "orders"}
+	def := "((0))"
+	var stmts []string
+	stmts = append(stmts, g.dropColumn(table, ColumnInfo{Name: "legacy", Type: "int", Nullable: "YES", Default: &def})...)
+	stmts = append(stmts, g.modifyColumn(table,
+		ColumnInfo{Name: "total", Type: "int", Nullable: "NO", Default: &def},
+		ColumnInfo{Name: "total", Type: "bigint", Nullable: "NO", Default: &def})...)
+
+	// The statements run as one batch, where a variable can be declared once
+	declare := regexp.MustCompile(`DECLARE (@\w+) `)
+	declared := make(map[string]bool)
+	for _, stmt := range stmts {
+		for _, m := range declare.FindAllStringSubmatch(stmt, -1) {
+			if declared[m[1]] {
+				t.Errorf("%s declared twice in %q", m[1], joinStatements(stmts))
+			}
+			declared[m[1]] = true
+		}
+	}
+	if len(declared) != 2 {
+		t.Errorf("declared %d variables, want 2: %q", len(declared), joinStatements(stmts))
+	}
+}
+
+func TestSQLServerDropConstraintIndex(t *testing.T) {
+	table := TableInfo{Schema: "dbo", Name: "users"}
+	g := sqlServerDDL{srcType: SQLServer}
+	if got, want := g.dropIndex(table, indexDef{Name: "UQ_users_email", Unique: true, Constraint: true}),
+		"ALTER TABLE [dbo].[users] DROP CONSTRAINT [UQ_users_email]"; !reflect.DeepEqual(got, []string{want}) {
+		t.Errorf("dropIndex = %q, want %q", got, want)
+	}
+	if got, want := g.dropIndex(table, indexDef{Name: "IX_users_name"}),
+		"DROP INDEX [IX_users_name] ON [dbo].[users]"; !reflect.DeepEqual(got, []string{want}) {
+		t.Errorf("dropIndex = %q, want %q", got, want)
+	}
+}
+
+func TestSQLiteRebuildKeepsTriggersAndViews(t *testing.T) {
+	open := func(name string, stmts ...string) (*SchemaInfo, ConnectionConfig) {
+		config := ConnectionConfig{Type: SQLite, FilePath: filepath.Join(t.TempDir(), name)}
+		db, err := Connect(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		schema, err := GetSchema(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schema, config
+	}
+	trigger := "CREATE TRIGGER orders_audit AFTER INSERT ON orders BEGIN INSERT INTO audit (order_id) VALUES (NEW.id); END"
+	view := "CREATE VIEW v_orders AS SELECT id, total FROM orders"
+	summary := "CREATE VIEW v_summary AS SELECT count(*) AS n FROM v_orders"
+	source, _ := open("source.db",
+		"CREATE TABLE audit (order_id INTEGER)",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL NOT NULL)",
+		trigger, view, summary)
+	target, config := open("target.db",
+		"CREATE TABLE audit (order_id INTEGER)",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER)",
+		trigger, view, summary)
+
+	deps := rebuildDependents(source, target, "orders")
+	var names []string
+	for _, obj := range deps.views {
+		names = append(names, obj.Name)
+	}
+	if want := []string{"v_orders", "v_summary"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("dependent views = %v, want %v", names, want)
+	}
+	if len(deps.recreate) != 3 {
+		t.Fatalf("recreating %d objects, want 3", len(deps.recreate))
+	}
+
+	stmts := sqliteDDL{srcType: SQLite}.rebuildTable(source.Tables["orders"], target.Tables["orders"], deps)
+	db, err := Connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO orders (id, total) VALUES (1, 2.5)"); err != nil {
+		t.Fatal(err)
+	}
+	var audited, n int
+	if err := db.QueryRow("SELECT count(*) FROM audit").Scan(&audited); err != nil {
+		t.Fatal(err)
+	}
+	if audited != 1 {
+		t.Errorf("trigger wrote %d audit rows, want 1", audited)
+	}
+	if err := db.QueryRow("SELECT n FROM v_summary").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("v_summary counts %d orders, want 1", n)
+	}
+}
+
+func TestRebuildDependentsSkipsReplacedObjects(t *testing.T) {
+	target := &SchemaInfo{Type: SQLite,
+		Views: map[string]ViewInfo{
+			"v_old":   {Name: "v_old", Definition: "CREATE VIEW v_old AS SELECT 1 FROM orders", DependsOn: []string{"orders"}},
+			"v_same":  {Name: "v_same", Definition: "CREATE VIEW v_same AS SELECT 2 FROM orders", DependsOn: []string{"orders"}},
+			"v_other": {Name: "v_other", Definition: "CREATE VIEW v_other AS SELECT 3 FROM users", DependsOn: []string{"users"}},
+		},
+		Triggers: map[string]TriggerInfo{
+			"t_changed": {Name: "t_changed", TableName: "orders", Definition: "CREATE TRIGGER t_changed ... old"},
+		},
+	}
+	source := &SchemaInfo{Type: SQLite,
+		Views: map[string]ViewInfo{
+			"v_same": target.Views["v_same"],
+		},
+		Triggers: map[string]TriggerInfo{
+			"t_changed": {Name: "t_changed", TableName: "orders", Definition: "CREATE TRIGGER t_changed ... new"},
+		},
+	}
+	deps := rebuildDependents(source, target, "orders")
+	if len(deps.views) != 2 {
+		t.Errorf("dropping %d views, want v_old and v_same", len(deps.views))
+	}
+	if len(deps.recreate) != 1 || deps.recreate[0].Name != "v_same" {
+		t.Errorf("recreate = %+v, want only v_same", deps.recreate)
+	}
+
+	// Across engines the comparison generates no SQL, so the target's objects stay
+	source.Type = PostgreSQL
+	if deps := rebuildDependents(source, target, "orders"); len(deps.recreate) != 2 {
+		t.Errorf("recreate = %+v, want v_same and t_changed", deps.recreate)
+	}
+}
@@ -0,0 +1,591 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ExecuteSQL executes a script on the target database
+func ExecuteSQL(config ConnectionConfig, sql string) error {
+	db, err := Connect(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// MySQL supports multi-statement execution via DSN config
+	// For other databases, execute statements one by one
+	dbType := config.Type
+	if dbType == "" || dbType == MySQL {
+		_, err = db.Exec(sql)
+		return err
+	}
+
+	// Split and execute statements one by one for non-MySQL databases
+	statements := splitSQLStatements(dbType, sql)
+	for _, stmt := range statements {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecutionResult reports how a script ran in transactional mode
+type ExecutionResult struct {
+	Total         int              `json:"total"`
+	Executed      int              `json:"executed"`
+	Failed        *FailedStatement `json:"failed,omitempty"`
+	RolledBack    bool             `json:"rolledBack"`
+	RollbackError string           `json:"rollbackError,omitempty"`
+	// MySQL statements that commit the transaction implicitly. A rollback
+	// cannot undo them, anything that ran before them, or anything after
+	// them, since MySQL runs later statements outside a transaction.
+	ImplicitCommits []string `json:"implicitCommits,omitempty"`
+	// Set when the script failed after an implicit commit had taken effect
+	PartiallyCommitted bool `json:"partiallyCommitted"`
+	// How many statements from the start of the script stayed committed
+	// despite the failure
+	Committed int `json:"committed"`
+	// Rows changed by ExecuteDataDiffs, counting at most one per difference
+	RowsAffected int64 `json:"rowsAffected"`
+	// The rows each group of differences run together changed
+	runs []appliedRun
+}
+
+// appliedRun is a group of differences ExecuteDataDiffs ran together,
+// all of the same type and table
+type appliedRun struct {
+	index, count int
+	rows         int64
+}
+
+// FailedStatement identifies the statement that stopped a script
+type FailedStatement struct {
+	Index int    `json:"index"` // 1-based position in the script
+	SQL   string `json:"sql"`
+	Error string `json:"error"`
+}
+
+// Err describes a failed run as an error, or returns nil if the script succeeded
+func (r *ExecutionResult) Err() error {
+	if r.Failed == nil {
+		return nil
+	}
+	msg := fmt.Sprintf("statement %d of %d failed: %s", r.Failed.Index, r.Total, r.Failed.Error)
+	switch {
+	case r.RollbackError != "":
+		msg += fmt.Sprintf(" (rollback failed: %s)", r.RollbackError)
+	case r.PartiallyCommitted && r.Committed == 1:
+		msg += " (statement 1 was committed implicitly and not rolled back)"
+	case r.PartiallyCommitted && r.Committed > 1:
+		msg += fmt.Sprintf(" (statements 1-%d were committed implicitly and not rolled back)", r.Committed)
+	case r.PartiallyCommitted:
+		msg += " (the failed statement committed implicitly; nothing was rolled back)"
+	case r.RolledBack:
+		msg += " (rolled back)"
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// ExecuteSQLTransaction runs a script statement by statement inside a single
+// transaction and rolls everything back if one fails. PostgreSQL, SQL Server
+// and SQLite roll back schema changes too; MySQL commits implicitly around
+// most DDL, so those statements are listed in the result before running,
+// and a failure after one reports how many statements stayed committed.
+// A failed statement is reported in the result rather than as an error.
+func ExecuteSQLTransaction(config ConnectionConfig, sql string) (*ExecutionResult, error) {
+	db, err := Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	dbType := config.Type
+	if dbType == "" {
+		dbType = MySQL
+	}
+
+	// PRAGMA foreign_keys is a no-op inside a transaction, so SQLite table
+	// rebuilds switch it off before BEGIN and back on after COMMIT
+	var statements, before, after []string
+	for _, stmt := range splitSQLStatements(dbType, sql) {
+		if dbType == SQLite {
+			if on, ok := foreignKeysPragma(stmt); ok {
+				if on {
+					after = append(after, stmt)
+				} else {
+					before = append(before, stmt)
+				}
+				continue
+			}
+		}
+		statements = append(statements, stmt)
+	}
+
+	result := &ExecutionResult{Total: len(statements)}
+	if dbType == MySQL {
+		for _, stmt := range statements {
+			if mysqlImplicitCommit(stmt) {
+				result.ImplicitCommits = append(result.ImplicitCommits, stmt)
+			}
+		}
+	}
+
+	// Session settings must apply to the connection running the transaction
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for _, stmt := range before {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		for _, stmt := range after {
+			conn.ExecContext(ctx, stmt)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !runScript(ctx, tx, dbType, statements, result) {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scriptTx is the part of *sql.Tx that runScript uses
+type scriptTx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Rollback() error
+}
+
+// runScript runs statements in tx and records the outcome in result. On
+// failure it rolls back and reports false. MySQL commits the open
+// transaction before running a statement that commits implicitly, even one
+// that then fails, and runs every later statement in autocommit mode, so
+// once one has been reached nothing that ran can be rolled back.
+func runScript(ctx context.Context, tx scriptTx, dbType DBType, statements []string, result *ExecutionResult) bool {
+	committed := false
+	for i, stmt := range statements {
+		if dbType == MySQL && mysqlImplicitCommit(stmt) {
+			committed = true
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			result.Failed = &FailedStatement{Index: i + 1, SQL: stmt, Error: err.Error()}
+			if rbErr := tx.Rollback(); rbErr != nil {
+				result.RollbackError = rbErr.Error()
+			} else {
+				result.RolledBack = !committed
+			}
+			if committed {
+				result.PartiallyCommitted = true
+				result.Committed = result.Executed
+			}
+			return false
+		}
+		result.Executed++
+	}
+	return true
+}
+
+// ExecuteDataDiffs applies data differences to the target inside a single
+// transaction, running each as a prepared statement with its arguments
+// instead of as literal SQL. Statements are prepared once per template, and
+// consecutive inserts into a table are batched or bulk loaded as options
+// say. A failed statement rolls back the batch and is reported in the result.
+func ExecuteDataDiffs(config ConnectionConfig, diffs []DataDiffResult, options DataApplyOptions) (*ExecutionResult, error) {
+	db, err := Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExecutionResult{Total: len(diffs)}
+	prepared := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range prepared {
+			stmt.Close()
+		}
+	}()
+	a := &diffApplier{db: db, tx: tx, config: config, options: options, prepared: prepared}
+
+	for i := 0; i < len(diffs); {
+		n, rows, err := a.apply(diffs[i:])
+		if err != nil {
+			msg := err.Error()
+			if n > 1 {
+				msg = fmt.Sprintf("%s (in a batch of %d inserts starting here)", msg, n)
+			}
+			result.Failed = &FailedStatement{Index: i + 1, SQL: diffs[i].SQL, Error: msg}
+			if rbErr := tx.Rollback(); rbErr != nil {
+				result.RollbackError = rbErr.Error()
+			} else {
+				result.RolledBack = true
+			}
+			result.RowsAffected, result.runs = 0, nil
+			return result, nil
+		}
+		// MySQL counts an upsert that updates as two rows
+		if rows > int64(n) {
+			rows = int64(n)
+		}
+		result.Executed += n
+		result.RowsAffected += rows
+		result.runs = append(result.runs, appliedRun{index: i, count: n, rows: rows})
+		i += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// diffApplier holds the state ExecuteDataDiffs keeps across differences
+type diffApplier struct {
+	db       *sql.DB
+	tx       *sql.Tx
+	config   ConnectionConfig
+	options  DataApplyOptions
+	prepared map[string]*sql.Stmt
+	// Target column kinds per table, read for bulk loads
+	kinds map[string]map[string]valueKind
+}
+
+// apply runs the differences at the start of diffs, as many at once as the
+// options allow, and returns how many it ran and the rows they changed
+func (a *diffApplier) apply(diffs []DataDiffResult) (int, int64, error) {
+	dbType := a.config.Type
+	if a.options.BulkLoad && dbType != SQLite {
+		if n := insertRun(diffs, len(diffs)); n > 0 {
+			kinds, err := a.targetKinds(diffs[0].targetTable())
+			if err != nil {
+				return n, 0, err
+			}
+			rows, err := execBulkInsert(a.tx, dbType, diffs[:n], kinds)
+			return n, rows, err
+		}
+	}
+	if cols := len(diffs[0].Columns); cols > 0 {
+		if n := insertRun(diffs, insertBatchLimit(dbType, a.options.BatchSize, cols)); n > 1 {
+			rows, err := execInsertBatch(a.tx, dbType, diffs[:n])
+			return n, rows, err
+		}
+	}
+	rows, err := execDataDiff(a.tx, a.prepared, diffs[0])
+	return 1, rows, err
+}
+
+// targetKinds returns the kinds of a target table's columns
+func (a *diffApplier) targetKinds(tableName string) (map[string]valueKind, error) {
+	if kinds, ok := a.kinds[tableName]; ok {
+		return kinds, nil
+	}
+	columns, err := getColumnInfo(a.db, a.config.Type, a.config.Database, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target columns: %v", err)
+	}
+	kinds := make(map[string]valueKind)
+	for _, col := range columns {
+		kinds[col.Name] = columnKind(col.Type)
+	}
+	if a.kinds == nil {
+		a.kinds = make(map[string]map[string]valueKind)
+	}
+	a.kinds[tableName] = kinds
+	return kinds, nil
+}
+
+// execDataDiff runs one difference, falling back to its literal SQL when it
+// carries no statement template, and returns the rows it changed
+func execDataDiff(tx *sql.Tx, prepared map[string]*sql.Stmt, diff DataDiffResult) (int64, error) {
+	if diff.Statement == "" {
+		return rowsAffected(tx.Exec(diff.SQL))
+	}
+
+	args, err := decodeArgs(diff)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, ok := prepared[diff.Statement]
+	if !ok {
+		if stmt, err = tx.Prepare(diff.Statement); err != nil {
+			return 0, err
+		}
+		prepared[diff.Statement] = stmt
+	}
+	return rowsAffected(stmt.Exec(args...))
+}
+
+// foreignKeysPragma reports whether stmt is PRAGMA foreign_keys = ON/OFF,
+// and which
+func foreignKeysPragma(stmt string) (on, ok bool) {
+	words := leadingKeywords(stmt, 3)
+	if len(words) < 3 || words[0] != "PRAGMA" || words[1] != "FOREIGN_KEYS" {
+		return false, false
+	}
+	switch words[2] {
+	case "ON", "1", "TRUE", "YES":
+		return true, true
+	default:
+		return false, true
+	}
+}
+
+// mysqlImplicitCommit reports whether MySQL commits the open transaction
+// when running stmt. Temporary tables are the exception among DDL.
+func mysqlImplicitCommit(stmt string) bool {
+	words := leadingKeywords(stmt, 2)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "ALTER", "CREATE", "DROP", "RENAME", "TRUNCATE", "GRANT", "REVOKE", "LOCK", "UNLOCK",
+		"ANALYZE", "OPTIMIZE", "REPAIR", "CACHE", "FLUSH", "INSTALL", "UNINSTALL":
+		return len(words) < 2 || words[1] != "TEMPORARY"
+	}
+	return false
+}
+
+// leadingKeywords returns up to n leading words of a statement in upper
+// case, skipping comments and punctuation
+func leadingKeywords(stmt string, n int) []string {
+	var words []string
+	for i := 0; i < len(stmt) && len(words) < n; {
+		switch {
+		case strings.HasPrefix(stmt[i:], "--"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				return words
+			}
+			i += end + 1
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return words
+			}
+			i += end + 4
+		case isWordByte(stmt[i]) || stmt[i] == '_':
+			j := i
+			for j < len(stmt) && (isWordByte(stmt[j]) || stmt[j] == '_') {
+				j++
+			}
+			words = append(words, strings.ToUpper(stmt[i:j]))
+			i = j
+		default:
+			i++
+		}
+	}
+	return words
+}
+
+// splitSQLStatements splits SQL string into individual statements.
+// Semicolons inside strings, quoted identifiers, comments, PostgreSQL
+// dollar-quoted bodies and the BEGIN ... END body of a trigger or routine
+// do not end a statement. MySQL string literals may also escape a quote
+// with a backslash.
+func splitSQLStatements(dbType DBType, sql string) []string {
+	backslashEscapes := dbType == MySQL || dbType == ""
+	var statements []string
+	var current strings.Builder
+	var words []string // leading keywords of the current statement
+	depth := 0         // BEGIN/CASE ... END nesting inside a routine body
+	pendingBegin := false
+	// Set after an END that closed a block, until the next word shows
+	// whether it was END IF, END LOOP and so on instead
+	pendingEnd := false
+
+	flush := func() {
+		stmt := strings.TrimSpace(current.String())
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+		words = nil
+		depth = 0
+		pendingBegin = false
+		pendingEnd = false
+	}
+
+	isRoutine := func() bool {
+		if len(words) == 0 || words[0] != "CREATE" {
+			return false
+		}
+		for _, w := range words[1:] {
+			switch w {
+			case "TRIGGER", "PROCEDURE", "PROC", "FUNCTION":
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+
+		// Copy quoted or commented spans through unchanged
+		end := -1
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end = i + 1
+			for end < len(sql) {
+				if sql[end] == '\\' && backslashEscapes && c != '`' {
+					end += 2
+					continue
+				}
+				if sql[end] == c {
+					// Two consecutive quotes are an escaped quote
+					if end+1 < len(sql) && sql[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end++
+		case c == '[':
+			end = strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 1
+			}
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end = strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 1
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end = strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 4
+			}
+		case c == '$':
+			// Dollar quote: $$ or $tag$ ... matching tag
+			j := i + 1
+			for j < len(sql) && (sql[j] == '_' || isWordByte(sql[j])) {
+				j++
+			}
+			if j < len(sql) && sql[j] == '$' {
+				tag := sql[i : j+1]
+				if k := strings.Index(sql[j+1:], tag); k >= 0 {
+					end = j + 1 + k + len(tag)
+				} else {
+					end = len(sql)
+				}
+			}
+		}
+		if end != -1 {
+			if end > len(sql) || end < i {
+				end = len(sql)
+			}
+			current.WriteString(sql[i:end])
+			i = end
+			continue
+		}
+
+		if isWordByte(c) || c == '_' {
+			j := i
+			for j < len(sql) && (isWordByte(sql[j]) || sql[j] == '_') {
+				j++
+			}
+			word := strings.ToUpper(sql[i:j])
+			if len(words) < 8 {
+				words = append(words, word)
+			}
+			if isRoutine() {
+				// BEGIN TRANSACTION and the like open no block
+				if pendingBegin {
+					switch word {
+					case "TRAN", "TRANSACTION", "DISTRIBUTED", "DEFERRED", "IMMEDIATE", "EXCLUSIVE":
+						depth--
+					}
+					pendingBegin = false
+				}
+				// END IF, END LOOP, END WHILE and END REPEAT close a
+				// statement that opened no block, so the END closed
+				// nothing. END CASE closes the CASE it names.
+				closes := false
+				if pendingEnd {
+					switch word {
+					case "IF", "LOOP", "WHILE", "REPEAT":
+						depth++
+						closes = true
+					case "CASE":
+						closes = true
+					}
+					pendingEnd = false
+				}
+				switch {
+				case closes:
+				case word == "BEGIN":
+					depth++
+					pendingBegin = true
+				case word == "CASE":
+					depth++
+				case word == "END":
+					if depth > 0 {
+						depth--
+						pendingEnd = true
+					}
+				}
+			}
+			current.WriteString(sql[i:j])
+			i = j
+			continue
+		}
+
+		if !isSpaceByte(c) {
+			pendingEnd = false
+		}
+		if c == ';' && depth == 0 {
+			flush()
+			i++
+			continue
+		}
+		current.WriteByte(c)
+		i++
+	}
+
+	// Add any remaining statement
+	flush()
+
+	return statements
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
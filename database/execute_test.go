@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		dbType DBType
+		sql    string
+		want   []string
+	}{
+		{
+			name: "plain statements",
+			sql:  "SELECT 1; SELECT 2;\nSELECT 3",
+			want: []string{"SELECT 1", "SELECT 2", "SELECT 3"},
+		},
+		{
+			name: "semicolons in strings, identifiers and comments",
+			sql:  "SELECT 'a;b', \"c;d\", `e;f`, [g;h]; -- x;y\nSELECT /* ; */ 2",
+			want: []string{"SELECT 'a;b', \"c;d\", `e;f`, [g;h]", "-- x;y\nSELECT /* ; */ 2"},
+		},
+		{
+			name: "doubled quotes",
+			sql:  "SELECT 'it''s; fine'; SELECT 2",
+			want: []string{"SELECT 'it''s; fine'", "SELECT 2"},
+		},
+		{
+			name:   "mysql backslash escapes",
+			dbType: MySQL,
+			sql:    `INSERT INTO a VALUES ('a\'; DROP x', "b\"; c", 'd\\'); SELECT 2`,
+			want:   []string{`INSERT INTO a VALUES ('a\'; DROP x', "b\"; c", 'd\\')`, "SELECT 2"},
+		},
+		{
+			name:   "generated mysql literals",
+			dbType: MySQL,
+			sql:    "INSERT INTO a VALUES (" + quoteString(MySQL, `a\'; DROP x`) + "); SELECT 2",
+			want:   []string{"INSERT INTO a VALUES (" + quoteString(MySQL, `a\'; DROP x`) + ")", "SELECT 2"},
+		},
+		{
+			name:   "postgres backslash is literal",
+			dbType: PostgreSQL,
+			sql:    `SELECT 'a\'; SELECT 2`,
+			want:   []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name: "mysql procedure with control flow",
+			sql:  "CREATE PROCEDURE p() BEGIN IF 1 THEN SELECT 1; END IF; SELECT 2; END; SELECT 3",
+			want: []string{"CREATE PROCEDURE p() BEGIN IF 1 THEN SELECT 1; END IF; SELECT 2; END", "SELECT 3"},
+		},
+		{
+			name: "mysql loops",
+			sql: "CREATE PROCEDURE p() BEGIN l: LOOP LEAVE l; END LOOP l; " +
+				"WHILE 0 DO SELECT 1; END WHILE; REPEAT SELECT 1; UNTIL 1 END REPEAT; END; SELECT 3",
+			want: []string{
+				"CREATE PROCEDURE p() BEGIN l: LOOP LEAVE l; END LOOP l; " +
+					"WHILE 0 DO SELECT 1; END WHILE; REPEAT SELECT 1; UNTIL 1 END REPEAT; END",
+				"SELECT 3",
+			},
+		},
+		{
+			name: "case statement and case expression",
+			sql: "CREATE FUNCTION f(x INT) RETURNS INT BEGIN CASE x WHEN 1 THEN RETURN 1; ELSE RETURN 2; END CASE; " +
+				"RETURN CASE WHEN x > 0 THEN 1 ELSE 0 END; END; SELECT 3",
+			want: []string{
+				"CREATE FUNCTION f(x INT) RETURNS INT BEGIN CASE x WHEN 1 THEN RETURN 1; ELSE RETURN 2; END CASE; " +
+					"RETURN CASE WHEN x > 0 THEN 1 ELSE 0 END; END",
+				"SELECT 3",
+			},
+		},
+		{
+			name: "nested blocks followed by if",
+			sql:  "CREATE PROCEDURE p() BEGIN BEGIN SELECT 1; END; IF 1 THEN SELECT 2; END IF; END; SELECT 3",
+			want: []string{"CREATE PROCEDURE p() BEGIN BEGIN SELECT 1; END; IF 1 THEN SELECT 2; END IF; END", "SELECT 3"},
+		},
+		{
+			name: "mysql trigger",
+			sql: "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN IF NEW.x < 0 THEN SET NEW.x = 0; END IF; END;\n" +
+				"INSERT INTO a VALUES (1)",
+			want: []string{
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN IF NEW.x < 0 THEN SET NEW.x = 0; END IF; END",
+				"INSERT INTO a VALUES (1)",
+			},
+		},
+		{
+			name: "single statement trigger",
+			sql:  "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.x = 0; SELECT 1",
+			want: []string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.x = 0", "SELECT 1"},
+		},
+		{
+			name:   "sqlite trigger",
+			dbType: SQLite,
+			sql:    "CREATE TRIGGER t AFTER DELETE ON a BEGIN DELETE FROM b WHERE id = OLD.id; END; SELECT 1",
+			want:   []string{"CREATE TRIGGER t AFTER DELETE ON a BEGIN DELETE FROM b WHERE id = OLD.id; END", "SELECT 1"},
+		},
+		{
+			name:   "sql server begin transaction inside procedure",
+			dbType: SQLServer,
+			sql:    "CREATE PROCEDURE p AS BEGIN BEGIN TRANSACTION; SELECT 1; COMMIT; END; SELECT 2",
+			want:   []string{"CREATE PROCEDURE p AS BEGIN BEGIN TRANSACTION; SELECT 1; COMMIT; END", "SELECT 2"},
+		},
+		{
+			name:   "postgres dollar-quoted body",
+			dbType: PostgreSQL,
+			sql: "CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN IF NEW.x < 0 THEN NEW.x := 0; END IF; RETURN NEW; END; $$ LANGUAGE plpgsql;\n" +
+				"SELECT 1",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN IF NEW.x < 0 THEN NEW.x := 0; END IF; RETURN NEW; END; $$ LANGUAGE plpgsql",
+				"SELECT 1",
+			},
+		},
+		{
+			name:   "postgres tagged dollar quote",
+			dbType: PostgreSQL,
+			sql:    "DO $body$ BEGIN PERFORM 1; END $body$; SELECT 1",
+			want:   []string{"DO $body$ BEGIN PERFORM 1; END $body$", "SELECT 1"},
+		},
+		{
+			name: "begin outside a routine",
+			sql:  "BEGIN; SELECT 1; END;",
+			want: []string{"BEGIN", "SELECT 1", "END"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.dbType, tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeScriptTx records statements and fails the one at failAt (1-based)
+type fakeScriptTx struct {
+	failAt     int
+	executed   []string
+	rolledBack bool
+}
+
+func (f *fakeScriptTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if len(f.executed)+1 == f.failAt {
+		return nil, errors.New("boom")
+	}
+	f.executed = append(f.executed, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (f *fakeScriptTx) Rollback() error {
+	f.rolledBack = true
+	return nil
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name          string
+		dbType        DBType
+		statements    []string
+		failAt        int
+		wantOK        bool
+		wantRolled    bool
+		wantPartial   bool
+		wantCommitted int
+		wantErr       string
+	}{
+		{
+			name:       "success",
+			dbType:     MySQL,
+			statements: []string{"INSERT INTO a VALUES (1)", "CREATE TABLE b (x INT)"},
+			wantOK:     true,
+		},
+		{
+			name:       "mysql failure before any ddl rolls back",
+			dbType:     MySQL,
+			statements: []string{"INSERT INTO a VALUES (1)", "INSERT INTO a VALUES (2)", "CREATE TABLE b (x INT)"},
+			failAt:     2,
+			wantRolled: true,
+			wantErr:    "statement 2 of 3 failed: boom (rolled back)",
+		},
+		{
+			name:   "mysql failure after ddl keeps everything executed",
+			dbType: MySQL,
+			statements: []string{
+				"INSERT INTO a VALUES (1)", "ALTER TABLE a ADD y INT", "INSERT INTO a VALUES (2)", "INSERT INTO a VALUES (3)",
+			},
+			failAt:        4,
+			wantPartial:   true,
+			wantCommitted: 3,
+			wantErr:       "statement 4 of 4 failed: boom (statements 1-3 were committed implicitly and not rolled back)",
+		},
+		{
+			name:          "mysql failing ddl still commits what ran before it",
+			dbType:        MySQL,
+			statements:    []string{"INSERT INTO a VALUES (1)", "DROP TABLE missing"},
+			failAt:        2,
+			wantPartial:   true,
+			wantCommitted: 1,
+			wantErr:       "statement 2 of 2 failed: boom (statement 1 was committed implicitly and not rolled back)",
+		},
+		{
+			name:        "mysql failing first ddl",
+			dbType:      MySQL,
+			statements:  []string{"DROP TABLE missing", "INSERT INTO a VALUES (1)"},
+			failAt:      1,
+			wantPartial: true,
+			wantErr:     "statement 1 of 2 failed: boom (the failed statement committed implicitly; nothing was rolled back)",
+		},
+		{
+			name:       "mysql temporary table does not commit",
+			dbType:     MySQL,
+			statements: []string{"CREATE TEMPORARY TABLE t (x INT)", "INSERT INTO t VALUES (1)"},
+			failAt:     2,
+			wantRolled: true,
+			wantErr:    "statement 2 of 2 failed: boom (rolled back)",
+		},
+		{
+			name:       "postgres ddl rolls back",
+			dbType:     PostgreSQL,
+			statements: []string{"ALTER TABLE a ADD y INT", "INSERT INTO a VALUES (2)"},
+			failAt:     2,
+			wantRolled: true,
+			wantErr:    "statement 2 of 2 failed: boom (rolled back)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeScriptTx{failAt: tt.failAt}
+			result := &ExecutionResult{Total: len(tt.statements)}
+			ok := runScript(context.Background(), tx, tt.dbType, tt.statements, result)
+			if ok != tt.wantOK {
+				t.Fatalf("runScript() = %v, want %v", ok, tt.wantOK)
+			}
+			if result.RolledBack != tt.wantRolled || result.PartiallyCommitted != tt.wantPartial || result.Committed != tt.wantCommitted {
+				t.Errorf("RolledBack, PartiallyCommitted, Committed = %v, %v, %d, want %v, %v, %d",
+					result.RolledBack, result.PartiallyCommitted, result.Committed, tt.wantRolled, tt.wantPartial, tt.wantCommitted)
+			}
+			if !tt.wantOK && !tx.rolledBack {
+				t.Error("transaction was not rolled back")
+			}
+			err := result.Err()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Err() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("Err() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ForeignKeyInfo holds a foreign key constraint
+type ForeignKeyInfo struct {
+	Name              string   `json:"name"`
+	Columns           []string `json:"columns"`
+	ReferencedSchema  string   `json:"referencedSchema,omitempty"` // empty for the default schema
+	ReferencedTable   string   `json:"referencedTable"`
+	ReferencedColumns []string `json:"referencedColumns"`
+	OnUpdate          string   `json:"onUpdate"`
+	OnDelete          string   `json:"onDelete"`
+}
+
+// appendForeignKeyColumn adds one column row of a constraint, merging it into
+// the previous entry when the query returned several columns for the same key
+func appendForeignKeyColumn(fks []ForeignKeyInfo, name, column, refTable, refColumn, onUpdate, onDelete string) []ForeignKeyInfo {
+	if n := len(fks); n > 0 && fks[n-1].Name == name {
+		fks[n-1].Columns = append(fks[n-1].Columns, column)
+		if refColumn != "" {
+			fks[n-1].ReferencedColumns = append(fks[n-1].ReferencedColumns, refColumn)
+		}
+		return fks
+	}
+	fk := ForeignKeyInfo{
+		Name:            name,
+		Columns:         []string{column},
+		ReferencedTable: refTable,
+		OnUpdate:        normalizeReferentialAction(onUpdate),
+		OnDelete:        normalizeReferentialAction(onDelete),
+	}
+	if refColumn != "" {
+		fk.ReferencedColumns = []string{refColumn}
+	}
+	return append(fks, fk)
+}
+
+// normalizeReferentialAction maps engine spellings such as SET_NULL to SET NULL
+func normalizeReferentialAction(action string) string {
+	action = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(action), "_", " "))
+	if action == "" {
+		return "NO ACTION"
+	}
+	return action
+}
+
+func getMySQLForeignKeys(db *sql.DB, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(`
+		SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME,
+			r.UPDATE_RULE, r.DELETE_RULE
+		FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
+		JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS r
+			ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+			AND r.TABLE_NAME = k.TABLE_NAME
+		WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKeyInfo
+	for rows.Next() {
+		var name, col, refTable, refCol, onUpdate, onDelete string
+		if err := rows.Scan(&name, &col, &refTable, &refCol, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+		fks = appendForeignKeyColumn(fks, name, col, refTable, refCol, onUpdate, onDelete)
+	}
+	return fks, rows.Err()
+}
+
+func getPostgreSQLForeignKeys(db *sql.DB, schema, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(`
+		SELECT con.conname, a.attname, rns.nspname, rt.relname, ra.attname, con.confupdtype, con.confdeltype
+		FROM pg_constraint con
+		JOIN pg_class t ON t.oid = con.conrelid
+		JOIN pg_namespace ns ON ns.oid = t.relnamespace
+		JOIN pg_class rt ON rt.oid = con.confrelid
+		JOIN pg_namespace rns ON rns.oid = rt.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refnum, ord)
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refnum
+		WHERE con.contype = 'f' AND ns.nspname = $1 AND t.relname = $2
+		ORDER BY con.conname, k.ord`, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// pg_constraint stores actions as single-letter codes
+	actions := map[string]string{"a": "NO ACTION", "r": "RESTRICT", "c": "CASCADE", "n": "SET NULL", "d": "SET DEFAULT"}
+
+	var fks []ForeignKeyInfo
+	for rows.Next() {
+		var name, col, refSchema, refTable, refCol, onUpdate, onDelete string
+		if err := rows.Scan(&name, &col, &refSchema, &refTable, &refCol, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+		fks = appendForeignKeyColumn(fks, name, col, refTable, refCol, actions[onUpdate], actions[onDelete])
+		fks[len(fks)-1].ReferencedSchema = localSchema(PostgreSQL, refSchema)
+	}
+	return fks, rows.Err()
+}
+
+func getSQLiteForeignKeys(db *sql.DB, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA foreign_key_list('%s')", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKeyInfo
+	lastID := -1
+	for rows.Next() {
+		var id, seq int
+		var refTable, from, onUpdate, onDelete, match string
+		var to sql.NullString
+		if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, err
+		}
+		// SQLite constraints are unnamed; rows of one key share an id
+		if id != lastID {
+			fks = append(fks, ForeignKeyInfo{
+				ReferencedTable: refTable,
+				OnUpdate:        normalizeReferentialAction(onUpdate),
+				OnDelete:        normalizeReferentialAction(onDelete),
+			})
+			lastID = id
+		}
+		fk := &fks[len(fks)-1]
+		fk.Columns = append(fk.Columns, from)
+		if to.Valid {
+			fk.ReferencedColumns = append(fk.ReferencedColumns, to.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Name keys by their columns so the same key matches across databases
+	for i := range fks {
+		fks[i].Name = fmt.Sprintf("fk_%s_%s", tableName, strings.Join(fks[i].Columns, "_"))
+	}
+	return fks, nil
+}
+
+func getSQLServerForeignKeys(db *sql.DB, schema, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(`
+		SELECT fk.name, pc.name, SCHEMA_NAME(rt.schema_id), rt.name, rc.name,
+			fk.update_referential_action_desc, fk.delete_referential_action_desc
+		FROM sys.foreign_keys fk
+		JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+		JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+		JOIN sys.tables rt ON rt.object_id = fk.referenced_object_id
+		JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+		WHERE fk.parent_object_id = OBJECT_ID(QUOTENAME(@p1) + '.' + QUOTENAME(@p2))
+		ORDER BY fk.name, fkc.constraint_column_id`, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKeyInfo
+	for rows.Next() {
+		var name, col, refSchema, refTable, refCol, onUpdate, onDelete string
+		if err := rows.Scan(&name, &col, &refSchema, &refTable, &refCol, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+		fks = appendForeignKeyColumn(fks, name, col, refTable, refCol, onUpdate, onDelete)
+		fks[len(fks)-1].ReferencedSchema = localSchema(SQLServer, refSchema)
+	}
+	return fks, rows.Err()
+}
+
+// referencedTableKey returns the SchemaInfo.Tables key of the referenced table
+func referencedTableKey(fk ForeignKeyInfo) string {
+	return tableKey(fk.ReferencedSchema, fk.ReferencedTable)
+}
+
+func foreignKeysEqual(a, b ForeignKeyInfo) bool {
+	return a.ReferencedSchema == b.ReferencedSchema && a.ReferencedTable == b.ReferencedTable &&
+		stringSlicesEqual(a.Columns, b.Columns) &&
+		stringSlicesEqual(a.ReferencedColumns, b.ReferencedColumns) &&
+		a.OnUpdate == b.OnUpdate && a.OnDelete == b.OnDelete
+}
+
+// foreignKeyClause renders the constraint body shared by CREATE TABLE and
+// ALTER TABLE ... ADD CONSTRAINT
+func foreignKeyClause(dbType DBType, fk ForeignKeyInfo) string {
+	clause := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s",
+		quoteIdentifier(dbType, fk.Name), quoteColumns(dbType, fk.Columns), qualifiedName(dbType, fk.ReferencedSchema, fk.ReferencedTable))
+	if len(fk.ReferencedColumns) > 0 {
+		clause += fmt.Sprintf(" (%s)", quoteColumns(dbType, fk.ReferencedColumns))
+	}
+	for _, action := range []struct{ event, rule string }{{"DELETE", fk.OnDelete}, {"UPDATE", fk.OnUpdate}} {
+		// SQL Server has no RESTRICT; NO ACTION behaves the same there
+		if action.rule == "" || action.rule == "NO ACTION" || (dbType == SQLServer && action.rule == "RESTRICT") {
+			continue
+		}
+		clause += fmt.Sprintf(" ON %s %s", action.event, action.rule)
+	}
+	return clause
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAppendForeignKeyColumn(t *testing.T) {
+	var fks []ForeignKeyInfo
+	fks = appendForeignKeyColumn(fks, "fk_line_order", "order_id", "orders", "id", "", "CASCADE")
+	fks = appendForeignKeyColumn(fks, "fk_line_order", "order_rev", "orders", "rev", "", "CASCADE")
+	fks = appendForeignKeyColumn(fks, "fk_line_product", "product_id", "products", "id", "set_null", "restrict")
+
+	want := []ForeignKeyInfo{
+		{Name: "fk_line_order", Columns: []string{"order_id", "order_rev"}, ReferencedTable: "orders",
+			ReferencedColumns: []string{"id", "rev"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE"},
+		{Name: "fk_line_product", Columns: []string{"product_id"}, ReferencedTable: "products",
+			ReferencedColumns: []string{"id"}, OnUpdate: "SET NULL", OnDelete: "RESTRICT"},
+	}
+	if !reflect.DeepEqual(fks, want) {
+		t.Errorf("foreign keys = %+v, want %+v", fks, want)
+	}
+}
+
+func TestForeignKeyClause(t *testing.T) {
+	fk := ForeignKeyInfo{Name: "fk_line_order", Columns: []string{"order_id"}, ReferencedSchema: "sales",
+		ReferencedTable: "orders", ReferencedColumns: []string{"id"}, OnUpdate: "RESTRICT", OnDelete: "CASCADE"}
+	tests := []struct {
+		dbType DBType
+		want   string
+	}{
+		{PostgreSQL, `CONSTRAINT "fk_line_order" FOREIGN KEY ("order_id") REFERENCES "sales"."orders" ("id") ON DELETE CASCADE ON UPDATE RESTRICT`},
+		{SQLServer, "CONSTRAINT [fk_line_order] FOREIGN KEY ([order_id]) REFERENCES [sales].[orders] ([id]) ON DELETE CASCADE"},
+		{MySQL, "CONSTRAINT `fk_line_order` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT"},
+	}
+	for _, tt := range tests {
+		if got := foreignKeyClause(tt.dbType, fk); got != tt.want {
+			t.Errorf("%s: foreignKeyClause =\n%s\nwant\n%s", tt.dbType, got, tt.want)
+		}
+	}
+}
+
+func TestGetSQLiteForeignKeys(t *testing.T) {
+	db, err := Connect(ConnectionConfig{Type: SQLite, FilePath: filepath.Join(t.TempDir(), "fk.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE orders (id INTEGER, rev INTEGER, PRIMARY KEY (id, rev))",
+		"CREATE TABLE customers (id INTEGER PRIMARY KEY)",
+		`CREATE TABLE lines (
+			order_id INTEGER, order_rev INTEGER, customer_id INTEGER,
+			FOREIGN KEY (order_id, order_rev) REFERENCES orders (id, rev) ON DELETE CASCADE,
+			FOREIGN KEY (customer_id) REFERENCES customers ON UPDATE SET NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fks, err := getSQLiteForeignKeys(db, "lines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]ForeignKeyInfo)
+	for _, fk := range fks {
+		byName[fk.Name] = fk
+	}
+	want := map[string]ForeignKeyInfo{
+		"fk_lines_order_id_order_rev": {Name: "fk_lines_order_id_order_rev", Columns: []string{"order_id", "order_rev"},
+			ReferencedTable: "orders", ReferencedColumns: []string{"id", "rev"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE"},
+		// A reference to the primary key without columns has none listed
+		"fk_lines_customer_id": {Name: "fk_lines_customer_id", Columns: []string{"customer_id"},
+			ReferencedTable: "customers", OnUpdate: "SET NULL", OnDelete: "NO ACTION"},
+	}
+	if !reflect.DeepEqual(byName, want) {
+		t.Errorf("foreign keys = %+v, want %+v", byName, want)
+	}
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MigrationPlan holds schema diffs in an order that can be executed as a script
+type MigrationPlan struct {
+	Steps []DiffResult `json:"steps"`
+	// Foreign keys taken out of CREATE/DROP TABLE to break reference cycles
+	DeferredConstraints []string `json:"deferredConstraints"`
+	SQL                 string   `json:"sql"`
+}
+
+// Plan phases, executed in this order
+const (
+	phaseDropForeignKeys = iota
+	phaseDropTriggers
+	phaseDropViews
+	phaseDropRoutines
+	phaseDropTables
+	phaseCreateTables
+	phaseAlterTables
+	phaseCreateRoutines
+	phaseCreateViews
+	phaseCreateTriggers
+	phaseAddForeignKeys
+)
+
+// PlanMigration orders the diffs from CompareSchemas so that every statement
+// runs after the objects it references exist and before the objects that
+// reference it are dropped. Tables are created parents first and dropped
+// children first; foreign keys forming a cycle are created after all tables,
+// or dropped before any of them. Views follow the tables and views they
+// select from, and are dropped and created again around changes to the
+// columns of those tables. Triggers come after the tables and routines
+// they use.
+func PlanMigration(source, target *SchemaInfo, diffs []DiffResult) *MigrationPlan {
+	gen := newDDLGenerator(target.Type, source.Type)
+	plan := &MigrationPlan{}
+
+	phases := make([][]DiffResult, phaseAddForeignKeys+1)
+	var created, dropped, altered []string
+	createdViews := make(map[string]DiffResult)
+	droppedViews := make(map[string]DiffResult)
+	for _, diff := range diffs {
+		if diff.ObjectType == "column" && (diff.Action == "drop" || diff.Action == "alter") {
+			altered = append(altered, diff.TableName)
+		}
+		switch {
+		case diff.ObjectType == "table" && diff.Action == "create":
+			created = append(created, diff.TableName)
+		case diff.ObjectType == "table" && diff.Action == "drop":
+			dropped = append(dropped, diff.TableName)
+		case diff.ObjectType == "foreignKey" && diff.Action == "drop":
+			phases[phaseDropForeignKeys] = append(phases[phaseDropForeignKeys], diff)
+		case diff.ObjectType == "foreignKey" && diff.Action == "create":
+			phases[phaseAddForeignKeys] = append(phases[phaseAddForeignKeys], diff)
+		case diff.ObjectType == "view" && diff.Action == "drop":
+			droppedViews[diff.TableName] = diff
+		case diff.ObjectType == "view":
+			createdViews[diff.TableName] = diff
+		case diff.ObjectType == "trigger" && diff.Action == "drop":
+			phases[phaseDropTriggers] = append(phases[phaseDropTriggers], diff)
+		case diff.ObjectType == "trigger":
+			phases[phaseCreateTriggers] = append(phases[phaseCreateTriggers], diff)
+		case diff.ObjectType == "routine" && diff.Action == "drop":
+			phases[phaseDropRoutines] = append(phases[phaseDropRoutines], diff)
+		case diff.ObjectType == "routine":
+			phases[phaseCreateRoutines] = append(phases[phaseCreateRoutines], diff)
+		default:
+			phases[phaseAlterTables] = append(phases[phaseAlterTables], diff)
+		}
+	}
+
+	// Views selecting from a column being dropped or retyped block the change
+	// on PostgreSQL and SQLite, so they are dropped first and created again
+	// once the tables are altered
+	for viewKey := range dependentViews(target.Views, altered) {
+		if _, ok := droppedViews[viewKey]; ok {
+			continue
+		}
+		view := target.Views[viewKey].object()
+		droppedViews[viewKey] = DiffResult{
+			Type:       "modified",
+			TableName:  viewKey,
+			ObjectType: "view",
+			Action:     "drop",
+			Detail:     fmt.Sprintf("Drop %s until the tables it selects from are altered: %s", view.Kind, viewKey),
+			SQL:        joinStatements(gen.dropObject(view)),
+		}
+		diff, replaced := createdViews[viewKey]
+		switch {
+		case replaced && diff.SQL != "":
+			diff.SQL = joinStatements(gen.createObject(source.Views[viewKey].object()))
+		case replaced:
+			// Replacing it is left to the user, so the target's view comes back
+			diff.SQL = joinStatements(gen.createObject(view))
+		default:
+			diff = DiffResult{
+				Type:       "modified",
+				TableName:  viewKey,
+				ObjectType: "view",
+				Action:     "create",
+				Detail:     fmt.Sprintf("Recreate %s: %s", view.Kind, viewKey),
+				SQL:        joinStatements(gen.createObject(view)),
+			}
+		}
+		createdViews[viewKey] = diff
+	}
+
+	// Views cannot reference each other in a cycle, so nothing is cut here
+	order, _ := orderByDependencies(sortedKeys(createdViews), viewDependencies(source.Views))
+	for _, name := range order {
+		phases[phaseCreateViews] = append(phases[phaseCreateViews], createdViews[name])
+	}
+	order, _ = orderByDependencies(sortedKeys(droppedViews), viewDependencies(target.Views))
+	for i := len(order) - 1; i >= 0; i-- {
+		phases[phaseDropViews] = append(phases[phaseDropViews], droppedViews[order[i]])
+	}
+
+	// Creates: parents first, cyclic keys added once every table exists
+	order, cut := orderByReferences(created, source.Tables)
+	for _, tableName := range order {
+		table := source.Tables[tableName]
+		var deferred []ForeignKeyInfo
+		if fks := cut[tableName]; len(fks) > 0 {
+			table.ForeignKeys, deferred = splitForeignKeys(table.ForeignKeys, fks, func(fk ForeignKeyInfo) bool {
+				return gen.addForeignKey(table, fk) != nil
+			})
+		}
+		phases[phaseCreateTables] = append(phases[phaseCreateTables], createTableDiff(gen, source.Type, target.Type, tableName, table))
+		for _, fk := range deferred {
+			plan.DeferredConstraints = append(plan.DeferredConstraints, fk.Name)
+			phases[phaseAddForeignKeys] = append(phases[phaseAddForeignKeys], DiffResult{
+				Type:       "added",
+				TableName:  tableName,
+				ObjectType: "foreignKey",
+				Action:     "create",
+				Detail:     fmt.Sprintf("Add deferred foreign key: %s", fk.Name),
+				SQL:        joinStatements(gen.addForeignKey(table, fk)),
+			})
+		}
+	}
+
+	// Drops: the reverse, with cyclic keys dropped before any table
+	order, cut = orderByReferences(dropped, target.Tables)
+	for i := len(order) - 1; i >= 0; i-- {
+		tableName := order[i]
+		table := target.Tables[tableName]
+		for _, fk := range cut[tableName] {
+			stmts := gen.dropForeignKey(table, fk)
+			if stmts == nil {
+				continue
+			}
+			plan.DeferredConstraints = append(plan.DeferredConstraints, fk.Name)
+			phases[phaseDropForeignKeys] = append(phases[phaseDropForeignKeys], DiffResult{
+				Type:       "removed",
+				TableName:  tableName,
+				ObjectType: "foreignKey",
+				Action:     "drop",
+				Detail:     fmt.Sprintf("Drop foreign key before dropping table: %s", fk.Name),
+				SQL:        joinStatements(stmts),
+			})
+		}
+		phases[phaseDropTables] = append(phases[phaseDropTables], DiffResult{
+			Type:       "removed",
+			TableName:  tableName,
+			ObjectType: "table",
+			Action:     "drop",
+			Detail:     "Table exists in target but not in source",
+			SQL:        joinStatements(gen.dropTable(table)),
+		})
+	}
+
+	var sqlParts []string
+	for _, phase := range phases {
+		for _, step := range phase {
+			plan.Steps = append(plan.Steps, step)
+			if step.SQL != "" {
+				sqlParts = append(sqlParts, step.SQL)
+			}
+		}
+	}
+	plan.SQL = strings.Join(sqlParts, "\n\n")
+	return plan
+}
+
+// orderByReferences sorts tables so that each follows the tables it references
+// through foreign keys. Only references between the given tables count. When
+// the remaining tables wait on each other, a reference on a cycle is cut and
+// returned so the caller can apply those keys separately.
+func orderByReferences(names []string, tables map[string]TableInfo) ([]string, map[string][]ForeignKeyInfo) {
+	deps := make(map[string][]string)
+	for _, name := range names {
+		for _, fk := range tables[name].ForeignKeys {
+			// Self references are valid in a single CREATE TABLE
+			if ref := referencedTableKey(fk); ref != name {
+				deps[name] = append(deps[name], ref)
+			}
+		}
+	}
+
+	order, cutDeps := orderByDependencies(names, deps)
+	cut := make(map[string][]ForeignKeyInfo)
+	for name, refs := range cutDeps {
+		for _, fk := range tables[name].ForeignKeys {
+			for _, ref := range refs {
+				if referencedTableKey(fk) == ref {
+					cut[name] = append(cut[name], fk)
+				}
+			}
+		}
+	}
+	return order, cut
+}
+
+// orderByDependencies sorts names so that each follows its dependencies,
+// ignoring dependencies outside names. Ties are broken alphabetically. When
+// every remaining name waits on another, one dependency on a cycle is cut
+// at a time until a name is free, and the cut ones are returned.
+func orderByDependencies(names []string, deps map[string][]string) ([]string, map[string][]string) {
+	inSet := make(map[string]bool)
+	for _, name := range names {
+		inSet[name] = true
+	}
+
+	pending := make(map[string]map[string]bool)
+	dependents := make(map[string][]string)
+	for _, name := range names {
+		pending[name] = make(map[string]bool)
+		for _, dep := range deps[name] {
+			if !inSet[dep] || pending[name][dep] {
+				continue
+			}
+			pending[name][dep] = true
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	remaining := append([]string(nil), names...)
+	sort.Strings(remaining)
+	cut := make(map[string][]string)
+	var order []string
+
+	for len(remaining) > 0 {
+		next := -1
+		for i, name := range remaining {
+			if len(pending[name]) == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			from, dep := cycleEdge(remaining[0], pending)
+			delete(pending[from], dep)
+			cut[from] = append(cut[from], dep)
+			sort.Strings(cut[from])
+			continue
+		}
+
+		name := remaining[next]
+		order = append(order, name)
+		for _, dependent := range dependents[name] {
+			delete(pending[dependent], name)
+		}
+		pending[name] = nil
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return order, cut
+}
+
+// cycleEdge follows pending dependencies from start, which all wait on
+// another name, until one repeats, and returns the dependency that closes
+// the cycle. Names leading into a cycle are not on it and keep theirs.
+func cycleEdge(start string, pending map[string]map[string]bool) (string, string) {
+	seen := make(map[string]bool)
+	name := start
+	for {
+		seen[name] = true
+		deps := make([]string, 0, len(pending[name]))
+		for dep := range pending[name] {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		if seen[deps[0]] {
+			return name, deps[0]
+		}
+		name = deps[0]
+	}
+}
+
+// viewDependencies maps each view to the objects it selects from
+func viewDependencies(views map[string]ViewInfo) map[string][]string {
+	deps := make(map[string][]string)
+	for name, view := range views {
+		deps[name] = view.DependsOn
+	}
+	return deps
+}
+
+func sortedKeys(diffs map[string]DiffResult) []string {
+	keys := make([]string, 0, len(diffs))
+	for key := range diffs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitForeignKeys separates the cut keys that can be added later from the
+// keys that stay in the table definition
+func splitForeignKeys(all, cut []ForeignKeyInfo, canDefer func(ForeignKeyInfo) bool) (keep, deferred []ForeignKeyInfo) {
+	isCut := make(map[string]bool)
+	for _, fk := range cut {
+		isCut[fk.Name] = true
+	}
+	for _, fk := range all {
+		if isCut[fk.Name] && canDefer(fk) {
+			deferred = append(deferred, fk)
+		} else {
+			keep = append(keep, fk)
+		}
+	}
+	return keep, deferred
+}
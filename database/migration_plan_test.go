@@ -0,0 +1,160 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderByDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		names     []string
+		deps      map[string][]string
+		wantOrder []string
+		wantCut   map[string][]string
+	}{
+		{
+			name:      "chain",
+			names:     []string{"a", "b", "c"},
+			deps:      map[string][]string{"a": {"b"}, "b": {"c"}},
+			wantOrder: []string{"c", "b", "a"},
+			wantCut:   map[string][]string{},
+		},
+		{
+			name:      "ties alphabetical, outside dependencies ignored",
+			names:     []string{"b", "a", "c"},
+			deps:      map[string][]string{"c": {"a", "elsewhere"}},
+			wantOrder: []string{"a", "b", "c"},
+			wantCut:   map[string][]string{},
+		},
+		{
+			// a_log sorts first but only waits on the cycle, so it keeps its reference
+			name:      "two-cycle with a dependent",
+			names:     []string{"a_log", "orders", "users"},
+			deps:      map[string][]string{"a_log": {"orders"}, "orders": {"users"}, "users": {"orders"}},
+			wantOrder: []string{"users", "orders", "a_log"},
+			wantCut:   map[string][]string{"users": {"orders"}},
+		},
+		{
+			name:      "three-cycle",
+			names:     []string{"a", "b", "c"},
+			deps:      map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			wantOrder: []string{"c", "b", "a"},
+			wantCut:   map[string][]string{"c": {"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, cut := orderByDependencies(tt.names, tt.deps)
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("order = %v, want %v", order, tt.wantOrder)
+			}
+			if !reflect.DeepEqual(cut, tt.wantCut) {
+				t.Errorf("cut = %v, want %v", cut, tt.wantCut)
+			}
+		})
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	id := ColumnInfo{Name: "id", Type: "int", Nullable: "NO", Key: "PRI"}
+	ref := func(name, column, table string) ForeignKeyInfo {
+		return ForeignKeyInfo{Name: name, Columns: []string{column}, ReferencedTable: table, ReferencedColumns: []string{"id"}}
+	}
+	source := &SchemaInfo{Type: MySQL, Tables: map[string]TableInfo{
+		"a_log": {Name: "a_log", Columns: []ColumnInfo{id, {Name: "order_id", Type: "int", Nullable: "NO"}},
+			ForeignKeys: []ForeignKeyInfo{ref("fk_log_order", "order_id", "orders")}},
+		"orders": {Name: "orders", Columns: []ColumnInfo{id, {Name: "user_id", Type: "int", Nullable: "NO"}},
+			ForeignKeys: []ForeignKeyInfo{ref("fk_order_user", "user_id", "users")}},
+		"users": {Name: "users", Columns: []ColumnInfo{id, {Name: "last_order_id", Type: "int", Nullable: "YES"}},
+			ForeignKeys: []ForeignKeyInfo{ref("fk_user_last_order", "last_order_id", "orders")}},
+	}}
+	target := &SchemaInfo{Type: MySQL, Tables: map[string]TableInfo{
+		"old_items": {Name: "old_items", Columns: []ColumnInfo{id, {Name: "bucket_id", Type: "int"}},
+			ForeignKeys: []ForeignKeyInfo{ref("fk_item_bucket", "bucket_id", "old_buckets")}},
+		"old_buckets": {Name: "old_buckets", Columns: []ColumnInfo{id}},
+	}}
+	diffs := []DiffResult{
+		{ObjectType: "view", Action: "create", TableName: "v_orders", SQL: "CREATE VIEW v_orders AS SELECT * FROM orders"},
+		{ObjectType: "table", Action: "create", TableName: "a_log"},
+		{ObjectType: "table", Action: "drop", TableName: "old_buckets"},
+		{ObjectType: "table", Action: "create", TableName: "orders"},
+		{ObjectType: "table", Action: "drop", TableName: "old_items"},
+		{ObjectType: "table", Action: "create", TableName: "users"},
+	}
+
+	plan := PlanMigration(source, target, diffs)
+
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, step.Action+" "+step.ObjectType+" "+step.TableName)
+	}
+	want := []string{
+		"drop table old_items",
+		"drop table old_buckets",
+		"create table users",
+		"create table orders",
+		"create table a_log",
+		"create view v_orders",
+		"create foreignKey users",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("steps = %q, want %q", steps, want)
+	}
+	if !reflect.DeepEqual(plan.DeferredConstraints, []string{"fk_user_last_order"}) {
+		t.Errorf("deferred = %v, want [fk_user_last_order]", plan.DeferredConstraints)
+	}
+	if strings.Contains(plan.Steps[2].SQL, "fk_user_last_order") {
+		t.Errorf("users is created with its deferred key:\n%s", plan.Steps[2].SQL)
+	}
+	if !strings.Contains(plan.Steps[4].SQL, "fk_log_order") {
+		t.Errorf("a_log lost its key:\n%s", plan.Steps[4].SQL)
+	}
+	if !strings.Contains(plan.Steps[6].SQL, "ADD CONSTRAINT `fk_user_last_order`") {
+		t.Errorf("deferred key not added:\n%s", plan.Steps[6].SQL)
+	}
+}
+
+func TestPlanMigrationRecreatesDependentViews(t *testing.T) {
+	views := func(summary string) map[string]ViewInfo {
+		return map[string]ViewInfo{
+			"v_orders":  {Name: "v_orders", Definition: "CREATE VIEW v_orders AS SELECT id, total FROM orders", DependsOn: []string{"orders"}},
+			"v_summary": {Name: "v_summary", Definition: summary, DependsOn: []string{"v_orders"}},
+			"v_users":   {Name: "v_users", Definition: "CREATE VIEW v_users AS SELECT id FROM users", DependsOn: []string{"users"}},
+		}
+	}
+	source := &SchemaInfo{Type: PostgreSQL, Views: views("CREATE VIEW v_summary AS SELECT sum(total) AS total FROM v_orders")}
+	target := &SchemaInfo{Type: PostgreSQL, Views: views("CREATE VIEW v_summary AS SELECT count(*) AS n FROM v_orders")}
+	diffs := []DiffResult{
+		{ObjectType: "column", Action: "alter", TableName: "orders", SQL: `ALTER TABLE "public"."orders" ALTER COLUMN "total" TYPE numeric;`},
+		{ObjectType: "column", Action: "create", TableName: "users", SQL: `ALTER TABLE "public"."users" ADD COLUMN "name" text;`},
+		{ObjectType: "view", Action: "alter", TableName: "v_summary",
+			SQL: joinStatements(postgresDDL{}.replaceObject(target.Views["v_summary"].object(), source.Views["v_summary"].object()))},
+	}
+
+	plan := PlanMigration(source, target, diffs)
+
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, step.Action+" "+step.ObjectType+" "+step.TableName)
+	}
+	want := []string{
+		"drop view v_summary",
+		"drop view v_orders",
+		"alter column orders",
+		"create column users",
+		"create view v_orders",
+		"alter view v_summary",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("steps = %q, want %q", steps, want)
+	}
+	if got, want := plan.Steps[4].SQL, "CREATE VIEW v_orders AS SELECT id, total FROM orders;"; got != want {
+		t.Errorf("v_orders recreated as %q, want %q", got, want)
+	}
+	// The replaced view is only created, with the source's definition
+	if got, want := plan.Steps[5].SQL, "CREATE VIEW v_summary AS SELECT sum(total) AS total FROM v_orders;"; got != want {
+		t.Errorf("v_summary created as %q, want %q", got, want)
+	}
+}
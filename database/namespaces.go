@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PostgreSQL and SQL Server group tables into schemas inside a database.
+// Tables in the engine's default schema (public, dbo) keep their bare name
+// throughout the API with an empty Schema field, so single-schema setups and
+// comparisons across engines line up; tables elsewhere are keyed as
+// "schema.table".
+
+// defaultSchema returns the namespace unqualified names resolve to, or "" for
+// engines without schemas inside a database
+func defaultSchema(dbType DBType) string {
+	switch dbType {
+	case PostgreSQL:
+		return "public"
+	case SQLServer:
+		return "dbo"
+	default:
+		return ""
+	}
+}
+
+// selectedSchemas returns the schemas to read for a connection, falling back
+// to the default schema when none are selected
+func selectedSchemas(config ConnectionConfig) []string {
+	def := defaultSchema(config.Type)
+	if def == "" {
+		return nil
+	}
+	var schemas []string
+	for _, s := range config.Schemas {
+		if s = strings.TrimSpace(s); s != "" {
+			schemas = append(schemas, s)
+		}
+	}
+	if len(schemas) == 0 {
+		return []string{def}
+	}
+	return schemas
+}
+
+// localSchema returns the Schema field value for a namespace, which is empty
+// for the default schema
+func localSchema(dbType DBType, schema string) string {
+	if schema == defaultSchema(dbType) {
+		return ""
+	}
+	return schema
+}
+
+// schemaOrDefault returns the namespace a Schema field value stands for
+func schemaOrDefault(dbType DBType, schema string) string {
+	if schema == "" {
+		return defaultSchema(dbType)
+	}
+	return schema
+}
+
+// tableKey returns the name an object is listed under
+func tableKey(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// splitTableKey reverses tableKey. Keys of engines without schemas are
+// returned unchanged, since dots are valid in their table names.
+func splitTableKey(dbType DBType, key string) (schema, name string) {
+	if defaultSchema(dbType) == "" {
+		return "", key
+	}
+	if i := strings.Index(key, "."); i > 0 {
+		return localSchema(dbType, key[:i]), key[i+1:]
+	}
+	return "", key
+}
+
+// qualifiedName quotes a name together with its schema, spelling out the
+// default schema so the statement does not depend on the search path.
+// Engines without schemas get the bare name.
+func qualifiedName(dbType DBType, schema, name string) string {
+	if defaultSchema(dbType) == "" {
+		return quoteIdentifier(dbType, name)
+	}
+	schema = schemaOrDefault(dbType, schema)
+	return quoteIdentifier(dbType, schema) + "." + quoteIdentifier(dbType, name)
+}
+
+// qualifiedTable quotes a table's schema-qualified name
+func qualifiedTable(dbType DBType, table TableInfo) string {
+	return qualifiedName(dbType, table.Schema, table.Name)
+}
+
+// quoteTableName quotes a table key for use in a query
+func quoteTableName(dbType DBType, key string) string {
+	schema, name := splitTableKey(dbType, key)
+	return qualifiedName(dbType, schema, name)
+}
+
+// postgresSchemaFilter returns a condition matching any of the schemas,
+// bound as one array parameter numbered n
+func postgresSchemaFilter(schemas []string, n int) (string, []interface{}) {
+	return fmt.Sprintf("= ANY($%d)", n), []interface{}{pq.Array(schemas)}
+}
+
+// sqlServerSchemaFilter returns an IN list with one placeholder per schema,
+// numbered from first, since go-mssqldb cannot bind arrays
+func sqlServerSchemaFilter(schemas []string, first int) (string, []interface{}) {
+	placeholders := make([]string, len(schemas))
+	args := make([]interface{}, len(schemas))
+	for i, s := range schemas {
+		placeholders[i] = fmt.Sprintf("@p%d", first+i)
+		args[i] = s
+	}
+	return "IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// GetSchemaNames returns the schemas of a PostgreSQL or SQL Server database
+// that can be selected in ConnectionConfig.Schemas
+func GetSchemaNames(config ConnectionConfig) ([]string, error) {
+	var query string
+	switch config.Type {
+	case PostgreSQL:
+		query = `
+			SELECT nspname FROM pg_namespace
+			WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+			ORDER BY nspname`
+	case SQLServer:
+		// Schemas from 16384 up belong to the fixed database roles
+		query = `
+			SELECT name FROM sys.schemas
+			WHERE schema_id < 16384 AND name NOT IN ('sys', 'INFORMATION_SCHEMA', 'guest')
+			ORDER BY name`
+	default:
+		return []string{}, nil
+	}
+
+	db, err := Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := queryStrings(db, query)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row[0]
+	}
+	return names, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTableKey(t *testing.T) {
+	tests := []struct {
+		dbType     DBType
+		key        string
+		wantSchema string
+		wantName   string
+	}{
+		{PostgreSQL, "orders", "", "orders"},
+		{PostgreSQL, "sales.orders", "sales", "orders"},
+		{PostgreSQL, "public.orders", "", "orders"},
+		{PostgreSQL, "sales.order.lines", "sales", "order.lines"},
+		{SQLServer, "dbo.orders", "", "orders"},
+		{SQLServer, "hr.people", "hr", "people"},
+		{MySQL, "sales.orders", "", "sales.orders"},
+		{SQLite, "v1.2", "", "v1.2"},
+	}
+	for _, tt := range tests {
+		schema, name := splitTableKey(tt.dbType, tt.key)
+		if schema != tt.wantSchema || name != tt.wantName {
+			t.Errorf("%s: splitTableKey(%q) = %q, %q, want %q, %q", tt.dbType, tt.key, schema, name, tt.wantSchema, tt.wantName)
+		}
+		// Keys round-trip, except for the spelled-out default schema
+		if want := strings.TrimPrefix(strings.TrimPrefix(tt.key, "public."), "dbo."); tableKey(schema, name) != want {
+			t.Errorf("%s: tableKey(%q, %q) = %q, want %q", tt.dbType, schema, name, tableKey(schema, name), want)
+		}
+	}
+}
+
+func TestQuoteTableName(t *testing.T) {
+	tests := []struct {
+		dbType DBType
+		key    string
+		want   string
+	}{
+		{PostgreSQL, "orders", `"public"."orders"`},
+		{PostgreSQL, "sales.orders", `"sales"."orders"`},
+		{SQLServer, "orders", "[dbo].[orders]"},
+		{SQLServer, "hr.people", "[hr].[people]"},
+		{MySQL, "orders", "`orders`"},
+		{SQLite, "orders", `"orders"`},
+	}
+	for _, tt := range tests {
+		if got := quoteTableName(tt.dbType, tt.key); got != tt.want {
+			t.Errorf("%s: quoteTableName(%q) = %s, want %s", tt.dbType, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSchemaFilters(t *testing.T) {
+	schemas := selectedSchemas(ConnectionConfig{Type: PostgreSQL, Schemas: []string{" sales ", "", "public"}})
+	if want := []string{"sales", "public"}; !reflect.DeepEqual(schemas, want) {
+		t.Fatalf("selectedSchemas = %v, want %v", schemas, want)
+	}
+	if got := selectedSchemas(ConnectionConfig{Type: SQLServer}); !reflect.DeepEqual(got, []string{"dbo"}) {
+		t.Errorf("selectedSchemas without a selection = %v, want [dbo]", got)
+	}
+	if got := selectedSchemas(ConnectionConfig{Type: MySQL, Schemas: []string{"sales"}}); got != nil {
+		t.Errorf("selectedSchemas on MySQL = %v, want none", got)
+	}
+
+	filter, args := postgresSchemaFilter(schemas, 2)
+	if filter != "= ANY($2)" || !reflect.DeepEqual(args, []interface{}{pq.Array(schemas)}) {
+		t.Errorf("postgresSchemaFilter = %q, %v", filter, args)
+	}
+	filter, args = sqlServerSchemaFilter(schemas, 3)
+	if filter != "IN (@p3, @p4)" || !reflect.DeepEqual(args, []interface{}{"sales", "public"}) {
+		t.Errorf("sqlServerSchemaFilter = %q, %v", filter, args)
+	}
+}
+
+func TestCompareSchemasSameNameInTwoSchemas(t *testing.T) {
+	id := ColumnInfo{Name: "id", Type: "integer", Nullable: "NO"}
+	source := &SchemaInfo{Type: PostgreSQL, Tables: map[string]TableInfo{
+		"orders":       {Name: "orders", Columns: []ColumnInfo{id}},
+		"sales.orders": {Schema: "sales", Name: "orders", Columns: []ColumnInfo{id, {Name: "total", Type: "numeric", Nullable: "YES"}}},
+	}}
+	target := &SchemaInfo{Type: PostgreSQL, Tables: map[string]TableInfo{
+		"orders":       {Name: "orders", Columns: []ColumnInfo{id}},
+		"sales.orders": {Schema: "sales", Name: "orders", Columns: []ColumnInfo{id}},
+	}}
+
+	diffs := CompareSchemas(source, target)
+	if len(diffs) != 1 {
+		t.Fatalf("%d differences, want 1: %+v", len(diffs), diffs)
+	}
+	if diffs[0].TableName != "sales.orders" || !strings.Contains(diffs[0].SQL, `ALTER TABLE "sales"."orders" ADD COLUMN "total"`) {
+		t.Errorf("difference = %+v, want total added to sales.orders", diffs[0])
+	}
+
+	// Dropping the public table leaves the one in sales alone
+	delete(source.Tables, "orders")
+	diffs = CompareSchemas(source, target)
+	var dropped []string
+	for _, diff := range diffs {
+		if diff.Action == "drop" {
+			dropped = append(dropped, diff.TableName+": "+diff.SQL)
+		}
+	}
+	if want := []string{`orders: DROP TABLE "public"."orders";`}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("drops = %q, want %q", dropped, want)
+	}
+}
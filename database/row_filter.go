@@ -0,0 +1,249 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// filterKeywords start statements, write data or open a subquery, and have
+// no place in a row filter. SQL Server runs statements that are not
+// separated by a semicolon, so rejecting semicolons alone is not enough.
+var filterKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WITH": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "TABLE": true, "VALUES": true,
+	"ALTER": true, "ANALYZE": true, "ATTACH": true, "BACKUP": true, "BEGIN": true,
+	"CALL": true, "COMMIT": true, "COPY": true, "CREATE": true, "DECLARE": true,
+	"DELETE": true, "DETACH": true, "DO": true, "DROP": true, "EXEC": true,
+	"EXECUTE": true, "GRANT": true, "HANDLER": true, "INSERT": true, "INTO": true,
+	"KILL": true, "LOAD": true, "LOCK": true, "MERGE": true, "PRAGMA": true,
+	"REINDEX": true, "RENAME": true, "RESTORE": true, "REVOKE": true, "ROLLBACK": true,
+	"SAVEPOINT": true, "SET": true, "SHUTDOWN": true, "TRUNCATE": true, "UPDATE": true,
+	"USE": true, "VACUUM": true, "WAITFOR": true,
+}
+
+// filterFunctions stall the server, read files, run SQL given as text or
+// reach other servers, and may not be called in a row filter
+var filterFunctions = map[string]bool{
+	"SLEEP": true, "BENCHMARK": true, "GET_LOCK": true, "LOAD_FILE": true,
+	"PG_SLEEP": true, "PG_SLEEP_FOR": true, "PG_SLEEP_UNTIL": true,
+	"PG_READ_FILE": true, "PG_READ_BINARY_FILE": true, "PG_LS_DIR": true, "PG_STAT_FILE": true,
+	"LO_IMPORT": true, "LO_EXPORT": true, "LO_GET": true, "LO_FROM_BYTEA": true,
+	"DBLINK": true, "DBLINK_EXEC": true, "QUERY_TO_XML": true, "QUERY_TO_XML_AND_XMLSCHEMA": true,
+	"CURSOR_TO_XML": true, "TABLE_TO_XML": true, "DATABASE_TO_XML": true, "SCHEMA_TO_XML": true,
+	"SET_CONFIG": true, "NEXTVAL": true, "SETVAL": true,
+	"PG_TERMINATE_BACKEND": true, "PG_CANCEL_BACKEND": true, "PG_RELOAD_CONF": true,
+	"OPENROWSET": true, "OPENQUERY": true, "OPENDATASOURCE": true, "OPENXML": true, "XP_CMDSHELL": true,
+	"LOAD_EXTENSION": true, "READFILE": true, "WRITEFILE": true, "FTS3_TOKENIZER": true,
+}
+
+// validateFilter checks that a row filter is a single boolean expression
+// over the row that can be placed in a WHERE clause: no further
+// statements, comments, subqueries or functions with side effects. It
+// follows the engine's quoting rules, and rejects whatever engines disagree
+// on, such as backslash escapes and dollar quoting, rather than risk
+// reading a string differently than the server would.
+//
+// The filter still runs with the privileges of the connection and may call
+// any function not listed above, so it is no defence against a filter
+// written by someone who may not query the database themselves.
+func validateFilter(dbType DBType, filter string) error {
+	if strings.TrimSpace(filter) == "" {
+		return fmt.Errorf("filter is empty")
+	}
+
+	depth := 0
+	var word strings.Builder
+	runes := []rune(filter)
+	// endWord checks the word that ends before runes[i]. Quoted, it is an
+	// identifier rather than a keyword, but may still name a function.
+	endWord := func(i int, quoted bool) error {
+		w := strings.ToUpper(word.String())
+		word.Reset()
+		if filterKeywords[w] && !quoted {
+			return fmt.Errorf("filter may not contain %s", w)
+		}
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if filterFunctions[w] && i < len(runes) && runes[i] == '(' {
+			return fmt.Errorf("filter may not call %s", w)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			word.WriteRune(r)
+			continue
+		}
+		if err := endWord(i, false); err != nil {
+			return err
+		}
+
+		var next rune
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		// Quoted text ends at its closing quote, which is doubled to escape it
+		if closing := filterQuote(dbType, r); closing != 0 {
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					return fmt.Errorf("filter may not contain backslashes")
+				}
+				if runes[j] == closing {
+					if j+1 < len(runes) && runes[j+1] == closing {
+						j++
+						continue
+					}
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				return fmt.Errorf("filter has an unterminated %c", r)
+			}
+			// A quoted identifier can name a function too
+			if r != '\'' {
+				word.WriteString(string(runes[i+1 : end]))
+				if err := endWord(end+1, true); err != nil {
+					return err
+				}
+			}
+			i = end
+			continue
+		}
+
+		switch {
+		case r == ';':
+			return fmt.Errorf("filter may not contain semicolons")
+		case r == '-' && next == '-', r == '/' && next == '*', r == '#' && (dbType == MySQL || dbType == ""):
+			return fmt.Errorf("filter may not contain comments")
+		case r == '\\':
+			return fmt.Errorf("filter may not contain backslashes")
+		case r == '$':
+			return fmt.Errorf("filter may not contain $")
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("filter has unbalanced parentheses")
+			}
+		}
+	}
+	if err := endWord(len(runes), false); err != nil {
+		return err
+	}
+	if depth != 0 {
+		return fmt.Errorf("filter has unbalanced parentheses")
+	}
+	return nil
+}
+
+// filterQuote returns the quote closing text opened by r, or 0 when r opens
+// none on the engine
+func filterQuote(dbType DBType, r rune) rune {
+	switch {
+	case r == '\'', r == '"':
+		return r
+	case r == '`' && (dbType == MySQL || dbType == "" || dbType == SQLite):
+		return '`'
+	case r == '[' && (dbType == SQLServer || dbType == SQLite):
+		return ']'
+	}
+	return 0
+}
+
+// renameFilterColumns returns a filter written with source column names
+// with the columns names maps renamed to their target names, quoted for
+// dbType, the engine it runs on. Unquoted names match regardless of case;
+// string literals and function names are left alone.
+func renameFilterColumns(dbType DBType, filter string, names map[string]string) string {
+	if len(names) == 0 {
+		return filter
+	}
+	lookup := func(ident string, quoted bool) (string, bool) {
+		if name, ok := names[ident]; ok {
+			return name, true
+		}
+		if !quoted {
+			for col, name := range names {
+				if strings.EqualFold(col, ident) {
+					return name, true
+				}
+			}
+		}
+		return "", false
+	}
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+
+	var b strings.Builder
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if isWord(r) {
+			end := i
+			for end < len(runes) && isWord(runes[end]) {
+				end++
+			}
+			next := end
+			for next < len(runes) && unicode.IsSpace(runes[next]) {
+				next++
+			}
+			word := string(runes[i:end])
+			if name, ok := lookup(word, false); ok && (next == len(runes) || runes[next] != '(') {
+				word = quoteIdentifier(dbType, name)
+			}
+			b.WriteString(word)
+			i = end
+			continue
+		}
+
+		closing := filterQuote(dbType, r)
+		if closing == 0 {
+			b.WriteRune(r)
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (runes[end] != closing || end+1 < len(runes) && runes[end+1] == closing) {
+			if runes[end] == closing {
+				end++
+			}
+			end++
+		}
+		if end >= len(runes) {
+			b.WriteString(string(runes[i:]))
+			break
+		}
+		text := string(runes[i : end+1])
+		// MySQL reads double quotes as a string, like single ones
+		if r != '\'' && !(r == '"' && (dbType == MySQL || dbType == "")) {
+			ident := strings.ReplaceAll(string(runes[i+1:end]), string(closing)+string(closing), string(closing))
+			if name, ok := lookup(ident, true); ok {
+				text = quoteIdentifier(dbType, name)
+			}
+		}
+		b.WriteString(text)
+		i = end + 1
+	}
+	return b.String()
+}
+
+// withFilter adds a row filter to a WHERE clause as returned by keyRange
+func withFilter(where, filter string) string {
+	switch {
+	case filter == "":
+		return where
+	case where == "":
+		return " WHERE (" + filter + ")"
+	default:
+		return where + " AND (" + filter + ")"
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		dbType  DBType
+		filter  string
+		wantErr bool
+	}{
+		// Accepted
+		{MySQL, "tenant_id = 42", false},
+		{MySQL, "status IN ('new', 'paid') AND total > 10.5", false},
+		{MySQL, "name = 'it''s'", false},
+		{MySQL, "created_at > NOW() - INTERVAL 7 DAY", false},
+		{PostgreSQL, `"Select" = 1 AND lower(email) LIKE '%@example.com'`, false},
+		{PostgreSQL, "note = 'SELECT * FROM users; DROP TABLE x -- '", false},
+		{PostgreSQL, "coalesce(deleted, false) = false", false},
+		{SQLServer, "[from] IS NOT NULL AND YEAR(created) = 2024", false},
+		{SQLite, "`from` > 0", false},
+		{MySQL, "sleep_minutes > 10", false},
+		{MySQL, "sleep = 1", false},
+
+		// Further statements, comments and quoting tricks
+		{MySQL, "", true},
+		{MySQL, "   ", true},
+		{MySQL, "1 = 1; DROP TABLE users", true},
+		{SQLServer, "1 = 1 DROP TABLE users", true},
+		{SQLServer, "1 = 1 EXEC xp_cmdshell 'dir'", true},
+		{MySQL, "1 = 1 -- ", true},
+		{MySQL, "1 = 1 # ", true},
+		{PostgreSQL, "1 = 1 /* */", true},
+		{MySQL, `name = 'a\' OR 1 = 1`, true},
+		{PostgreSQL, "name = $$x$$", true},
+		{MySQL, "name = 'unterminated", true},
+		{MySQL, "(a = 1", true},
+		{MySQL, "a = 1)", true},
+		{PostgreSQL, "a = 1) OR (1 = 1", true},
+
+		// Subqueries
+		{PostgreSQL, "(SELECT password FROM users LIMIT 1) = 'x'", true},
+		{MySQL, "id IN (select id from admins)", true},
+		{PostgreSQL, "EXISTS (TABLE users)", true},
+		{PostgreSQL, "id IN (VALUES (1))", true},
+		{PostgreSQL, "id IN (WITH x AS (SELECT 1) SELECT * FROM x)", true},
+
+		// Functions with side effects
+		{PostgreSQL, "pg_sleep(100) IS NOT NULL", true},
+		{PostgreSQL, "pg_catalog.pg_sleep (100) IS NOT NULL", true},
+		{PostgreSQL, `"pg_sleep"(100) IS NOT NULL`, true},
+		{MySQL, "SLEEP(10) = 0", true},
+		{MySQL, "`sleep`(10) = 0", true},
+		{MySQL, "BENCHMARK(1000000, MD5('x')) = 0", true},
+		{MySQL, "LOAD_FILE('/etc/passwd') IS NOT NULL", true},
+		{PostgreSQL, "pg_read_file('/etc/passwd') <> ''", true},
+		{PostgreSQL, "query_to_xml('select 1', true, true, '') IS NOT NULL", true},
+		{PostgreSQL, "dblink('host=evil', 'select 1') IS NOT NULL", true},
+		{SQLServer, "EXISTS (SELECT * FROM OPENROWSET('SQLNCLI', 'x', 'y'))", true},
+		{SQLite, "load_extension('x') IS NULL", true},
+	}
+	for _, tt := range tests {
+		err := validateFilter(tt.dbType, tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateFilter(%s, %q) error = %v, wantErr %v", tt.dbType, tt.filter, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWithFilter(t *testing.T) {
+	tests := []struct {
+		where, filter, want string
+	}{
+		{"", "", ""},
+		{" WHERE id > 5", "", " WHERE id > 5"},
+		{"", "a = 1 OR b = 2", " WHERE (a = 1 OR b = 2)"},
+		{" WHERE id > 5", "a = 1 OR b = 2", " WHERE id > 5 AND (a = 1 OR b = 2)"},
+	}
+	for _, tt := range tests {
+		if got := withFilter(tt.where, tt.filter); got != tt.want {
+			t.Errorf("withFilter(%q, %q) = %q, want %q", tt.where, tt.filter, got, tt.want)
+		}
+	}
+}
+
+// newSQLiteFile creates a SQLite database in a temporary file, runs stmts on
+// it and returns its connection
+func newSQLiteFile(t *testing.T, name string, stmts ...string) ConnectionConfig {
+	t.Helper()
+	config := ConnectionConfig{Type: SQLite, FilePath: filepath.Join(t.TempDir(), name)}
+	db, err := Connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return config
+}
+
+func TestDataSyncSummaryFilter(t *testing.T) {
+	source := newSQLiteFile(t, "source.db",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, tenant_id INTEGER, total INTEGER)",
+		"INSERT INTO orders VALUES (1, 1, 10), (2, 1, 20), (3, 2, 30), (4, 2, 40)")
+	target := newSQLiteFile(t, "target.db",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, tenant_id INTEGER, total INTEGER)",
+		"INSERT INTO orders VALUES (1, 1, 11), (3, 2, 31), (5, 1, 50)")
+
+	info, err := GetDataSyncSummaryWithOptions(source, target, "orders", "", DataCompareOptions{Filter: "tenant_id = 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SourceCount != 2 || info.TargetCount != 2 || info.InsertCount != 1 || info.UpdateCount != 1 || info.DeleteCount != 1 {
+		t.Errorf("summary = %+v, want 2 source and 2 target rows, one insert, update and delete", info)
+	}
+
+	if _, err := GetDataSyncSummaryWithOptions(source, target, "orders", "", DataCompareOptions{Filter: "missing = 1"}); err == nil {
+		t.Error("filter on a missing column did not fail")
+	}
+}
+
+func TestRenameFilterColumns(t *testing.T) {
+	names := map[string]string{"tenant_id": "org_id", "Status": "state"}
+	tests := []struct {
+		dbType DBType
+		filter string
+		want   string
+	}{
+		{PostgreSQL, "tenant_id = 42", `"org_id" = 42`},
+		{PostgreSQL, `"tenant_id" = 42 AND TENANT_ID > 0`, `"org_id" = 42 AND "org_id" > 0`},
+		{PostgreSQL, `"Tenant_id" = 42`, `"Tenant_id" = 42`},
+		{PostgreSQL, "status = 'tenant_id' OR note = 'it''s tenant_id'", `"state" = 'tenant_id' OR note = 'it''s tenant_id'`},
+		{PostgreSQL, "tenant_ids = 1 AND tenant_id2 = 2", "tenant_ids = 1 AND tenant_id2 = 2"},
+		{MySQL, "`tenant_id` = 1 AND label = \"tenant_id\"", "`org_id` = 1 AND label = \"tenant_id\""},
+		{SQLServer, "[tenant_id] IN (1, 2) AND status (1) IS NULL", "[org_id] IN (1, 2) AND status (1) IS NULL"},
+		{SQLite, "coalesce(tenant_id, 0) = 1", `coalesce("org_id", 0) = 1`},
+	}
+	for _, tt := range tests {
+		if got := renameFilterColumns(tt.dbType, tt.filter, names); got != tt.want {
+			t.Errorf("%s: renameFilterColumns(%q) = %q, want %q", tt.dbType, tt.filter, got, tt.want)
+		}
+	}
+	if got := renameFilterColumns(MySQL, "tenant_id = 1", nil); got != "tenant_id = 1" {
+		t.Errorf("without renames the filter changed to %q", got)
+	}
+}
+
+func TestFilterOnRenamedColumn(t *testing.T) {
+	source := newSQLiteFile(t, "source.db",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, tenant_id INTEGER, total INTEGER)",
+		"INSERT INTO orders VALUES (1, 1, 10), (2, 1, 20), (3, 2, 30)")
+	target := newSQLiteFile(t, "target.db",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, org_id INTEGER, total INTEGER)",
+		"INSERT INTO orders VALUES (1, 1, 11), (3, 2, 31), (4, 1, 40)")
+	mapping := ColumnMapping{Rename: map[string]string{"tenant_id": "org_id"}}
+
+	info, err := GetDataSyncSummaryWithOptions(source, target, "orders", "", DataCompareOptions{Filter: "tenant_id = 1", Columns: mapping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SourceCount != 2 || info.TargetCount != 2 || info.InsertCount != 1 || info.UpdateCount != 1 || info.DeleteCount != 1 {
+		t.Errorf("summary = %+v, want 2 rows a side, one insert, update and delete", info)
+	}
+
+	// The filter may name a renamed column that is not compared
+	mapping.Include = []string{"total"}
+	diffs, err := CompareTableDataWithOptions(source, target, "orders", "", DataCompareOptions{Filter: "tenant_id = 1", Columns: mapping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Errorf("%d differences, want 3", len(diffs))
+	}
+}
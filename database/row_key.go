@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// tableInfo reads the structure of a table, named as by getTableNames
+func tableInfo(db *sql.DB, dbType DBType, tableName string) (*TableInfo, error) {
+	switch dbType {
+	case MySQL, "":
+		return getMySQLTableInfo(db, tableName)
+	case PostgreSQL:
+		schema, name := splitTableKey(PostgreSQL, tableName)
+		return getPostgreSQLTableInfo(db, schema, name)
+	case SQLite:
+		return getSQLiteTableInfo(db, tableName)
+	case SQLServer:
+		schema, name := splitTableKey(SQLServer, tableName)
+		return getSQLServerTableInfo(db, schema, name)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+// uniqueKeyColumns returns the columns of the unique index with the fewest
+// columns, all of them NOT NULL, or nil if the table has none. Partial and
+// filtered indexes are skipped since they leave the other rows unconstrained.
+func uniqueKeyColumns(table TableInfo) []string {
+	notNull := make(map[string]bool)
+	for _, col := range table.Columns {
+		notNull[col.Name] = strings.EqualFold(col.Nullable, "NO")
+	}
+
+	var best []string
+	for _, idx := range buildIndexDefs(table.Indexes) {
+		if !idx.Unique || idx.Primary || isPartialIndex(idx.Filter, idx.Definition) {
+			continue
+		}
+		usable := len(idx.Columns) > 0
+		for _, col := range idx.Columns {
+			if !notNull[col] {
+				usable = false
+				break
+			}
+		}
+		if usable && (best == nil || len(idx.Columns) < len(best)) {
+			best = idx.Columns
+		}
+	}
+	return best
+}
+
+// resolveKey picks the columns rows are matched on: the key declared in the
+// options, else the primary key, else a NOT NULL unique index. A table with
+// none of them is compared as a multiset of whole rows.
+func (c *tableComparison) resolveKey(database string, sourceColumns []ColumnInfo) error {
+	if len(c.options.KeyColumns) > 0 {
+		for _, key := range c.options.KeyColumns {
+			if _, ok := findColumn(sourceColumns, key); !ok {
+				return fmt.Errorf("source has no key column %s", key)
+			}
+		}
+		c.primaryKeys = c.options.KeyColumns
+		return nil
+	}
+
+	var err error
+	c.primaryKeys, err = getPrimaryKeys(c.sourceDB, c.sourceType, database, c.tableName)
+	if err != nil {
+		return err
+	}
+	if len(c.primaryKeys) > 0 {
+		return nil
+	}
+
+	info, err := tableInfo(c.sourceDB, c.sourceType, c.tableName)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes: %v", err)
+	}
+	c.primaryKeys = uniqueKeyColumns(*info)
+	c.multiset = len(c.primaryKeys) == 0
+	return nil
+}
+
+// keyColumns returns the columns that identify a row in its diff: the key,
+// or every compared column for a multiset comparison
+func (c *tableComparison) keyColumns() []string {
+	if c.multiset {
+		return c.columns
+	}
+	return c.primaryKeys
+}
+
+// compareMultiset matches rows of tables without a key by their values,
+// counting duplicates, and emits a delete for every target row and an
+// insert for every source row left unmatched. A changed row thus shows as
+// a delete and an insert.
+func (c *tableComparison) compareMultiset(emit func(DataDiffResult) error) error {
+	sourceRows, err := getTableRows(c.sourceDB, c.sourceType, c.tableName, c.columns, c.options.Filter, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get source data: %v", err)
+	}
+	targetRows, err := getTableRows(c.targetDB, c.targetType, c.targetTable, c.targetColumns, c.targetFilter, c.toSource)
+	if err != nil {
+		return fmt.Errorf("failed to get target data: %v", err)
+	}
+	for _, row := range sourceRows {
+		c.values.normalizeRow(row)
+	}
+	for _, row := range targetRows {
+		c.values.normalizeRow(row)
+	}
+
+	// Pair rows with the same canonical values first
+	available := make(map[string]int)
+	for _, row := range targetRows {
+		available[c.values.rowKey(c.columns, row)]++
+	}
+	matched := make(map[string]int)
+	var inserts []map[string]interface{}
+	for _, row := range sourceRows {
+		key := c.values.rowKey(c.columns, row)
+		if available[key] > 0 {
+			available[key]--
+			matched[key]++
+			continue
+		}
+		inserts = append(inserts, row)
+	}
+	var deletes []map[string]interface{}
+	for _, row := range targetRows {
+		key := c.values.rowKey(c.columns, row)
+		if matched[key] > 0 {
+			matched[key]--
+			continue
+		}
+		deletes = append(deletes, row)
+	}
+
+	// Then pair what is left by the comparison tolerances, which a canonical
+	// form cannot capture. Only unmatched rows are scanned.
+	taken := make([]bool, len(deletes))
+	for _, row := range inserts {
+		paired := false
+		for j, target := range deletes {
+			if !taken[j] && c.values.rowsEqual(row, target) {
+				taken[j] = true
+				paired = true
+				break
+			}
+		}
+		if !paired {
+			if err := emit(c.insertDiff(row)); err != nil {
+				return err
+			}
+		}
+	}
+	for j, row := range deletes {
+		if taken[j] {
+			continue
+		}
+		if err := emit(c.deleteDiff(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getTableRows reads the given columns of every row matching filter, with
+// the columns renamed per rename, which may be nil
+func getTableRows(db *sql.DB, dbType DBType, tableName string, columns []string, filter string, rename map[string]string) ([]map[string]interface{}, error) {
+	quotedCols := make([]string, len(columns))
+	for i, col := range columns {
+		quotedCols[i] = quoteIdentifier(dbType, col)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(quotedCols, ", "), quoteTableName(dbType, tableName), withFilter("", filter))
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []map[string]interface{}
+	for rows.Next() {
+		row, err := scanRow(rows, columns)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, renameKeys(row, rename))
+	}
+	return data, rows.Err()
+}
+
+// generateDeleteRowSQL deletes one row of a table without a key, matching
+// it by all its columns, so only one of several identical rows goes
+func generateDeleteRowSQL(dbType DBType, tableName string, columns []string, row map[string]interface{}, kinds map[string]valueKind) dataStatement {
+	table := quoteTableName(dbType, tableName)
+	b := newStatementBuilder(dbType)
+	switch dbType {
+	case SQLServer:
+		b.sql(fmt.Sprintf("DELETE TOP (1) FROM %s", table))
+		writeRowCondition(b, columns, row, kinds)
+	case PostgreSQL:
+		b.sql(fmt.Sprintf("DELETE FROM %s WHERE ctid IN (SELECT ctid FROM %s", table, table))
+		writeRowCondition(b, columns, row, kinds)
+		b.sql(" LIMIT 1)")
+	case SQLite:
+		b.sql(fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s", table, table))
+		writeRowCondition(b, columns, row, kinds)
+		b.sql(" LIMIT 1)")
+	default:
+		b.sql(fmt.Sprintf("DELETE FROM %s", table))
+		writeRowCondition(b, columns, row, kinds)
+		b.sql(" LIMIT 1")
+	}
+	return b.statement()
+}
+
+// writeRowCondition appends a WHERE clause matching every column of a row,
+// including its NULLs
+func writeRowCondition(b *statementBuilder, columns []string, row map[string]interface{}, kinds map[string]valueKind) {
+	b.sql(" WHERE ")
+	for i, col := range columns {
+		if i > 0 {
+			b.sql(" AND ")
+		}
+		if row[col] == nil {
+			b.sql(quoteIdentifier(b.dbType, col) + " IS NULL")
+			continue
+		}
+		b.sql(quoteIdentifier(b.dbType, col) + " = ")
+		b.value(row[col], kinds[col])
+	}
+}
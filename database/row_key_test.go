@@ -0,0 +1,51 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueKeyColumns(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "id", Nullable: "NO"},
+		{Name: "email", Nullable: "NO"},
+		{Name: "tenant", Nullable: "NO"},
+		{Name: "code", Nullable: "NO"},
+		{Name: "nickname", Nullable: "YES"},
+	}
+	tests := []struct {
+		name    string
+		indexes []IndexInfo
+		want    []string
+	}{
+		{"none", nil, nil},
+		{"nullable column", []IndexInfo{
+			{Name: "uq_nick", Column: "nickname", SeqInIdx: 1},
+		}, nil},
+		{"non-unique", []IndexInfo{
+			{Name: "ix_email", NonUnique: 1, Column: "email", SeqInIdx: 1},
+		}, nil},
+		{"fewest columns", []IndexInfo{
+			{Name: "uq_tenant_code", Column: "tenant", SeqInIdx: 1},
+			{Name: "uq_tenant_code", Column: "code", SeqInIdx: 2},
+			{Name: "uq_email", Column: "email", SeqInIdx: 1},
+		}, []string{"email"}},
+		{"PostgreSQL partial index", []IndexInfo{
+			{Name: "uq_email", Column: "email", SeqInIdx: 1,
+				Definition: "CREATE UNIQUE INDEX uq_email ON public.users USING btree (email) WHERE (deleted_at IS NULL)"},
+			{Name: "uq_tenant_code", Column: "tenant", SeqInIdx: 1},
+			{Name: "uq_tenant_code", Column: "code", SeqInIdx: 2},
+		}, []string{"tenant", "code"}},
+		{"SQL Server filtered index", []IndexInfo{
+			{Name: "UQ_email", Column: "email", SeqInIdx: 1, Filter: "([deleted_at] IS NULL)"},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueKeyColumns(TableInfo{Columns: columns, Indexes: tt.indexes})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueKeyColumns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,554 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ViewInfo holds a view definition
+type ViewInfo struct {
+	Name         string   `json:"name"`
+	Schema       string   `json:"schema,omitempty"`
+	Definition   string   `json:"definition"`
+	Materialized bool     `json:"materialized"`
+	DependsOn    []string `json:"dependsOn"`
+}
+
+// TriggerInfo holds a trigger definition
+type TriggerInfo struct {
+	Name string `json:"name"`
+	// Schema of the table the trigger is defined on
+	Schema     string `json:"schema,omitempty"`
+	TableName  string `json:"tableName"`
+	Definition string `json:"definition"`
+}
+
+// RoutineInfo holds a stored procedure or function definition
+type RoutineInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema,omitempty"`
+	Type   string `json:"type"` // "PROCEDURE", "FUNCTION"
+	// Argument types identifying a PostgreSQL overload
+	Arguments  string `json:"arguments,omitempty"`
+	Definition string `json:"definition"`
+}
+
+// schemaObject is the common shape of views, triggers and routines that the
+// DDL generators work with
+type schemaObject struct {
+	Kind       string // "view", "materialized view", "trigger", "procedure", "function"
+	Schema     string
+	Name       string
+	TableName  string
+	Arguments  string
+	Definition string
+}
+
+func (v ViewInfo) object() schemaObject {
+	kind := "view"
+	if v.Materialized {
+		kind = "materialized view"
+	}
+	return schemaObject{Kind: kind, Schema: v.Schema, Name: v.Name, Definition: v.Definition}
+}
+
+func (t TriggerInfo) object() schemaObject {
+	return schemaObject{Kind: "trigger", Schema: t.Schema, Name: t.Name, TableName: t.TableName, Definition: t.Definition}
+}
+
+func (r RoutineInfo) object() schemaObject {
+	return schemaObject{Kind: strings.ToLower(r.Type), Schema: r.Schema, Name: r.Name, Arguments: r.Arguments, Definition: r.Definition}
+}
+
+// routineKey identifies a routine in SchemaInfo.Routines; PostgreSQL allows
+// overloads, so the argument types are part of it there
+func routineKey(r RoutineInfo) string {
+	if r.Arguments != "" {
+		return fmt.Sprintf("%s(%s)", tableKey(r.Schema, r.Name), r.Arguments)
+	}
+	return tableKey(r.Schema, r.Name)
+}
+
+var mysqlDefinerRe = regexp.MustCompile("(?i)\\s+DEFINER\\s*=\\s*(`[^`]*`@`[^`]*`|\\S+)")
+
+// cleanMySQLDefinition drops the DEFINER clause and qualifiers naming the
+// source database, which differ between environments
+func cleanMySQLDefinition(def, database string) string {
+	def = mysqlDefinerRe.ReplaceAllString(def, "")
+	if database != "" {
+		def = strings.ReplaceAll(def, quoteIdentifier(MySQL, database)+".", "")
+	}
+	return def
+}
+
+// showCreate runs a MySQL SHOW CREATE statement and returns the named column
+func showCreate(db *sql.DB, query, column string) (string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]sql.NullString, len(cols))
+	valuePtrs := make([]interface{}, len(cols))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return "", err
+	}
+	for i, col := range cols {
+		if col == column {
+			return values[i].String, nil
+		}
+	}
+	return "", nil
+}
+
+// queryStrings runs a query and returns every row as strings, NULL as ""
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([][]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		valuePtrs := make([]interface{}, len(cols))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(cols))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func getMySQLSchemaObjects(db *sql.DB, schema *SchemaInfo) error {
+	views, err := queryStrings(db, "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.VIEWS WHERE TABLE_SCHEMA = DATABASE()")
+	if err != nil {
+		return err
+	}
+	for _, row := range views {
+		def, err := showCreate(db, fmt.Sprintf("SHOW CREATE VIEW %s", quoteIdentifier(MySQL, row[0])), "Create View")
+		if err != nil {
+			return err
+		}
+		schema.Views[row[0]] = ViewInfo{Name: row[0], Definition: cleanMySQLDefinition(def, schema.Database)}
+	}
+
+	triggers, err := queryStrings(db, `
+		SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM INFORMATION_SCHEMA.TRIGGERS
+		WHERE TRIGGER_SCHEMA = DATABASE()`)
+	if err != nil {
+		return err
+	}
+	for _, row := range triggers {
+		def, err := showCreate(db, fmt.Sprintf("SHOW CREATE TRIGGER %s", quoteIdentifier(MySQL, row[0])), "SQL Original Statement")
+		if err != nil {
+			return err
+		}
+		schema.Triggers[row[0]] = TriggerInfo{Name: row[0], TableName: row[1], Definition: cleanMySQLDefinition(def, schema.Database)}
+	}
+
+	routines, err := queryStrings(db, `
+		SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES
+		WHERE ROUTINE_SCHEMA = DATABASE()`)
+	if err != nil {
+		return err
+	}
+	for _, row := range routines {
+		kind := strings.ToUpper(row[1])
+		column := "Create Procedure"
+		if kind == "FUNCTION" {
+			column = "Create Function"
+		}
+		def, err := showCreate(db, fmt.Sprintf("SHOW CREATE %s %s", kind, quoteIdentifier(MySQL, row[0])), column)
+		if err != nil {
+			return err
+		}
+		schema.Routines[row[0]] = RoutineInfo{Name: row[0], Type: kind, Definition: cleanMySQLDefinition(def, schema.Database)}
+	}
+
+	return nil
+}
+
+func getPostgreSQLSchemaObjects(db *sql.DB, schema *SchemaInfo) error {
+	filter, args := postgresSchemaFilter(schema.Schemas, 1)
+	views, err := queryStrings(db, `
+		SELECT n.nspname, c.relname, c.relkind, pg_get_viewdef(c.oid, true)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND n.nspname `+filter, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range views {
+		view := ViewInfo{Name: row[1], Schema: localSchema(PostgreSQL, row[0]), Materialized: row[2] == "m"}
+		kind := "VIEW"
+		if view.Materialized {
+			kind = "MATERIALIZED VIEW"
+		}
+		view.Definition = fmt.Sprintf("CREATE %s %s AS\n%s", kind, qualifiedName(PostgreSQL, view.Schema, view.Name), row[3])
+		schema.Views[tableKey(view.Schema, view.Name)] = view
+	}
+
+	triggers, err := queryStrings(db, `
+		SELECT n.nspname, t.tgname, c.relname, pg_get_triggerdef(t.oid, true)
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal AND n.nspname `+filter, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range triggers {
+		trigger := TriggerInfo{Name: row[1], Schema: localSchema(PostgreSQL, row[0]), TableName: row[2], Definition: row[3]}
+		schema.Triggers[tableKey(trigger.Schema, trigger.Name)] = trigger
+	}
+
+	// Functions installed by extensions belong to the extension, not the schema
+	routines, err := queryStrings(db, `
+		SELECT n.nspname, p.proname, CASE p.prokind WHEN 'p' THEN 'PROCEDURE' ELSE 'FUNCTION' END,
+			pg_get_function_identity_arguments(p.oid), pg_get_functiondef(p.oid)
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname `+filter+` AND p.prokind IN ('f', 'p')
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')`, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range routines {
+		routine := RoutineInfo{Name: row[1], Schema: localSchema(PostgreSQL, row[0]), Type: row[2], Arguments: row[3], Definition: row[4]}
+		schema.Routines[routineKey(routine)] = routine
+	}
+
+	return nil
+}
+
+func getSQLiteSchemaObjects(db *sql.DB, schema *SchemaInfo) error {
+	views, err := queryStrings(db, "SELECT name, sql FROM sqlite_master WHERE type='view'")
+	if err != nil {
+		return err
+	}
+	for _, row := range views {
+		schema.Views[row[0]] = ViewInfo{Name: row[0], Definition: row[1]}
+	}
+
+	triggers, err := queryStrings(db, "SELECT name, tbl_name, sql FROM sqlite_master WHERE type='trigger'")
+	if err != nil {
+		return err
+	}
+	for _, row := range triggers {
+		schema.Triggers[row[0]] = TriggerInfo{Name: row[0], TableName: row[1], Definition: row[2]}
+	}
+
+	// SQLite has no stored routines
+	return nil
+}
+
+func getSQLServerSchemaObjects(db *sql.DB, schema *SchemaInfo) error {
+	filter, args := sqlServerSchemaFilter(schema.Schemas, 1)
+	views, err := queryStrings(db, `
+		SELECT SCHEMA_NAME(v.schema_id), v.name, m.definition
+		FROM sys.views v
+		JOIN sys.sql_modules m ON m.object_id = v.object_id
+		WHERE SCHEMA_NAME(v.schema_id) `+filter, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range views {
+		view := ViewInfo{Name: row[1], Schema: localSchema(SQLServer, row[0]), Definition: row[2]}
+		schema.Views[tableKey(view.Schema, view.Name)] = view
+	}
+
+	// Table triggers share their table's schema
+	triggers, err := queryStrings(db, `
+		SELECT OBJECT_SCHEMA_NAME(t.parent_id), t.name, OBJECT_NAME(t.parent_id), m.definition
+		FROM sys.triggers t
+		JOIN sys.sql_modules m ON m.object_id = t.object_id
+		WHERE t.parent_class = 1 AND OBJECT_SCHEMA_NAME(t.parent_id) `+filter, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range triggers {
+		trigger := TriggerInfo{Name: row[1], Schema: localSchema(SQLServer, row[0]), TableName: row[2], Definition: row[3]}
+		schema.Triggers[tableKey(trigger.Schema, trigger.Name)] = trigger
+	}
+
+	routines, err := queryStrings(db, `
+		SELECT SCHEMA_NAME(o.schema_id), o.name, CASE o.type WHEN 'P' THEN 'PROCEDURE' ELSE 'FUNCTION' END, m.definition
+		FROM sys.objects o
+		JOIN sys.sql_modules m ON m.object_id = o.object_id
+		WHERE o.type IN ('P', 'FN', 'IF', 'TF') AND o.is_ms_shipped = 0 AND SCHEMA_NAME(o.schema_id) `+filter, args...)
+	if err != nil {
+		return err
+	}
+	for _, row := range routines {
+		routine := RoutineInfo{Name: row[1], Schema: localSchema(SQLServer, row[0]), Type: row[2], Definition: row[3]}
+		schema.Routines[routineKey(routine)] = routine
+	}
+
+	return nil
+}
+
+// resolveViewDependencies fills ViewInfo.DependsOn with the keys of tables
+// and views whose names appear in each view's definition. It is a textual
+// match on the unqualified name, which may list extra objects but does not
+// miss any the view selects from.
+func resolveViewDependencies(schema *SchemaInfo) {
+	names := make(map[string]string)
+	for key, table := range schema.Tables {
+		names[key] = table.Name
+	}
+	for key, view := range schema.Views {
+		names[key] = view.Name
+	}
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	patterns := make([]*regexp.Regexp, len(keys))
+	for i, key := range keys {
+		patterns[i] = regexp.MustCompile(`(^|[^a-z0-9_$])` + regexp.QuoteMeta(strings.ToLower(names[key])) + `($|[^a-z0-9_$])`)
+	}
+
+	for viewKey, view := range schema.Views {
+		view.DependsOn = nil
+		def := strings.ToLower(view.Definition)
+		for i, key := range keys {
+			if key == viewKey {
+				continue
+			}
+			if patterns[i].MatchString(def) {
+				view.DependsOn = append(view.DependsOn, key)
+			}
+		}
+		schema.Views[viewKey] = view
+	}
+}
+
+// dependentViews returns the keys of the views that select from any of the
+// given tables, directly or through other views
+func dependentViews(views map[string]ViewInfo, keys []string) map[string]bool {
+	affected := make(map[string]bool)
+	for _, key := range keys {
+		affected[key] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for viewKey, view := range views {
+			if affected[viewKey] {
+				continue
+			}
+			for _, dep := range view.DependsOn {
+				if affected[dep] {
+					affected[viewKey], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	dependents := make(map[string]bool)
+	for viewKey := range views {
+		if affected[viewKey] {
+			dependents[viewKey] = true
+		}
+	}
+	return dependents
+}
+
+// rebuildDependents collects the target views that depend on a table, directly
+// or through other views, and the triggers on the table and those views.
+// Objects the source drops or replaces are left to compareSchemaObjects and
+// are not recreated.
+func rebuildDependents(source, target *SchemaInfo, key string) tableDependents {
+	affected := dependentViews(target.Views, []string{key})
+	var viewKeys []string
+	for viewKey := range affected {
+		viewKeys = append(viewKeys, viewKey)
+	}
+	sort.Strings(viewKeys)
+	order, _ := orderByDependencies(viewKeys, viewDependencies(target.Views))
+	affected[key] = true
+
+	sameEngine := source.Type == target.Type
+	kept := func(targetObj schemaObject, sourceObj schemaObject, inSource bool) bool {
+		return inSource && (!sameEngine || definitionsEqual(sourceObj.Definition, targetObj.Definition))
+	}
+
+	var deps tableDependents
+	for _, viewKey := range order {
+		obj := target.Views[viewKey].object()
+		deps.views = append(deps.views, obj)
+		sourceView, inSource := source.Views[viewKey]
+		if kept(obj, sourceView.object(), inSource) {
+			deps.recreate = append(deps.recreate, obj)
+		}
+	}
+
+	var triggerKeys []string
+	for triggerKey, trigger := range target.Triggers {
+		if affected[tableKey(trigger.Schema, trigger.TableName)] {
+			triggerKeys = append(triggerKeys, triggerKey)
+		}
+	}
+	sort.Strings(triggerKeys)
+	for _, triggerKey := range triggerKeys {
+		obj := target.Triggers[triggerKey].object()
+		sourceTrigger, inSource := source.Triggers[triggerKey]
+		if kept(obj, sourceTrigger.object(), inSource) {
+			deps.recreate = append(deps.recreate, obj)
+		}
+	}
+	return deps
+}
+
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+// definitionsEqual compares object definitions ignoring layout differences
+func definitionsEqual(a, b string) bool {
+	normalize := func(s string) string {
+		s = strings.TrimRight(strings.TrimSpace(s), ";")
+		return whitespaceRe.ReplaceAllString(strings.TrimSpace(s), " ")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// compareSchemaObjects diffs views, triggers and routines. Their definitions
+// are engine specific, so no SQL is generated across database types.
+func compareSchemaObjects(gen ddlGenerator, source, target *SchemaInfo) []DiffResult {
+	var results []DiffResult
+	sameEngine := source.Type == target.Type
+
+	diffObjects := func(objectType string, sourceObjs, targetObjs map[string]schemaObject) {
+		var keys []string
+		for key := range sourceObjs {
+			keys = append(keys, key)
+		}
+		for key := range targetObjs {
+			if _, exists := sourceObjs[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sourceObj, inSource := sourceObjs[key]
+			targetObj, inTarget := targetObjs[key]
+
+			diff := DiffResult{ObjectType: objectType}
+			var stmts []string
+			switch {
+			case inSource && !inTarget:
+				diff.Type, diff.Action = "added", "create"
+				diff.TableName = objectTableName(sourceObj)
+				diff.Detail = fmt.Sprintf("Create %s: %s", sourceObj.Kind, key)
+				stmts = gen.createObject(sourceObj)
+			case !inSource && inTarget:
+				diff.Type, diff.Action = "removed", "drop"
+				diff.TableName = objectTableName(targetObj)
+				diff.Detail = fmt.Sprintf("Drop %s: %s", targetObj.Kind, key)
+				stmts = gen.dropObject(targetObj)
+				// Dropping only needs the target's names, so it works across engines
+				results = append(results, withSQL(diff, stmts))
+				continue
+			case !definitionsEqual(sourceObj.Definition, targetObj.Definition):
+				diff.Type, diff.Action = "modified", "alter"
+				diff.TableName = objectTableName(sourceObj)
+				diff.Detail = fmt.Sprintf("Replace %s: %s", sourceObj.Kind, key)
+				stmts = gen.replaceObject(targetObj, sourceObj)
+			default:
+				continue
+			}
+
+			if !sameEngine {
+				diff.Detail += " (definition is specific to " + string(source.Type) + ", migrate manually)"
+				stmts = nil
+			}
+			results = append(results, withSQL(diff, stmts))
+		}
+	}
+
+	sourceViews, targetViews := make(map[string]schemaObject), make(map[string]schemaObject)
+	for name, v := range source.Views {
+		sourceViews[name] = v.object()
+	}
+	for name, v := range target.Views {
+		targetViews[name] = v.object()
+	}
+	diffObjects("view", sourceViews, targetViews)
+
+	sourceTriggers, targetTriggers := make(map[string]schemaObject), make(map[string]schemaObject)
+	for name, t := range source.Triggers {
+		sourceTriggers[name] = t.object()
+	}
+	for name, t := range target.Triggers {
+		targetTriggers[name] = t.object()
+	}
+	diffObjects("trigger", sourceTriggers, targetTriggers)
+
+	sourceRoutines, targetRoutines := make(map[string]schemaObject), make(map[string]schemaObject)
+	for key, r := range source.Routines {
+		sourceRoutines[key] = r.object()
+	}
+	for key, r := range target.Routines {
+		targetRoutines[key] = r.object()
+	}
+	diffObjects("routine", sourceRoutines, targetRoutines)
+
+	return results
+}
+
+// objectTableName is the name a schema object diff is listed under
+func objectTableName(obj schemaObject) string {
+	if obj.TableName != "" {
+		return tableKey(obj.Schema, obj.TableName)
+	}
+	return tableKey(obj.Schema, obj.Name)
+}
+
+func withSQL(diff DiffResult, stmts []string) DiffResult {
+	diff.SQL = joinStatements(stmts)
+	return diff
+}
+
+var (
+	createKeywordRe   = regexp.MustCompile(`(?is)^(\s*(?:--[^\n]*\n\s*|/\*.*?\*/\s*)*)CREATE\s+`)
+	createOrReplaceRe = regexp.MustCompile(`(?is)^(\s*(?:--[^\n]*\n\s*|/\*.*?\*/\s*)*)CREATE\s+OR\s+(ALTER|REPLACE)\s`)
+)
+
+// insertAfterCreate turns "CREATE ..." into "CREATE <words> ...", skipping
+// any leading comments. Definitions that already replace are left alone.
+func insertAfterCreate(def, words string) string {
+	if createOrReplaceRe.MatchString(def) {
+		return def
+	}
+	return createKeywordRe.ReplaceAllString(def, "${1}CREATE "+words+" ")
+}
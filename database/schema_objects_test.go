@@ -0,0 +1,33 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveViewDependencies(t *testing.T) {
+	schema := &SchemaInfo{
+		Tables: map[string]TableInfo{
+			"public.orders":      {Schema: "public", Name: "orders"},
+			"public.order_items": {Schema: "public", Name: "order_items"},
+			"sales.users":        {Schema: "sales", Name: "users"},
+		},
+		Views: map[string]ViewInfo{
+			"public.v_orders": {Schema: "public", Name: "v_orders",
+				Definition: "SELECT o.id, u.name FROM public.orders o JOIN sales.Users u ON u.id = o.user_id"},
+			"public.v_totals": {Schema: "public", Name: "v_totals",
+				Definition: "SELECT id FROM v_orders WHERE order_items_count > 0"},
+		},
+	}
+	resolveViewDependencies(schema)
+
+	want := map[string][]string{
+		"public.v_orders": {"public.orders", "sales.users"},
+		"public.v_totals": {"public.v_orders"},
+	}
+	for key, deps := range want {
+		if got := schema.Views[key].DependsOn; !reflect.DeepEqual(got, deps) {
+			t.Errorf("%s depends on %v, want %v", key, got, deps)
+		}
+	}
+}
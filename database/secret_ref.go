@@ -0,0 +1,183 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The secret settings of a saved connection (password, SSH password and
+// key passphrase) can hold a reference instead of the secret, resolved only
+// when connecting. A reference is the whole value:
+//
+//	${env:NAME}   the environment variable NAME
+//	${file:PATH}  the contents of a file, without trailing newlines
+//
+// Secrets read back through GetAllRedacted become ${saved:CONNECTION},
+// which stands for the secret in the same setting of that connection.
+// Other settings, and values that merely contain a reference, are taken
+// literally. A secret that starts like a reference but is not one, such as
+// file:/run/secrets/db or ${env:}, is rejected rather than sent as the
+// password.
+
+var secretReference = regexp.MustCompile(`^\$\{(env|file):(.+)\}$`)
+
+var referenceLike = regexp.MustCompile(`(?i)^(\$\{|(env|file|saved):)`)
+
+const savedReferencePrefix = "${saved:"
+
+// savedSecrets is the store ${saved:...} references are looked up in
+var savedSecrets *ConnectionStore
+
+// UseSavedSecrets makes Connect look up redacted secrets in store
+func UseSavedSecrets(store *ConnectionStore) {
+	savedSecrets = store
+}
+
+// isReference reports whether a value refers to a secret kept elsewhere
+func isReference(value string) bool {
+	return secretReference.MatchString(value)
+}
+
+// savedReference returns the connection a redacted secret belongs to
+func savedReference(value string) (string, bool) {
+	if !strings.HasPrefix(value, savedReferencePrefix) || !strings.HasSuffix(value, "}") {
+		return "", false
+	}
+	return value[len(savedReferencePrefix) : len(value)-1], true
+}
+
+// checkReference rejects a secret that looks like a reference but does not
+// match the syntax of one
+func checkReference(value string) error {
+	if !referenceLike.MatchString(value) || isReference(value) {
+		return nil
+	}
+	if _, ok := savedReference(value); ok {
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid secret reference: use ${env:NAME} or ${file:PATH}", value)
+}
+
+// resolveReference returns the value a reference stands for
+func resolveReference(value string) (string, error) {
+	m := secretReference.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+	if m[1] == "file" {
+		data, err := os.ReadFile(m[2])
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	v, ok := os.LookupEnv(m[2])
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", m[2])
+	}
+	return v, nil
+}
+
+// resolveReferences returns config with the references in its secret
+// settings replaced by the values they stand for
+func resolveReferences(config ConnectionConfig) (ConnectionConfig, error) {
+	for i, field := range secretFields(&config) {
+		if name, ok := savedReference(*field); ok {
+			value, err := savedSecrets.secret(name, i)
+			if err != nil {
+				return config, err
+			}
+			*field = value
+		}
+		if err := checkReference(*field); err != nil {
+			return config, err
+		}
+		if !isReference(*field) {
+			continue
+		}
+		value, err := resolveReference(*field)
+		if err != nil {
+			return config, err
+		}
+		*field = value
+	}
+	return config, nil
+}
+
+// secret returns setting i, in the order of secretFields, of a saved
+// connection
+func (s *ConnectionStore) secret(name string, i int) (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("no saved connections to look up %s in", name)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.locked() {
+		return "", fmt.Errorf("saved connections are locked")
+	}
+	for _, c := range s.Connections {
+		if c.Name == name {
+			conn, err := s.reveal(c)
+			if err != nil {
+				return "", err
+			}
+			return *secretFields(&conn.Config)[i], nil
+		}
+	}
+	return "", fmt.Errorf("no saved connection named %q", name)
+}
+
+// GetAllRedacted returns all saved connections with their secrets replaced
+// by ${saved:...} references. References to secrets kept elsewhere are
+// returned as they are.
+func (s *ConnectionStore) GetAllRedacted() []SavedConnection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]SavedConnection, 0, len(s.Connections))
+	for _, conn := range s.Connections {
+		for _, field := range secretFields(&conn.Config) {
+			value := *field
+			if isSealed(value) && s.key != nil {
+				if opened, err := openSecret(s.key, value); err == nil {
+					value = opened
+				}
+			}
+			if value != "" && !isReference(value) {
+				value = savedReferencePrefix + conn.Name + "}"
+			}
+			*field = value
+		}
+		result = append(result, conn)
+	}
+	return result
+}
+
+// unredact replaces ${saved:...} references in a connection being saved by
+// the secrets they stand for, as stored
+func (s *ConnectionStore) unredact(conn *SavedConnection) error {
+	for i, field := range secretFields(&conn.Config) {
+		name, ok := savedReference(*field)
+		if !ok {
+			if err := checkReference(*field); err != nil {
+				return err
+			}
+			continue
+		}
+		found := false
+		for _, c := range s.Connections {
+			if c.Name == name {
+				*field = *secretFields(&c.Config)[i]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no saved connection named %q", name)
+		}
+	}
+	return nil
+}
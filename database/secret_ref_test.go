@@ -0,0 +1,164 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveReference(t *testing.T) {
+	t.Setenv("SYNCFORGE_TEST_SECRET", "from-env")
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "${env:SYNCFORGE_TEST_SECRET}", want: "from-env"},
+		{value: "${file:" + path + "}", want: "from-file"},
+		{value: "${env:SYNCFORGE_TEST_UNSET}", wantErr: true},
+		{value: "${file:" + path + ".missing}", wantErr: true},
+		// Only a whole-value reference counts
+		{value: "file:" + path, want: "file:" + path},
+		{value: "pre${env:SYNCFORGE_TEST_SECRET}", want: "pre${env:SYNCFORGE_TEST_SECRET}"},
+		{value: "${env:}", want: "${env:}"},
+		{value: "plain", want: "plain"},
+	}
+	for _, tt := range tests {
+		got, err := resolveReference(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveReference(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("resolveReference(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestResolveReferencesOnlyInSecretFields(t *testing.T) {
+	t.Setenv("SYNCFORGE_TEST_SECRET", "from-env")
+	config := ConnectionConfig{
+		Host:     "${env:SYNCFORGE_TEST_SECRET}",
+		User:     "${env:SYNCFORGE_TEST_SECRET}",
+		Password: "${env:SYNCFORGE_TEST_SECRET}",
+		SSH: SSHConfig{
+			Host:       "${env:SYNCFORGE_TEST_SECRET}",
+			User:       "${env:SYNCFORGE_TEST_SECRET}",
+			Password:   "hunter2",
+			Passphrase: "${env:SYNCFORGE_TEST_SECRET}",
+		},
+	}
+	got, err := resolveReferences(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "from-env" || got.SSH.Passphrase != "from-env" {
+		t.Errorf("secrets not resolved: password %q, passphrase %q", got.Password, got.SSH.Passphrase)
+	}
+	if got.Host != config.Host || got.User != config.User || got.SSH.Host != config.SSH.Host || got.SSH.User != config.SSH.User {
+		t.Errorf("non-secret settings were resolved: %+v", got)
+	}
+	if got.SSH.Password != "hunter2" {
+		t.Errorf("plain password changed to %q", got.SSH.Password)
+	}
+}
+
+func TestCheckReference(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"hunter2", false},
+		{"", false},
+		{"${env:DB_PASSWORD}", false},
+		{"${file:/run/secrets/db}", false},
+		{"${saved:prod}", false},
+		{"pa$${word}", false},
+		{"file:/run/secrets/db", true},
+		{"env:DB_PASSWORD", true},
+		{"FILE:/run/secrets/db", true},
+		{"${env:}", true},
+		{"${file:/run/secrets/db", true},
+		{"${vault:db}", true},
+	}
+	for _, tt := range tests {
+		if err := checkReference(tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("checkReference(%q) = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+	}
+
+	// Both connecting and saving reject them
+	if _, err := resolveReferences(ConnectionConfig{Password: "file:/run/secrets/db"}); err == nil {
+		t.Error("resolveReferences accepted a bare file: reference")
+	}
+	store := newTestStore(t)
+	if err := store.Save(SavedConnection{Name: "prod", Config: ConnectionConfig{SSH: SSHConfig{Passphrase: "${env:}"}}}); err == nil {
+		t.Error("Save accepted an empty env reference")
+	}
+}
+
+func TestRedactionRoundTrip(t *testing.T) {
+	for _, passphrase := range []string{"", "correct horse"} {
+		store := newTestStore(t)
+		if passphrase != "" {
+			if err := store.SetPassphrase(passphrase); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := store.Save(SavedConnection{Name: "prod", Config: ConnectionConfig{
+			Host:     "db.example.com",
+			Password: "hunter2",
+			SSH:      SSHConfig{Host: "bastion", Passphrase: "${env:KEY_PASS}"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redacted := store.GetAllRedacted()
+		if len(redacted) != 1 {
+			t.Fatalf("GetAllRedacted() returned %d connections", len(redacted))
+		}
+		conn := redacted[0]
+		if conn.Config.Password != "${saved:prod}" {
+			t.Errorf("password redacted as %q", conn.Config.Password)
+		}
+		if conn.Config.SSH.Passphrase != "${env:KEY_PASS}" {
+			t.Errorf("reference redacted as %q", conn.Config.SSH.Passphrase)
+		}
+
+		// Saving the redacted form, as the GUI does, keeps the secrets
+		conn.Config.Host = "db2.example.com"
+		if err := store.Save(conn); err != nil {
+			t.Fatal(err)
+		}
+		// So does copying it into a new connection
+		conn.Name = "copy"
+		if err := store.Save(conn); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"prod", "copy"} {
+			saved, _ := store.Get(name)
+			if saved.Config.Host != "db2.example.com" || saved.Config.Password != "hunter2" || saved.Config.SSH.Passphrase != "${env:KEY_PASS}" {
+				t.Errorf("passphrase %q: %s saved as %+v", passphrase, name, saved.Config)
+			}
+		}
+
+		// Connect resolves a redacted secret through the store
+		UseSavedSecrets(store)
+		resolved, err := resolveReferences(ConnectionConfig{Password: "${saved:prod}"})
+		UseSavedSecrets(nil)
+		if err != nil || resolved.Password != "hunter2" {
+			t.Errorf("resolveReferences(${saved:prod}) = %q, %v", resolved.Password, err)
+		}
+
+		conn.Config.Password = "${saved:missing}"
+		if err := store.Save(conn); err == nil {
+			t.Error("saving a reference to a missing connection succeeded")
+		}
+	}
+}
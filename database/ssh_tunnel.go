@@ -0,0 +1,339 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig holds the settings of an SSH tunnel to the database server, for
+// databases only reachable through a bastion host
+type SSHConfig struct {
+	// Bastion host; empty to connect directly
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Private key file, and the passphrase it is encrypted with, if any
+	PrivateKey string `json:"privateKey,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	// known_hosts file the host key must be listed in; defaults to
+	// ~/.ssh/known_hosts
+	KnownHosts string `json:"knownHosts,omitempty"`
+	// SHA256 fingerprint of the host key, as ssh-keygen -l prints it, to
+	// accept instead of a known_hosts entry
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"`
+}
+
+// Enabled reports whether connections go through the tunnel
+func (c SSHConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+// clientConfig returns the SSH client settings: password and key
+// authentication, and a host key check against the fingerprint or
+// known_hosts
+func (c SSHConfig) clientConfig() (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		User:    c.User,
+		Timeout: 10 * time.Second,
+	}
+
+	if c.PrivateKey != "" {
+		pem, err := os.ReadFile(expandHome(c.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH private key: %v", err)
+		}
+		var signer ssh.Signer
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH private key: %v", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(c.Password))
+	}
+	if len(config.Auth) == 0 {
+		return nil, fmt.Errorf("SSH tunnel needs a password or a private key")
+	}
+
+	if c.HostKeyFingerprint != "" {
+		want := strings.TrimPrefix(strings.TrimSpace(c.HostKeyFingerprint), "SHA256:")
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := strings.TrimPrefix(ssh.FingerprintSHA256(key), "SHA256:"); got != want {
+				return fmt.Errorf("SSH host key fingerprint is SHA256:%s, expected SHA256:%s", got, want)
+			}
+			return nil
+		}
+		return config, nil
+	}
+
+	path := c.KnownHosts
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %v", err)
+	}
+	config.HostKeyCallback = callback
+	return config, nil
+}
+
+// expandHome replaces a leading ~/ of a path with the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, rest)
+		}
+	}
+	return path
+}
+
+// dial connects and authenticates to the bastion host
+func (c SSHConfig) dial() (*ssh.Client, error) {
+	config, err := c.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	port := c.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(c.Host, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, fmt.Errorf("SSH connection to %s failed: %v", c.Host, err)
+	}
+	return client, nil
+}
+
+// sshForwarder opens connections from the far end of an SSH connection.
+// *ssh.Client implements it.
+type sshForwarder interface {
+	Dial(network, addr string) (net.Conn, error)
+	Close() error
+}
+
+// sshTunnel forwards connections to a local port through an SSH connection
+// to a remote address, like ssh -L
+type sshTunnel struct {
+	client   sshForwarder
+	listener net.Listener
+	remote   string
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// openTunnel starts forwarding a free local port to remote. The tunnel
+// owns client and closes it with itself.
+func openTunnel(client sshForwarder, remote string) (*sshTunnel, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	t := &sshTunnel{
+		client:   client,
+		listener: listener,
+		remote:   remote,
+		conns:    make(map[net.Conn]bool),
+	}
+	t.wg.Add(1)
+	go t.serve()
+	return t, nil
+}
+
+// localAddr returns the host and port the tunnel listens on
+func (t *sshTunnel) localAddr() (string, int) {
+	addr := t.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (t *sshTunnel) serve() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+// forward copies data both ways between a local connection and a new one
+// from the far end of the tunnel, until either side closes
+func (t *sshTunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		local.Close()
+		return
+	}
+	if !t.track(local, remote) {
+		local.Close()
+		remote.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go pipe(remote, local)
+	go pipe(local, remote)
+	<-done
+	local.Close()
+	remote.Close()
+	<-done
+	t.untrack(local, remote)
+}
+
+// track records open connections so Close can end them, and reports false
+// once the tunnel is closed
+func (t *sshTunnel) track(conns ...net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	for _, c := range conns {
+		t.conns[c] = true
+	}
+	return true
+}
+
+func (t *sshTunnel) untrack(conns ...net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range conns {
+		delete(t.conns, c)
+	}
+}
+
+// Close stops listening, ends forwarded connections and closes the SSH
+// connection
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.listener.Close()
+	for c := range t.conns {
+		c.Close()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return t.client.Close()
+}
+
+// tunnelConnector opens connections through a tunnel. database/sql closes
+// a connector that implements io.Closer when the DB is closed, which ties
+// the tunnel to the *sql.DB.
+type tunnelConnector struct {
+	driver.Connector
+	tunnel *sshTunnel
+}
+
+func (c tunnelConnector) Close() error {
+	return c.tunnel.Close()
+}
+
+// startTunnel opens the SSH tunnel of a connection and returns the config
+// to connect through it, with the database host replaced by the tunnel's
+// local end
+func startTunnel(config ConnectionConfig) (*sshTunnel, ConnectionConfig, error) {
+	if config.Type == SQLite {
+		return nil, config, fmt.Errorf("SQLite databases cannot be reached through an SSH tunnel")
+	}
+	client, err := config.SSH.dial()
+	if err != nil {
+		return nil, config, err
+	}
+	tunnel, err := openTunnel(client, net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, config, err
+	}
+
+	// Certificates name the database host, not the tunnel's end. lib/pq
+	// checks against the host in its DSN, so PostgreSQL keeps the host
+	// and dials the tunnel through tunnelDialer instead.
+	if config.Type == PostgreSQL {
+		return tunnel, config, nil
+	}
+	if config.TLS.ServerName == "" {
+		config.TLS.ServerName = config.Host
+	}
+	config.Host, config.Port = tunnel.localAddr()
+	return tunnel, config, nil
+}
+
+// tunnelDialer connects lib/pq to the local end of a tunnel, whatever
+// address the DSN names
+type tunnelDialer struct {
+	tunnel *sshTunnel
+}
+
+func (d tunnelDialer) Dial(network, address string) (net.Conn, error) {
+	return net.Dial(network, d.tunnel.listener.Addr().String())
+}
+
+func (d tunnelDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, d.tunnel.listener.Addr().String(), timeout)
+}
+
+// openTunnelDB opens a DB that connects through tunnel and closes it when
+// the DB is closed
+func openTunnelDB(driverName, dsn string, tunnel *sshTunnel) (*sql.DB, error) {
+	var connector driver.Connector
+	var err error
+	switch driverName {
+	case "mysql":
+		connector, err = mysql.MySQLDriver{}.OpenConnector(dsn)
+	case "postgres":
+		var pqConnector *pq.Connector
+		if pqConnector, err = pq.NewConnector(dsn); err == nil {
+			pqConnector.Dialer(tunnelDialer{tunnel})
+			connector = pqConnector
+		}
+	case "sqlserver":
+		connector, err = mssql.NewConnector(dsn)
+	default:
+		err = fmt.Errorf("driver %s cannot connect through an SSH tunnel", driverName)
+	}
+	if err != nil {
+		tunnel.Close()
+		return nil, err
+	}
+	return sql.OpenDB(tunnelConnector{Connector: connector, tunnel: tunnel}), nil
+}
@@ -0,0 +1,405 @@
+package database
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process stand-in for a bastion host. It accepts
+// one password and one public key, and serves direct-tcpip channels, the
+// requests ssh -L makes, by dialing the requested address.
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	config   *ssh.ServerConfig
+	wg       sync.WaitGroup
+}
+
+func newTestSSHServer(t *testing.T, password string, authorized ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && password != "" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && authorized != nil && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{listener: listener, hostKey: hostKey, config: config}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *testSSHServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+			continue
+		}
+		// RFC 4254 7.2: host to connect, port, originator address, port
+		var req struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &req); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+// port returns the port the server listens on
+func (s *testSSHServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// newEchoServer returns the address of a TCP server that echoes lines
+func newEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// roundTrip sends a message to addr and reads the echo
+func roundTrip(t *testing.T, host string, port int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("echo = %q", buf)
+	}
+}
+
+// writeKey writes an OpenSSH private key, encrypted if passphrase is set,
+// and returns its path and public key
+func writeKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, sshPub
+}
+
+func TestSSHTunnelAuthentication(t *testing.T) {
+	keyPath, authorized := writeKey(t, "")
+	encryptedPath, encryptedKey := writeKey(t, "key secret")
+	otherPath, _ := writeKey(t, "")
+	echo := newEchoServer(t)
+
+	tests := []struct {
+		name       string
+		authorized ssh.PublicKey
+		config     SSHConfig
+		wantErr    string
+	}{
+		{name: "password", config: SSHConfig{Password: "s3cret"}},
+		{name: "key", authorized: authorized, config: SSHConfig{PrivateKey: keyPath}},
+		{name: "encrypted key", authorized: encryptedKey, config: SSHConfig{PrivateKey: encryptedPath, Passphrase: "key secret"}},
+		{name: "key falls back to password", authorized: authorized, config: SSHConfig{PrivateKey: otherPath, Password: "s3cret"}},
+		{name: "wrong password", config: SSHConfig{Password: "nope"}, wantErr: "unable to authenticate"},
+		{name: "unknown key", authorized: authorized, config: SSHConfig{PrivateKey: otherPath}, wantErr: "unable to authenticate"},
+		{name: "wrong key passphrase", authorized: encryptedKey, config: SSHConfig{PrivateKey: encryptedPath, Passphrase: "nope"}, wantErr: "failed to parse SSH private key"},
+		{name: "encrypted key without passphrase", authorized: encryptedKey, config: SSHConfig{PrivateKey: encryptedPath}, wantErr: "failed to parse SSH private key"},
+		{name: "no credentials", config: SSHConfig{}, wantErr: "needs a password or a private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestSSHServer(t, "s3cret", tt.authorized)
+			config := tt.config
+			config.Host = "127.0.0.1"
+			config.Port = server.port()
+			config.User = "tunnel"
+			config.HostKeyFingerprint = ssh.FingerprintSHA256(server.hostKey.PublicKey())
+
+			client, err := config.dial()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("dial() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tunnel, err := openTunnel(client, echo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tunnel.Close()
+			roundTrip(t, "127.0.0.1", mustPort(t, tunnel))
+		})
+	}
+}
+
+func mustPort(t *testing.T, tunnel *sshTunnel) int {
+	t.Helper()
+	host, port := tunnel.localAddr()
+	if host != "127.0.0.1" {
+		t.Fatalf("tunnel listens on %s", host)
+	}
+	return port
+}
+
+func TestSSHHostKeyChecking(t *testing.T) {
+	server := newTestSSHServer(t, "s3cret", nil)
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.port()))
+	hostKey := server.hostKey.PublicKey()
+	_, otherKey := writeKey(t, "")
+
+	knownHosts := func(key ssh.PublicKey) string {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+		if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		config  SSHConfig
+		wantErr string
+	}{
+		{name: "fingerprint", config: SSHConfig{HostKeyFingerprint: ssh.FingerprintSHA256(hostKey)}},
+		{name: "fingerprint without prefix", config: SSHConfig{HostKeyFingerprint: strings.TrimPrefix(ssh.FingerprintSHA256(hostKey), "SHA256:")}},
+		{name: "wrong fingerprint", config: SSHConfig{HostKeyFingerprint: ssh.FingerprintSHA256(otherKey)}, wantErr: "fingerprint"},
+		{name: "known_hosts", config: SSHConfig{KnownHosts: knownHosts(hostKey)}},
+		{name: "changed host key", config: SSHConfig{KnownHosts: knownHosts(otherKey)}, wantErr: "key mismatch"},
+		{name: "missing known_hosts", config: SSHConfig{KnownHosts: filepath.Join(t.TempDir(), "none")}, wantErr: "failed to read known_hosts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Host = "127.0.0.1"
+			config.Port = server.port()
+			config.User = "tunnel"
+			config.Password = "s3cret"
+			client, err := config.dial()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("dial() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Close()
+		})
+	}
+
+	// An unlisted host is refused too
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := SSHConfig{Host: "127.0.0.1", Port: server.port(), User: "tunnel", Password: "s3cret", KnownHosts: path}
+	if client, err := config.dial(); err == nil {
+		client.Close()
+		t.Error("dial() to a host missing from known_hosts succeeded")
+	}
+}
+
+// fakeForwarder dials directly instead of through an SSH connection
+type fakeForwarder struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (f *fakeForwarder) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial(network, addr)
+}
+
+func (f *fakeForwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// stubConnector is a driver.Connector that never connects
+type stubConnector struct{}
+
+func (stubConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not connected")
+}
+
+func (stubConnector) Driver() driver.Driver { return nil }
+
+func TestTunnelConnectorCloseReleasesTunnel(t *testing.T) {
+	echo := newEchoServer(t)
+	forwarder := &fakeForwarder{}
+	tunnel, err := openTunnel(forwarder, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := tunnel.localAddr()
+	roundTrip(t, host, port)
+
+	// A forwarded connection left open must not keep Close waiting
+	open, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	if _, err := open.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(open, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	db := sql.OpenDB(tunnelConnector{Connector: stubConnector{}, tunnel: tunnel})
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !forwarder.closed {
+		t.Error("SSH client was not closed")
+	}
+	if conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+		conn.Close()
+		t.Error("tunnel still listening after the DB was closed")
+	}
+	if _, err := open.Read(make([]byte, 1)); err == nil {
+		t.Error("forwarded connection still open after the DB was closed")
+	}
+	// Closing twice is harmless
+	if err := tunnel.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStartTunnelRejectsSQLite(t *testing.T) {
+	_, _, err := startTunnel(ConnectionConfig{Type: SQLite, SSH: SSHConfig{Host: "bastion"}})
+	if err == nil {
+		t.Error("SQLite connection was tunnelled")
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLArg is a bind argument of a data statement. Its Go type is kept in
+// Type, so the argument survives a JSON round trip through the frontend
+// without int64s losing precision or timestamps and binary data turning
+// into plain text.
+type SQLArg struct {
+	Type  string `json:"type"` // "null", "int", "uint", "float", "bool", "string", "bytes" or "time"
+	Value string `json:"value"`
+}
+
+func newSQLArg(v interface{}) SQLArg {
+	switch x := v.(type) {
+	case nil:
+		return SQLArg{Type: "null"}
+	case int:
+		return SQLArg{Type: "int", Value: strconv.Itoa(x)}
+	case int8, int16, int32, int64:
+		return SQLArg{Type: "int", Value: fmt.Sprintf("%d", x)}
+	case uint, uint8, uint16, uint32, uint64:
+		return SQLArg{Type: "uint", Value: fmt.Sprintf("%d", x)}
+	case float32:
+		return SQLArg{Type: "float", Value: strconv.FormatFloat(float64(x), 'g', -1, 32)}
+	case float64:
+		return SQLArg{Type: "float", Value: strconv.FormatFloat(x, 'g', -1, 64)}
+	case bool:
+		return SQLArg{Type: "bool", Value: strconv.FormatBool(x)}
+	case []byte:
+		return SQLArg{Type: "bytes", Value: base64.StdEncoding.EncodeToString(x)}
+	case time.Time:
+		return SQLArg{Type: "time", Value: x.Format(time.RFC3339Nano)}
+	default:
+		return SQLArg{Type: "string", Value: fmt.Sprintf("%v", x)}
+	}
+}
+
+// value decodes the argument into the Go value passed to the driver
+func (a SQLArg) value() (interface{}, error) {
+	switch a.Type {
+	case "null":
+		return nil, nil
+	case "int":
+		return strconv.ParseInt(a.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(a.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(a.Value, 64)
+	case "bool":
+		return strconv.ParseBool(a.Value)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(a.Value)
+	case "time":
+		return time.Parse(time.RFC3339Nano, a.Value)
+	case "string":
+		return a.Value, nil
+	default:
+		return nil, fmt.Errorf("unknown argument type: %s", a.Type)
+	}
+}
+
+// dataStatement is a data change both as literal SQL, for previews and
+// exported scripts, and as a template with arguments, for execution
+type dataStatement struct {
+	sql      string
+	template string
+	args     []SQLArg
+	// Inserted columns, for inserts
+	columns []string
+}
+
+// statementBuilder writes the literal and parameterized forms of a statement
+// side by side
+type statementBuilder struct {
+	dbType   DBType
+	literal  strings.Builder
+	template strings.Builder
+	args     []SQLArg
+}
+
+func newStatementBuilder(dbType DBType) *statementBuilder {
+	return &statementBuilder{dbType: dbType}
+}
+
+// sql appends text that is the same in both forms
+func (b *statementBuilder) sql(text string) {
+	b.literal.WriteString(text)
+	b.template.WriteString(text)
+}
+
+// value appends a value, as a literal and as a placeholder. Binary columns
+// arrive as strings from scanRow and are bound as bytes again.
+func (b *statementBuilder) value(v interface{}, kind valueKind) {
+	if s, ok := v.(string); ok && kind == kindBinary {
+		v = []byte(s)
+	}
+	b.args = append(b.args, newSQLArg(v))
+	b.literal.WriteString(sqlLiteral(b.dbType, v))
+	b.template.WriteString(placeholder(b.dbType, len(b.args)))
+}
+
+// statement ends the literal form with a semicolon; the template is left
+// without one since some drivers refuse it in a prepared statement
+func (b *statementBuilder) statement() dataStatement {
+	return dataStatement{
+		sql:      b.literal.String() + ";",
+		template: b.template.String(),
+		args:     b.args,
+	}
+}
+
+// sqlLiteral renders a value as an SQL literal for the given engine
+func sqlLiteral(dbType DBType, val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32, float64:
+		return fmt.Sprintf("%v", v)
+	case bool:
+		switch {
+		case dbType == PostgreSQL && v:
+			return "TRUE"
+		case dbType == PostgreSQL:
+			return "FALSE"
+		case v:
+			return "1"
+		default:
+			return "0"
+		}
+	case []byte:
+		switch dbType {
+		case PostgreSQL:
+			return fmt.Sprintf("'\\x%s'::bytea", hex.EncodeToString(v))
+		case SQLServer:
+			return "0x" + hex.EncodeToString(v)
+		default:
+			return fmt.Sprintf("X'%s'", hex.EncodeToString(v))
+		}
+	case time.Time:
+		if dbType != PostgreSQL {
+			v = v.UTC()
+		}
+		return "'" + v.Format(timeLiteralLayout(dbType)) + "'"
+	default:
+		return quoteString(dbType, fmt.Sprintf("%v", v))
+	}
+}
+
+// timeLiteralLayout is the timestamp format each engine parses. PostgreSQL
+// keeps the offset, which timestamptz honours and timestamp ignores; the
+// others get UTC, as the drivers read and bind it. SQL Server's datetime2
+// takes at most seven fractional digits.
+func timeLiteralLayout(dbType DBType) string {
+	switch dbType {
+	case PostgreSQL:
+		return "2006-01-02 15:04:05.999999999-07:00"
+	case SQLServer:
+		return "2006-01-02 15:04:05.9999999"
+	default:
+		return "2006-01-02 15:04:05.999999999"
+	}
+}
+
+// quoteString quotes text as a string literal. MySQL also treats backslash
+// as an escape character unless NO_BACKSLASH_ESCAPES is set, and SQL Server
+// needs the N prefix to keep characters outside the database code page.
+func quoteString(dbType DBType, s string) string {
+	quoted := "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	switch dbType {
+	case MySQL, "":
+		return strings.ReplaceAll(quoted, `\`, `\\`)
+	case SQLServer:
+		return "N" + quoted
+	default:
+		return quoted
+	}
+}
@@ -34,7 +34,7 @@ func GetTableData(config ConnectionConfig, tableName string, page, pageSize int)
 
 	// Get total count
 	var totalCount int
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(dbType, tableName))
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteTableName(dbType, tableName))
 	err = db.QueryRow(countQuery).Scan(&totalCount)
 	if err != nil {
 		return nil, err
@@ -63,11 +63,11 @@ func GetTableData(config ConnectionConfig, tableName string, page, pageSize int)
 	case SQLServer:
 		// SQL Server uses OFFSET FETCH
 		query = fmt.Sprintf("SELECT %s FROM %s ORDER BY (SELECT NULL) OFFSET %d ROWS FETCH NEXT %d ROWS ONLY",
-			strings.Join(quotedCols, ", "), quoteIdentifier(dbType, tableName), offset, pageSize)
+			strings.Join(quotedCols, ", "), quoteTableName(dbType, tableName), offset, pageSize)
 	default:
 		// MySQL, PostgreSQL, SQLite use LIMIT OFFSET
 		query = fmt.Sprintf("SELECT %s FROM %s LIMIT %d OFFSET %d",
-			strings.Join(quotedCols, ", "), quoteIdentifier(dbType, tableName), pageSize, offset)
+			strings.Join(quotedCols, ", "), quoteTableName(dbType, tableName), pageSize, offset)
 	}
 
 	rows, err := db.Query(query)
@@ -117,18 +117,7 @@ func GetTableStructure(config ConnectionConfig, tableName string) (*TableInfo, e
 	}
 	defer db.Close()
 
-	switch config.Type {
-	case MySQL, "":
-		return getMySQLTableInfo(db, tableName)
-	case PostgreSQL:
-		return getPostgreSQLTableInfo(db, tableName)
-	case SQLite:
-		return getSQLiteTableInfo(db, tableName)
-	case SQLServer:
-		return getSQLServerTableInfo(db, tableName)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", config.Type)
-	}
+	return tableInfo(db, config.Type, tableName)
 }
 
 // GetAllTables returns all tables with basic info
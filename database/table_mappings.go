@@ -0,0 +1,210 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TableMapping pairs a source table with the target table it syncs to
+type TableMapping struct {
+	Source string `json:"source"`
+	// Target table name; empty for the source table's name
+	Target  string        `json:"target,omitempty"`
+	Filter  string        `json:"filter,omitempty"`
+	Columns ColumnMapping `json:"columns"`
+	// Columns identifying a row, for tables without a usable primary key
+	Key []string `json:"key,omitempty"`
+}
+
+// MappingSet is a saved list of table mappings, so a database whose tables
+// are named differently on the target can be synced in one job
+type MappingSet struct {
+	Name   string         `json:"name"`
+	Tables []TableMapping `json:"tables"`
+}
+
+// Apply returns config set up to sync the tables of the mapping set
+func (m MappingSet) Apply(config DataSyncConfig) DataSyncConfig {
+	config.Tables = nil
+	config.TargetTables = make(map[string]string)
+	config.Filters = make(map[string]string)
+	config.Columns = make(map[string]ColumnMapping)
+	config.Keys = make(map[string][]string)
+	for _, t := range m.Tables {
+		config.Tables = append(config.Tables, t.Source)
+		if t.Target != "" && t.Target != t.Source {
+			config.TargetTables[t.Source] = t.Target
+		}
+		if t.Filter != "" {
+			config.Filters[t.Source] = t.Filter
+		}
+		if len(t.Columns.Include) > 0 || len(t.Columns.Exclude) > 0 || len(t.Columns.Rename) > 0 {
+			config.Columns[t.Source] = t.Columns
+		}
+		if len(t.Key) > 0 {
+			config.Keys[t.Source] = t.Key
+		}
+	}
+	return config
+}
+
+// validate checks that the set names each source table once
+func (m MappingSet) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("mapping set has no name")
+	}
+	seen := make(map[string]bool)
+	for _, t := range m.Tables {
+		if t.Source == "" {
+			return fmt.Errorf("mapping set %s has a table with no source name", m.Name)
+		}
+		if seen[t.Source] {
+			return fmt.Errorf("mapping set %s maps table %s more than once", m.Name, t.Source)
+		}
+		seen[t.Source] = true
+	}
+	return nil
+}
+
+// MapTablesByPrefix pairs each source table with the target table of the
+// same name after swapping sourcePrefix for targetPrefix, such as stg_orders
+// with orders. Source tables without the prefix or without a matching
+// target table are left out. The prefix follows any schema in the name.
+func MapTablesByPrefix(sourceTables, targetTables []string, sourcePrefix, targetPrefix string) []TableMapping {
+	targets := make(map[string]bool)
+	for _, t := range targetTables {
+		targets[t] = true
+	}
+
+	var mappings []TableMapping
+	for _, source := range sourceTables {
+		schema, name := "", source
+		if i := strings.LastIndex(source, "."); i >= 0 {
+			schema, name = source[:i+1], source[i+1:]
+		}
+		if !strings.HasPrefix(name, sourcePrefix) {
+			continue
+		}
+		target := schema + targetPrefix + strings.TrimPrefix(name, sourcePrefix)
+		if targets[target] {
+			mappings = append(mappings, TableMapping{Source: source, Target: target})
+		}
+	}
+	return mappings
+}
+
+// MappingStore manages saved mapping sets
+type MappingStore struct {
+	Sets     []MappingSet `json:"sets"`
+	filePath string
+	mu       sync.RWMutex
+}
+
+// NewMappingStore creates a new mapping set store
+func NewMappingStore() (*MappingStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	configDir := filepath.Join(homeDir, ".syncforge")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return nil, err
+	}
+
+	store := &MappingStore{
+		filePath: filepath.Join(configDir, "mappings.json"),
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads mapping sets from file
+func (s *MappingStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.Sets = []MappingSet{}
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.Sets)
+}
+
+// save writes mapping sets to file
+func (s *MappingStore) save() error {
+	data, err := json.MarshalIndent(s.Sets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath, data, 0600)
+}
+
+// GetAll returns all saved mapping sets
+func (s *MappingStore) GetAll() []MappingSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]MappingSet, len(s.Sets))
+	copy(result, s.Sets)
+	return result
+}
+
+// Get returns the mapping set with the given name
+func (s *MappingStore) Get(name string) (MappingSet, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.Sets {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MappingSet{}, false
+}
+
+// Save adds or updates a mapping set
+func (s *MappingStore) Save(set MappingSet) error {
+	if err := set.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, m := range s.Sets {
+		if m.Name == set.Name {
+			s.Sets[i] = set
+			return s.save()
+		}
+	}
+
+	s.Sets = append(s.Sets, set)
+	return s.save()
+}
+
+// Delete removes a mapping set by name
+func (s *MappingStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, m := range s.Sets {
+		if m.Name == name {
+			s.Sets = append(s.Sets[:i], s.Sets[i+1:]...)
+			return s.save()
+		}
+	}
+	return nil
+}
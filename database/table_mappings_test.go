@@ -0,0 +1,101 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapTablesByPrefix(t *testing.T) {
+	tests := []struct {
+		name                       string
+		sources, targets           []string
+		sourcePrefix, targetPrefix string
+		want                       []TableMapping
+	}{
+		{
+			name:         "strip prefix",
+			sources:      []string{"stg_orders", "stg_users", "stg_missing", "orders"},
+			targets:      []string{"orders", "users"},
+			sourcePrefix: "stg_",
+			want:         []TableMapping{{Source: "stg_orders", Target: "orders"}, {Source: "stg_users", Target: "users"}},
+		},
+		{
+			name:         "swap prefix",
+			sources:      []string{"old_orders"},
+			targets:      []string{"new_orders", "old_orders"},
+			sourcePrefix: "old_",
+			targetPrefix: "new_",
+			want:         []TableMapping{{Source: "old_orders", Target: "new_orders"}},
+		},
+		{
+			name:         "prefix after schema",
+			sources:      []string{"sales.stg_orders", "stg.orders"},
+			targets:      []string{"sales.orders", "orders"},
+			sourcePrefix: "stg_",
+			want:         []TableMapping{{Source: "sales.stg_orders", Target: "sales.orders"}},
+		},
+		{
+			name:         "add prefix",
+			sources:      []string{"orders"},
+			targets:      []string{"archive_orders"},
+			targetPrefix: "archive_",
+			want:         []TableMapping{{Source: "orders", Target: "archive_orders"}},
+		},
+		{
+			name:         "no match",
+			sources:      []string{"stg_orders"},
+			targets:      []string{"stg_orders"},
+			sourcePrefix: "stg_",
+			want:         nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MapTablesByPrefix(tt.sources, tt.targets, tt.sourcePrefix, tt.targetPrefix)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapTablesByPrefix = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingSetApply(t *testing.T) {
+	set := MappingSet{Name: "nightly", Tables: []TableMapping{
+		{Source: "stg_orders", Target: "orders", Filter: "tenant_id = 42", Key: []string{"code"}},
+		{Source: "users", Target: "users", Columns: ColumnMapping{Exclude: []string{"updated_at"}}},
+	}}
+	config := set.Apply(DataSyncConfig{Tables: []string{"unrelated"}})
+
+	if want := []string{"stg_orders", "users"}; !reflect.DeepEqual(config.Tables, want) {
+		t.Errorf("tables = %v, want %v", config.Tables, want)
+	}
+	if want := map[string]string{"stg_orders": "orders"}; !reflect.DeepEqual(config.TargetTables, want) {
+		t.Errorf("target tables = %v, want %v", config.TargetTables, want)
+	}
+	if want := map[string]string{"stg_orders": "tenant_id = 42"}; !reflect.DeepEqual(config.Filters, want) {
+		t.Errorf("filters = %v, want %v", config.Filters, want)
+	}
+	if want := map[string][]string{"stg_orders": {"code"}}; !reflect.DeepEqual(config.Keys, want) {
+		t.Errorf("keys = %v, want %v", config.Keys, want)
+	}
+	if _, ok := config.Columns["stg_orders"]; ok || len(config.Columns["users"].Exclude) != 1 {
+		t.Errorf("columns = %+v, want users only", config.Columns)
+	}
+}
+
+func TestMappingSetValidate(t *testing.T) {
+	tests := []struct {
+		set     MappingSet
+		wantErr bool
+	}{
+		{MappingSet{Name: "ok", Tables: []TableMapping{{Source: "a"}, {Source: "b", Target: "a"}}}, false},
+		{MappingSet{Tables: []TableMapping{{Source: "a"}}}, true},
+		{MappingSet{Name: "empty source", Tables: []TableMapping{{Target: "a"}}}, true},
+		{MappingSet{Name: "twice", Tables: []TableMapping{{Source: "a"}, {Source: "a", Target: "b"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.set.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%s) = %v, want error: %v", tt.set.Name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes, named as in libpq
+const (
+	TLSDisable    = "disable"
+	TLSPrefer     = "prefer"
+	TLSRequire    = "require"
+	TLSVerifyCA   = "verify-ca"
+	TLSVerifyFull = "verify-full"
+)
+
+// TLSConfig holds the encryption settings of a connection. As in libpq,
+// prefer and require check the certificate chain when a CA certificate is
+// given, unless SkipVerify is set, and prefer falls back to an unencrypted
+// connection only when the server does not offer TLS.
+type TLSConfig struct {
+	// disable, prefer, require, verify-ca or verify-full; empty keeps each
+	// driver's default
+	Mode string `json:"mode,omitempty"`
+	// PEM files
+	CACert     string `json:"caCert,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	// Name expected in the server certificate, when it is not the host
+	ServerName string `json:"serverName,omitempty"`
+	// Encrypt without checking the server certificate
+	SkipVerify bool `json:"skipVerify,omitempty"`
+}
+
+// mode returns the effective TLS mode, checking the settings agree
+func (t TLSConfig) mode() (string, error) {
+	mode := t.Mode
+	switch mode {
+	case "":
+		if t.SkipVerify {
+			mode = TLSRequire
+		}
+	case TLSDisable, TLSPrefer, TLSRequire:
+	case TLSVerifyCA, TLSVerifyFull:
+		if t.SkipVerify {
+			return "", fmt.Errorf("TLS mode %s cannot skip certificate verification", mode)
+		}
+	default:
+		return "", fmt.Errorf("unsupported TLS mode: %s", mode)
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return "", fmt.Errorf("TLS client certificate and key must be given together")
+	}
+	return mode, nil
+}
+
+// verifiesChain reports whether a mode checks the server certificate
+// against the CA
+func (t TLSConfig) verifiesChain(mode string) bool {
+	switch mode {
+	case TLSVerifyCA, TLSVerifyFull:
+		return true
+	case TLSPrefer, TLSRequire:
+		return t.CACert != "" && !t.SkipVerify
+	}
+	return false
+}
+
+// buildTLSConfig returns the crypto/tls settings for a connection to host.
+// verify-ca, and prefer or require with a CA certificate, check the
+// certificate chain but not the name in it, which crypto/tls only does as
+// part of a full verification.
+func buildTLSConfig(t TLSConfig, mode, host string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host}
+	if t.ServerName != "" {
+		cfg.ServerName = t.ServerName
+	}
+
+	if t.CACert != "" {
+		pem, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CACert)
+		}
+	}
+	if t.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch {
+	case mode == TLSVerifyFull:
+	case t.verifiesChain(mode):
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: cfg.RootCAs, Intermediates: x509.NewCertPool()}
+			for _, cert := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	default:
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// mysqlTLSParams returns the TLS parameters of a MySQL DSN, registering
+// the settings with the driver under a name derived from them when the
+// driver's own presets do not cover them
+func mysqlTLSParams(config ConnectionConfig) (string, error) {
+	t := config.TLS
+	mode, err := t.mode()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case mode == "":
+		return "", nil
+	case mode == TLSDisable:
+		return "&tls=false", nil
+	case mode == TLSPrefer && t.CACert == "" && t.ClientCert == "":
+		return "&tls=preferred", nil
+	}
+
+	cfg, err := buildTLSConfig(t, mode, config.Host)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("syncforge-%x", sha256.Sum256([]byte(fmt.Sprintf("%s:%d|%s|%#v", config.Host, config.Port, mode, t))))[:26]
+	if err := mysql.RegisterTLSConfig(name, cfg); err != nil {
+		return "", err
+	}
+	params := "&tls=" + name
+	if mode == TLSPrefer {
+		// A registered configuration is otherwise mandatory
+		params += "&allowFallbackToPlaintext=true"
+	}
+	return params, nil
+}
+
+// postgresTLSParams returns the sslmode and certificate settings of a
+// PostgreSQL DSN. Without a mode the connection stays unencrypted, and
+// prefer starts as require, which Connect falls back from.
+func postgresTLSParams(t TLSConfig) (string, error) {
+	mode, err := t.mode()
+	if err != nil {
+		return "", err
+	}
+	if t.ServerName != "" {
+		return "", fmt.Errorf("PostgreSQL checks the certificate against the host; a separate server name is not supported")
+	}
+
+	switch mode {
+	case "", TLSDisable:
+		return " sslmode=disable", nil
+	case TLSPrefer:
+		mode = TLSRequire
+	}
+	params := " sslmode=" + mode
+	// lib/pq checks the chain of a required connection given a root certificate
+	if t.verifiesChain(mode) && t.CACert != "" {
+		params += " sslrootcert=" + postgresDSNValue(t.CACert)
+	}
+	if t.ClientCert != "" {
+		params += " sslcert=" + postgresDSNValue(t.ClientCert) + " sslkey=" + postgresDSNValue(t.ClientKey)
+	}
+	return params, nil
+}
+
+// postgresDSNValue quotes a value of a key=value PostgreSQL DSN
+func postgresDSNValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// sqlServerTLSParams returns the encryption settings of a SQL Server DSN
+func sqlServerTLSParams(t TLSConfig) (string, error) {
+	mode, err := t.mode()
+	if err != nil {
+		return "", err
+	}
+	if t.ClientCert != "" {
+		return "", fmt.Errorf("SQL Server connections do not support TLS client certificates")
+	}
+	if (mode == TLSPrefer || mode == TLSRequire) && t.verifiesChain(mode) {
+		return "", fmt.Errorf("SQL Server connections check a CA certificate in verify-full mode only")
+	}
+
+	var params string
+	switch mode {
+	case "":
+		return "", nil
+	case TLSDisable:
+		return ";encrypt=disable", nil
+	case TLSPrefer:
+		// The driver encrypts the login, and everything if the server insists
+		params = ";encrypt=false;TrustServerCertificate=true"
+	case TLSRequire:
+		params = ";encrypt=true;TrustServerCertificate=true"
+	case TLSVerifyCA:
+		return "", fmt.Errorf("SQL Server connections support verify-full but not verify-ca")
+	case TLSVerifyFull:
+		params = ";encrypt=true;TrustServerCertificate=false"
+	}
+	if t.CACert != "" {
+		params += ";certificate=" + t.CACert
+	}
+	if t.ServerName != "" {
+		params += ";hostNameInCertificate=" + t.ServerName
+	}
+	return params, nil
+}
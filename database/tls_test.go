@@ -0,0 +1,358 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testCA is a certificate authority that issues server certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string // PEM file of the CA certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, path: path}
+}
+
+// issue returns a certificate for host signed by the CA, and the paths of
+// its PEM certificate and key files
+func (ca *testCA) issue(t *testing.T, host string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, certPath, keyPath
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	trusted, certPath, keyPath := ca.issue(t, "db.example.com")
+	untrusted, _, _ := newTestCA(t).issue(t, "db.example.com")
+
+	tests := []struct {
+		name     string
+		tls      TLSConfig
+		mode     string
+		wantName string
+		// How the chain is checked: "none", "chain" through
+		// VerifyConnection, or "full" by crypto/tls itself
+		wantCheck string
+	}{
+		{name: "require", tls: TLSConfig{}, mode: TLSRequire, wantName: "db.example.com", wantCheck: "none"},
+		{name: "prefer", tls: TLSConfig{}, mode: TLSPrefer, wantName: "db.example.com", wantCheck: "none"},
+		{name: "require with CA", tls: TLSConfig{CACert: ca.path}, mode: TLSRequire, wantName: "db.example.com", wantCheck: "chain"},
+		{name: "prefer with CA", tls: TLSConfig{CACert: ca.path}, mode: TLSPrefer, wantName: "db.example.com", wantCheck: "chain"},
+		{name: "require with CA skipping verification", tls: TLSConfig{CACert: ca.path, SkipVerify: true}, mode: TLSRequire, wantName: "db.example.com", wantCheck: "none"},
+		{name: "verify-ca", tls: TLSConfig{CACert: ca.path}, mode: TLSVerifyCA, wantName: "db.example.com", wantCheck: "chain"},
+		{name: "verify-full", tls: TLSConfig{CACert: ca.path}, mode: TLSVerifyFull, wantName: "db.example.com", wantCheck: "full"},
+		{name: "server name", tls: TLSConfig{CACert: ca.path, ServerName: "other.example.com"}, mode: TLSVerifyFull, wantName: "other.example.com", wantCheck: "full"},
+		{name: "client certificate", tls: TLSConfig{ClientCert: certPath, ClientKey: keyPath}, mode: TLSRequire, wantName: "db.example.com", wantCheck: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := buildTLSConfig(tt.tls, tt.mode, "db.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.ServerName != tt.wantName {
+				t.Errorf("ServerName = %q, want %q", cfg.ServerName, tt.wantName)
+			}
+			if (tt.tls.ClientCert != "") != (len(cfg.Certificates) == 1) {
+				t.Errorf("%d client certificates", len(cfg.Certificates))
+			}
+			switch tt.wantCheck {
+			case "none":
+				if !cfg.InsecureSkipVerify || cfg.VerifyConnection != nil {
+					t.Error("certificate is checked")
+				}
+			case "full":
+				if cfg.InsecureSkipVerify || cfg.RootCAs == nil {
+					t.Error("certificate is not fully verified")
+				}
+			case "chain":
+				if !cfg.InsecureSkipVerify || cfg.VerifyConnection == nil {
+					t.Fatal("chain is not checked")
+				}
+				if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{trusted}}); err != nil {
+					t.Errorf("trusted certificate rejected: %v", err)
+				}
+				if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{untrusted}}); err == nil {
+					t.Error("untrusted certificate accepted")
+				}
+				if err := cfg.VerifyConnection(tls.ConnectionState{}); err == nil {
+					t.Error("missing certificate accepted")
+				}
+			}
+		})
+	}
+
+	if _, err := buildTLSConfig(TLSConfig{CACert: filepath.Join(t.TempDir(), "missing.pem")}, TLSVerifyFull, "h"); err == nil {
+		t.Error("missing CA file accepted")
+	}
+	if _, err := buildTLSConfig(TLSConfig{CACert: keyPath}, TLSVerifyFull, "h"); err == nil {
+		t.Error("CA file without certificates accepted")
+	}
+}
+
+// TestBuildTLSConfigHandshake checks the settings against a real TLS server
+func TestBuildTLSConfigHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	_, certPath, keyPath := ca.issue(t, "db.example.com")
+	serverCert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA := newTestCA(t)
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		mode    string
+		host    string
+		wantErr bool
+	}{
+		{name: "require ignores the chain", tls: TLSConfig{CACert: otherCA.path, SkipVerify: true}, mode: TLSRequire, host: "127.0.0.1"},
+		{name: "require with the right CA", tls: TLSConfig{CACert: ca.path}, mode: TLSRequire, host: "127.0.0.1"},
+		{name: "require with the wrong CA", tls: TLSConfig{CACert: otherCA.path}, mode: TLSRequire, host: "127.0.0.1", wantErr: true},
+		{name: "verify-ca ignores the name", tls: TLSConfig{CACert: ca.path}, mode: TLSVerifyCA, host: "127.0.0.1"},
+		{name: "verify-full checks the name", tls: TLSConfig{CACert: ca.path}, mode: TLSVerifyFull, host: "127.0.0.1", wantErr: true},
+		{name: "verify-full through a tunnel", tls: TLSConfig{CACert: ca.path, ServerName: "db.example.com"}, mode: TLSVerifyFull, host: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			go func() {
+				conn, err := listener.Accept()
+				if err == nil {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}
+			}()
+
+			cfg, err := buildTLSConfig(tt.tls, tt.mode, tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", listener.Addr().String(), cfg)
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMySQLTLSParams(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		tls     TLSConfig
+		want    string // prefix of the parameters
+		wantErr bool
+	}{
+		{tls: TLSConfig{}, want: ""},
+		{tls: TLSConfig{Mode: TLSDisable}, want: "&tls=false"},
+		{tls: TLSConfig{Mode: TLSPrefer}, want: "&tls=preferred"},
+		{tls: TLSConfig{Mode: TLSPrefer, CACert: ca.path}, want: "&tls=syncforge-"},
+		{tls: TLSConfig{Mode: TLSRequire}, want: "&tls=syncforge-"},
+		{tls: TLSConfig{SkipVerify: true}, want: "&tls=syncforge-"},
+		{tls: TLSConfig{Mode: TLSVerifyFull, CACert: ca.path}, want: "&tls=syncforge-"},
+		{tls: TLSConfig{Mode: TLSVerifyFull, SkipVerify: true}, wantErr: true},
+		{tls: TLSConfig{Mode: "sometimes"}, wantErr: true},
+		{tls: TLSConfig{Mode: TLSRequire, ClientCert: "cert.pem"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := mysqlTLSParams(ConnectionConfig{Host: "db.example.com", Port: 3306, TLS: tt.tls})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("mysqlTLSParams(%+v) error = %v, wantErr %v", tt.tls, err, tt.wantErr)
+			continue
+		}
+		if !strings.HasPrefix(got, tt.want) || (tt.want == "" && got != "") {
+			t.Errorf("mysqlTLSParams(%+v) = %q, want %q...", tt.tls, got, tt.want)
+		}
+		// prefer stays optional with custom settings
+		fallback := strings.Contains(got, "&allowFallbackToPlaintext=true")
+		if want := tt.tls.Mode == TLSPrefer && tt.want != "&tls=preferred"; fallback != want {
+			t.Errorf("mysqlTLSParams(%+v) = %q, fallback to plaintext %v", tt.tls, got, fallback)
+		}
+	}
+}
+
+func TestPostgresTLSParams(t *testing.T) {
+	tests := []struct {
+		tls     TLSConfig
+		want    string
+		wantErr bool
+	}{
+		{tls: TLSConfig{}, want: " sslmode=disable"},
+		{tls: TLSConfig{Mode: TLSDisable}, want: " sslmode=disable"},
+		{tls: TLSConfig{Mode: TLSPrefer}, want: " sslmode=require"},
+		{tls: TLSConfig{Mode: TLSRequire}, want: " sslmode=require"},
+		{tls: TLSConfig{SkipVerify: true}, want: " sslmode=require"},
+		{tls: TLSConfig{Mode: TLSRequire, CACert: "/ca.pem"}, want: " sslmode=require sslrootcert='/ca.pem'"},
+		{tls: TLSConfig{Mode: TLSPrefer, CACert: "/ca.pem"}, want: " sslmode=require sslrootcert='/ca.pem'"},
+		{tls: TLSConfig{Mode: TLSRequire, CACert: "/ca.pem", SkipVerify: true}, want: " sslmode=require"},
+		{tls: TLSConfig{Mode: TLSVerifyCA, CACert: "/ca.pem"}, want: " sslmode=verify-ca sslrootcert='/ca.pem'"},
+		{tls: TLSConfig{Mode: TLSVerifyFull}, want: " sslmode=verify-full"},
+		{
+			tls:  TLSConfig{Mode: TLSRequire, ClientCert: "/my cert.pem", ClientKey: `/it's.key`},
+			want: ` sslmode=require sslcert='/my cert.pem' sslkey='/it\'s.key'`,
+		},
+		{tls: TLSConfig{Mode: TLSVerifyFull, ServerName: "db"}, wantErr: true},
+		{tls: TLSConfig{Mode: TLSVerifyCA, SkipVerify: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := postgresTLSParams(tt.tls)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("postgresTLSParams(%+v) error = %v, wantErr %v", tt.tls, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("postgresTLSParams(%+v) = %q, want %q", tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestSQLServerTLSParams(t *testing.T) {
+	tests := []struct {
+		tls     TLSConfig
+		want    string
+		wantErr bool
+	}{
+		{tls: TLSConfig{}, want: ""},
+		{tls: TLSConfig{Mode: TLSDisable}, want: ";encrypt=disable"},
+		{tls: TLSConfig{Mode: TLSPrefer}, want: ";encrypt=false;TrustServerCertificate=true"},
+		{tls: TLSConfig{Mode: TLSRequire}, want: ";encrypt=true;TrustServerCertificate=true"},
+		{tls: TLSConfig{Mode: TLSRequire, CACert: "/ca.pem", SkipVerify: true}, want: ";encrypt=true;TrustServerCertificate=true;certificate=/ca.pem"},
+		{
+			tls:  TLSConfig{Mode: TLSVerifyFull, CACert: "/ca.pem", ServerName: "db.example.com"},
+			want: ";encrypt=true;TrustServerCertificate=false;certificate=/ca.pem;hostNameInCertificate=db.example.com",
+		},
+		// SQL Server cannot check the chain without the name
+		{tls: TLSConfig{Mode: TLSRequire, CACert: "/ca.pem"}, wantErr: true},
+		{tls: TLSConfig{Mode: TLSPrefer, CACert: "/ca.pem"}, wantErr: true},
+		{tls: TLSConfig{Mode: TLSVerifyCA, CACert: "/ca.pem"}, wantErr: true},
+		{tls: TLSConfig{Mode: TLSRequire, ClientCert: "/c.pem", ClientKey: "/c.key"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sqlServerTLSParams(tt.tls)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sqlServerTLSParams(%+v) error = %v, wantErr %v", tt.tls, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("sqlServerTLSParams(%+v) = %q, want %q", tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestStartTunnelKeepsServerName(t *testing.T) {
+	server := newTestSSHServer(t, "s3cret", nil)
+	echo := newEchoServer(t)
+	echoHost, echoPort, _ := net.SplitHostPort(echo)
+	sshConfig := SSHConfig{Host: "127.0.0.1", Port: server.port(), User: "tunnel", Password: "s3cret",
+		HostKeyFingerprint: ssh.FingerprintSHA256(server.hostKey.PublicKey())}
+	port, _ := strconv.Atoi(echoPort)
+
+	for _, dbType := range []DBType{MySQL, SQLServer} {
+		tunnel, config, err := startTunnel(ConnectionConfig{Type: dbType, Host: echoHost, Port: port, SSH: sshConfig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.TLS.ServerName != echoHost {
+			t.Errorf("%s: ServerName = %q, want %q", dbType, config.TLS.ServerName, echoHost)
+		}
+		roundTrip(t, config.Host, config.Port)
+		tunnel.Close()
+	}
+
+	// lib/pq checks verify-full against the DSN host, so it stays, and the
+	// dialer reaches the tunnel whatever address it is asked for
+	tunnel, config, err := startTunnel(ConnectionConfig{Type: PostgreSQL, Host: echoHost, Port: port, SSH: sshConfig,
+		TLS: TLSConfig{Mode: TLSVerifyFull}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	if config.Host != echoHost || config.Port != port || config.TLS.ServerName != "" {
+		t.Errorf("PostgreSQL config changed: %+v", config)
+	}
+	conn, err := tunnelDialer{tunnel}.DialTimeout("tcp", "db.example.com:5432", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo through tunnelDialer = %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// normalizeRow converts the values of a row, as scanned from any of the
+// drivers, to one Go type per kind of column, so rows from different
+// engines compare alike and statements for the target are written from
+// portable values rather than another driver's representation
+func (v *valueComparer) normalizeRow(row map[string]interface{}) map[string]interface{} {
+	for col, value := range row {
+		row[col] = coerceValue(value, v.kinds[col])
+	}
+	return row
+}
+
+// coerceValue converts a value to the Go type a column of the given kind
+// expects: bool for MySQL tinyint(1), BIT(1) and SQLite integers, int64,
+// decimal text so no digits are lost, float64, time.Time for MySQL DATETIME
+// read without parseTime and SQLite text timestamps, string for NVARCHAR
+// and other text, []byte, or UUID text. Values that do not convert, such
+// as MySQL zero dates, are left unchanged.
+func coerceValue(value interface{}, kind valueKind) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch kind {
+	case kindInteger:
+		if r, ok := toRat(value); ok && r.IsInt() && r.Num().IsInt64() {
+			return r.Num().Int64()
+		}
+	case kindFloat:
+		if f, ok := toFloat(value); ok {
+			return f
+		}
+	case kindDecimal:
+		if f, ok := value.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return fmt.Sprintf("%v", value)
+	case kindBool:
+		if b, ok := toBool(value); ok {
+			return b
+		}
+	case kindTime:
+		if t, ok := toTime(value); ok {
+			return t
+		}
+	case kindBinary:
+		if s, ok := value.(string); ok {
+			return []byte(s)
+		}
+	case kindUUID:
+		return normalizeUUID(value)
+	case kindText:
+		switch value.(type) {
+		case string, []byte:
+		default:
+			return fmt.Sprintf("%v", value)
+		}
+	}
+	return value
+}
+
+// normalizeUUID returns a UUID in its lowercase text form. SQL Server
+// returns uniqueidentifier as 16 bytes with the first three groups stored
+// little-endian, which scanRow has turned into a 16 byte string.
+func normalizeUUID(value interface{}) interface{} {
+	var b []byte
+	switch x := value.(type) {
+	case []byte:
+		b = x
+	case string:
+		if len(x) != 16 {
+			return strings.ToLower(strings.TrimSpace(x))
+		}
+		b = []byte(x)
+	default:
+		return value
+	}
+	if len(b) != 16 {
+		return value
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8:10], b[10:16])
+}
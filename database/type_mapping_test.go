@@ -0,0 +1,57 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoerceValue(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		kind  valueKind
+		want  interface{}
+	}{
+		{"nil", nil, kindInteger, nil},
+		{"integer from text", "42", kindInteger, int64(42)},
+		{"integer from float", float64(7), kindInteger, int64(7)},
+		{"fractional integer unchanged", "4.5", kindInteger, "4.5"},
+		{"float from text", "2.5", kindFloat, 2.5},
+		{"decimal keeps digits", "12345678901234567890.123", kindDecimal, "12345678901234567890.123"},
+		{"decimal from float", 0.1, kindDecimal, "0.1"},
+		{"bool from tinyint", int64(1), kindBool, true},
+		{"bool from bit", "\x00", kindBool, false},
+		{"bool from text", "yes", kindBool, true},
+		{"time from text", "2024-03-01 12:30:45.123", kindTime, ts},
+		{"zero date unchanged", "0000-00-00 00:00:00", kindTime, "0000-00-00 00:00:00"},
+		{"binary from text", "\x00\x01", kindBinary, []byte{0, 1}},
+		{"text from number", int64(5), kindText, "5"},
+		{"text kept", "abc", kindText, "abc"},
+		{"uuid lowercased", " 6F9619FF-8B86-D011-B42D-00C04FC964FF ", kindUUID, "6f9619ff-8b86-d011-b42d-00c04fc964ff"},
+		{"other unchanged", int64(3), kindOther, int64(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coerceValue(tt.value, tt.kind); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coerceValue(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUUID(t *testing.T) {
+	// uniqueidentifier bytes as SQL Server sends them
+	raw := []byte{0xff, 0x19, 0x96, 0x6f, 0x86, 0x8b, 0x11, 0xd0, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff}
+	want := "6f9619ff-8b86-d011-b42d-00c04fc964ff"
+	if got := normalizeUUID(raw); got != want {
+		t.Errorf("normalizeUUID(bytes) = %v, want %s", got, want)
+	}
+	if got := normalizeUUID(string(raw)); got != want {
+		t.Errorf("normalizeUUID(string) = %v, want %s", got, want)
+	}
+	if got := normalizeUUID([]byte{1, 2}); !reflect.DeepEqual(got, []byte{1, 2}) {
+		t.Errorf("normalizeUUID(short) = %v, want it unchanged", got)
+	}
+}
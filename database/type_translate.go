@@ -0,0 +1,1034 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TypeConversion records a column, or index, that could not be carried to
+// another engine unchanged, such as an unsigned integer widened to a larger
+// type or an ENUM whose allowed values are no longer enforced
+type TypeConversion struct {
+	Column     string `json:"column"`
+	SourceType string `json:"sourceType,omitempty"`
+	TargetType string `json:"targetType,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+// typeClass is the engine-neutral kind of a column type
+type typeClass int
+
+const (
+	classOther typeClass = iota
+	classBool
+	classTinyInt
+	classSmallInt
+	classInt
+	classBigInt
+	classDecimal
+	classFloat
+	classDouble
+	classChar
+	classVarchar
+	classText
+	classBinary
+	classVarbinary
+	classBlob
+	classDate
+	classTime
+	classDateTime
+	classTimestampTZ
+	classJSON
+	classUUID
+	classEnum
+	classSet
+)
+
+// columnType is a column type in engine-neutral form
+type columnType struct {
+	class typeClass
+	// Characters or bytes; 0 for unbounded
+	length int
+	// Digits of a decimal, or fractional second digits of a time
+	precision int
+	scale     int
+	unsigned  bool
+	// Allowed values of an ENUM or SET
+	values        []string
+	autoIncrement bool
+	// Why the source type lost something on the way in, such as money
+	note string
+}
+
+var (
+	typeArgsRe     = regexp.MustCompile(`\(([^()]*)\)`)
+	quotedValueRe  = regexp.MustCompile(`'((?:[^']|'')*)'`)
+	numberRe       = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+	postgresCastRe = regexp.MustCompile(`(?s)^('(?:[^']|'')*'|NULL)::.+$`)
+)
+
+// splitColumnType breaks a type such as "int(10) unsigned" or
+// "timestamp(3) without time zone" into its lowercase name, with the
+// parenthesised arguments and modifiers removed, and the arguments
+func splitColumnType(colType string) (name string, args []string, unsigned bool) {
+	t := strings.ToLower(strings.TrimSpace(colType))
+	if m := typeArgsRe.FindStringSubmatch(t); m != nil {
+		for _, arg := range strings.Split(m[1], ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+	}
+	var words []string
+	for _, word := range strings.Fields(typeArgsRe.ReplaceAllString(t, " ")) {
+		switch word {
+		case "unsigned":
+			unsigned = true
+		case "signed", "zerofill":
+		default:
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " "), args, unsigned
+}
+
+// typeArg returns the i-th numeric type argument, or def if there is none.
+// SQL Server's max reads as 0, meaning unbounded.
+func typeArg(args []string, i, def int) int {
+	if i >= len(args) {
+		return def
+	}
+	if args[i] == "max" {
+		return 0
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// parseColumnType reads a column type as reported by a srcType database
+func parseColumnType(srcType DBType, colType string) columnType {
+	name, args, unsigned := splitColumnType(colType)
+	t := columnType{unsigned: unsigned}
+	// Values may hold parentheses, so ENUM and SET go by their prefix
+	lower := strings.ToLower(strings.TrimSpace(colType))
+	if strings.HasPrefix(lower, "enum(") || strings.HasPrefix(lower, "set(") {
+		name = lower[:strings.Index(lower, "(")]
+	}
+
+	switch name {
+	case "bool", "boolean":
+		t.class = classBool
+	case "bit":
+		t.class = classBool
+		if typeArg(args, 0, 1) > 1 {
+			t.class = classOther
+		}
+	case "tinyint", "int1":
+		t.class = classTinyInt
+		if srcType == MySQL && typeArg(args, 0, 0) == 1 {
+			t.class = classBool
+		}
+		// SQL Server's tinyint holds 0 to 255
+		if srcType == SQLServer {
+			t.unsigned = true
+		}
+	case "smallint", "int2", "smallserial", "serial2", "year":
+		t.class = classSmallInt
+	case "mediumint", "int3":
+		// Even unsigned, a mediumint fits a signed int
+		t.class = classInt
+		t.unsigned = false
+	case "int", "integer", "int4", "serial", "serial4":
+		t.class = classInt
+		// SQLite integers are 64 bit whatever their declared type
+		if srcType == SQLite {
+			t.class = classBigInt
+		}
+	case "bigint", "int8", "bigserial", "serial8":
+		t.class = classBigInt
+	case "decimal", "numeric", "dec", "fixed":
+		t.class = classDecimal
+		t.precision = typeArg(args, 0, 0)
+		t.scale = typeArg(args, 1, 0)
+		if t.precision == 0 && srcType == MySQL {
+			t.precision = 10
+		}
+		if t.precision == 0 && srcType == SQLServer {
+			t.precision = 18
+		}
+	case "money":
+		t.class = classDecimal
+		t.precision, t.scale = 19, 4
+		if srcType == PostgreSQL {
+			t.scale = 2
+		}
+		t.note = fmt.Sprintf("money becomes decimal(%d,%d); currency formatting is not kept", t.precision, t.scale)
+	case "smallmoney":
+		t.class = classDecimal
+		t.precision, t.scale = 10, 4
+		t.note = "smallmoney becomes decimal(10,4); currency formatting is not kept"
+	case "real", "float4":
+		// REAL is 8 bytes in MySQL and SQLite, 4 in PostgreSQL and SQL Server
+		t.class = classFloat
+		if srcType == MySQL || srcType == SQLite {
+			t.class = classDouble
+		}
+	case "float":
+		t.class = classDouble
+		if p := typeArg(args, 0, 0); (p > 0 && p <= 24) || (p == 0 && srcType == MySQL) {
+			t.class = classFloat
+		}
+	case "double", "double precision", "float8":
+		t.class = classDouble
+	case "char", "character", "nchar", "bpchar", "national char", "national character":
+		t.class = classChar
+		t.length = typeArg(args, 0, 1)
+		if t.length == 0 {
+			t.class = classText
+		}
+	case "varchar", "character varying", "nvarchar", "varchar2", "nvarchar2", "national varchar",
+		"national character varying", "varying character", "native character":
+		t.class = classVarchar
+		t.length = typeArg(args, 0, 0)
+		if t.length == 0 {
+			t.class = classText
+		}
+	case "text", "tinytext", "mediumtext", "longtext", "ntext", "clob", "string":
+		t.class = classText
+	case "citext":
+		t.class = classText
+		t.note = "citext becomes case-sensitive text"
+	case "binary":
+		t.class = classBinary
+		t.length = typeArg(args, 0, 1)
+	case "varbinary":
+		t.class = classVarbinary
+		t.length = typeArg(args, 0, 0)
+		if t.length == 0 {
+			t.class = classBlob
+		}
+	case "blob", "tinyblob", "mediumblob", "longblob", "bytea", "image":
+		t.class = classBlob
+	case "date":
+		t.class = classDate
+	case "time", "time without time zone":
+		t.class = classTime
+		t.precision = typeArg(args, 0, defaultTimePrecision(srcType))
+	case "time with time zone", "timetz":
+		t.class = classTime
+		t.precision = typeArg(args, 0, 6)
+		t.note = "time with time zone loses its offset"
+	case "datetime", "timestamp", "timestamp without time zone", "datetime2", "smalldatetime":
+		t.class = classDateTime
+		t.precision = typeArg(args, 0, defaultTimePrecision(srcType))
+		switch {
+		case srcType == SQLServer && name == "timestamp":
+			// SQL Server's timestamp is a row version, not a time
+			t = columnType{class: classBinary, length: 8, note: "row version becomes binary(8) and is no longer set by the database"}
+		case srcType == SQLServer && name == "datetime":
+			t.precision = 3
+		case name == "smalldatetime":
+			t.precision = 0
+		}
+	case "rowversion":
+		t = columnType{class: classBinary, length: 8, note: "row version becomes binary(8) and is no longer set by the database"}
+	case "timestamptz", "timestamp with time zone", "datetimeoffset":
+		t.class = classTimestampTZ
+		t.precision = typeArg(args, 0, defaultTimePrecision(srcType))
+	case "json", "jsonb":
+		t.class = classJSON
+	case "uuid", "uniqueidentifier":
+		t.class = classUUID
+	case "enum", "set":
+		t.class = classEnum
+		if name == "set" {
+			t.class = classSet
+		}
+		for _, m := range quotedValueRe.FindAllStringSubmatch(colType, -1) {
+			t.values = append(t.values, strings.ReplaceAll(m[1], "''", "'"))
+		}
+	default:
+		t.class = sqliteAffinityClass(srcType, name)
+	}
+	return t
+}
+
+// defaultTimePrecision returns the fractional second digits of a time type
+// declared without any
+func defaultTimePrecision(srcType DBType) int {
+	switch srcType {
+	case MySQL:
+		return 0
+	case SQLServer:
+		return 7
+	default:
+		return 6
+	}
+}
+
+// sqliteAffinityClass classes a SQLite type name by the affinity rules
+// SQLite itself applies to names it does not know
+func sqliteAffinityClass(srcType DBType, name string) typeClass {
+	if srcType != SQLite || name == "" {
+		return classOther
+	}
+	switch {
+	case strings.Contains(name, "int"):
+		return classBigInt
+	case strings.Contains(name, "char"), strings.Contains(name, "clob"), strings.Contains(name, "text"):
+		return classText
+	case strings.Contains(name, "blob"):
+		return classBlob
+	case strings.Contains(name, "real"), strings.Contains(name, "floa"), strings.Contains(name, "doub"):
+		return classDouble
+	default:
+		return classDecimal
+	}
+}
+
+// Limits of the target engines
+var (
+	maxDecimalPrecision = map[DBType]int{MySQL: 65, PostgreSQL: 1000, SQLServer: 38, SQLite: 1000}
+	maxDecimalScale     = map[DBType]int{MySQL: 30, PostgreSQL: 1000, SQLServer: 38, SQLite: 1000}
+	maxTimePrecision    = map[DBType]int{MySQL: 6, PostgreSQL: 6, SQLServer: 7, SQLite: 9}
+)
+
+// renderColumnType writes t as a dbType column type. The second result
+// explains what the type cannot hold that the source type could, if anything.
+func renderColumnType(dbType DBType, t columnType) (string, string) {
+	var notes []string
+	if t.note != "" {
+		notes = append(notes, t.note)
+	}
+
+	// Only MySQL has unsigned types; elsewhere take the next larger type
+	unsigned := t.unsigned && dbType == MySQL
+	class := t.class
+	if t.unsigned && dbType != MySQL {
+		switch class {
+		case classTinyInt, classSmallInt, classInt:
+			// SQL Server's tinyint is unsigned, SQLite's integers all 64 bit
+			if class != classTinyInt || dbType != SQLServer {
+				class++
+				if dbType != SQLite {
+					notes = append(notes, "no unsigned types; widened to keep the range")
+				}
+			}
+		case classBigInt:
+			if t.autoIncrement {
+				notes = append(notes, "unsigned values above 9223372036854775807 no longer fit")
+			} else {
+				class = classDecimal
+				t.precision, t.scale = 20, 0
+				notes = append(notes, "no unsigned types; unsigned bigint becomes decimal(20,0)")
+			}
+		case classDecimal, classFloat, classDouble:
+			notes = append(notes, "negative values are no longer rejected")
+		}
+	}
+	if class == classTinyInt && dbType == SQLServer && !t.unsigned {
+		// SQL Server's tinyint cannot hold negative values
+		class = classSmallInt
+	}
+
+	if class == classDecimal {
+		if t.precision == 0 && dbType != PostgreSQL && dbType != SQLite {
+			t.precision, t.scale = 38, 10
+			notes = append(notes, "unbounded numeric becomes decimal(38,10)")
+		}
+		if max := maxDecimalPrecision[dbType]; t.precision > max {
+			t.precision = max
+			notes = append(notes, fmt.Sprintf("precision reduced to %d digits", max))
+		}
+		if max := maxDecimalScale[dbType]; t.scale > max {
+			t.scale = max
+			notes = append(notes, fmt.Sprintf("scale reduced to %d digits", max))
+		}
+		if dbType == SQLite && (t.precision == 0 || t.precision > 15 || t.scale > 0) {
+			notes = append(notes, "SQLite may store decimals as 8-byte floating point")
+		}
+	}
+	if class == classTime || class == classDateTime || class == classTimestampTZ {
+		if max := maxTimePrecision[dbType]; t.precision > max {
+			t.precision = max
+			notes = append(notes, fmt.Sprintf("fractional seconds rounded to %d digits", max))
+		}
+	}
+
+	var typ string
+	switch dbType {
+	case PostgreSQL:
+		typ = postgresTypeName(class, t, &notes)
+	case SQLite:
+		typ = sqliteTypeName(class, t, &notes)
+	case SQLServer:
+		typ = sqlServerTypeName(class, t, &notes)
+	default:
+		typ = mysqlTypeName(class, t, &notes)
+		if unsigned && class >= classTinyInt && class <= classDouble {
+			typ += " unsigned"
+		}
+	}
+	return typ, strings.Join(notes, "; ")
+}
+
+// enumLength returns the longest value of an ENUM, or the longest a SET
+// value can be with all its members
+func enumLength(t columnType) int {
+	n := 1
+	total := 0
+	for _, v := range t.values {
+		if len(v) > n {
+			n = len(v)
+		}
+		total += len(v) + 1
+	}
+	if t.class == classSet && total > n {
+		return total - 1
+	}
+	return n
+}
+
+func enumNote(t columnType, typ string) string {
+	if t.class == classSet {
+		return fmt.Sprintf("SET becomes %s; members are no longer checked", typ)
+	}
+	return fmt.Sprintf("ENUM becomes %s; allowed values are no longer enforced", typ)
+}
+
+func mysqlTypeName(class typeClass, t columnType, notes *[]string) string {
+	switch class {
+	case classBool:
+		return "tinyint(1)"
+	case classTinyInt:
+		return "tinyint"
+	case classSmallInt:
+		return "smallint"
+	case classInt:
+		return "int"
+	case classBigInt:
+		return "bigint"
+	case classDecimal:
+		return fmt.Sprintf("decimal(%d,%d)", t.precision, t.scale)
+	case classFloat:
+		return "float"
+	case classDouble:
+		return "double"
+	case classChar:
+		if t.length <= 255 {
+			return fmt.Sprintf("char(%d)", t.length)
+		}
+		return fmt.Sprintf("varchar(%d)", t.length)
+	case classVarchar:
+		if t.length <= 16383 {
+			return fmt.Sprintf("varchar(%d)", t.length)
+		}
+		return "longtext"
+	case classText:
+		return "longtext"
+	case classBinary:
+		if t.length <= 255 {
+			return fmt.Sprintf("binary(%d)", t.length)
+		}
+		return fmt.Sprintf("varbinary(%d)", t.length)
+	case classVarbinary:
+		if t.length <= 65535 {
+			return fmt.Sprintf("varbinary(%d)", t.length)
+		}
+		return "longblob"
+	case classBlob:
+		return "longblob"
+	case classDate:
+		return "date"
+	case classTime:
+		return withPrecision("time", t.precision, 0)
+	case classDateTime:
+		return withPrecision("datetime", t.precision, 0)
+	case classTimestampTZ:
+		*notes = append(*notes, "time zone offsets are not kept; values are stored in UTC")
+		return withPrecision("datetime", t.precision, 0)
+	case classJSON:
+		return "json"
+	case classUUID:
+		return "char(36)"
+	case classEnum, classSet:
+		var quoted []string
+		for _, v := range t.values {
+			quoted = append(quoted, "'"+strings.ReplaceAll(v, "'", "''")+"'")
+		}
+		kind := "enum"
+		if class == classSet {
+			kind = "set"
+		}
+		return fmt.Sprintf("%s(%s)", kind, strings.Join(quoted, ","))
+	default:
+		*notes = append(*notes, "no equivalent type; stored as text")
+		return "longtext"
+	}
+}
+
+func postgresTypeName(class typeClass, t columnType, notes *[]string) string {
+	switch class {
+	case classBool:
+		return "boolean"
+	case classTinyInt, classSmallInt:
+		return "smallint"
+	case classInt:
+		return "integer"
+	case classBigInt:
+		return "bigint"
+	case classDecimal:
+		if t.precision == 0 {
+			return "numeric"
+		}
+		return fmt.Sprintf("numeric(%d,%d)", t.precision, t.scale)
+	case classFloat:
+		return "real"
+	case classDouble:
+		return "double precision"
+	case classChar:
+		return fmt.Sprintf("char(%d)", t.length)
+	case classVarchar:
+		return fmt.Sprintf("varchar(%d)", t.length)
+	case classText:
+		return "text"
+	case classBinary, classVarbinary, classBlob:
+		return "bytea"
+	case classDate:
+		return "date"
+	case classTime:
+		return withPrecision("time", t.precision, 6)
+	case classDateTime:
+		return withPrecision("timestamp", t.precision, 6)
+	case classTimestampTZ:
+		return withPrecision("timestamp", t.precision, 6) + " with time zone"
+	case classJSON:
+		return "jsonb"
+	case classUUID:
+		return "uuid"
+	case classEnum, classSet:
+		typ := fmt.Sprintf("varchar(%d)", enumLength(t))
+		*notes = append(*notes, enumNote(t, typ))
+		return typ
+	default:
+		*notes = append(*notes, "no equivalent type; stored as text")
+		return "text"
+	}
+}
+
+func sqlServerTypeName(class typeClass, t columnType, notes *[]string) string {
+	switch class {
+	case classBool:
+		return "bit"
+	case classTinyInt:
+		return "tinyint"
+	case classSmallInt:
+		return "smallint"
+	case classInt:
+		return "int"
+	case classBigInt:
+		return "bigint"
+	case classDecimal:
+		return fmt.Sprintf("decimal(%d,%d)", t.precision, t.scale)
+	case classFloat:
+		return "real"
+	case classDouble:
+		return "float"
+	case classChar:
+		if t.length <= 4000 {
+			return fmt.Sprintf("nchar(%d)", t.length)
+		}
+		return "nvarchar(max)"
+	case classVarchar:
+		if t.length <= 4000 {
+			return fmt.Sprintf("nvarchar(%d)", t.length)
+		}
+		return "nvarchar(max)"
+	case classText:
+		return "nvarchar(max)"
+	case classBinary:
+		if t.length <= 8000 {
+			return fmt.Sprintf("binary(%d)", t.length)
+		}
+		return "varbinary(max)"
+	case classVarbinary:
+		if t.length <= 8000 {
+			return fmt.Sprintf("varbinary(%d)", t.length)
+		}
+		return "varbinary(max)"
+	case classBlob:
+		return "varbinary(max)"
+	case classDate:
+		return "date"
+	case classTime:
+		return fmt.Sprintf("time(%d)", t.precision)
+	case classDateTime:
+		return fmt.Sprintf("datetime2(%d)", t.precision)
+	case classTimestampTZ:
+		return fmt.Sprintf("datetimeoffset(%d)", t.precision)
+	case classJSON:
+		*notes = append(*notes, "no JSON type; stored as text and not validated")
+		return "nvarchar(max)"
+	case classUUID:
+		return "uniqueidentifier"
+	case classEnum, classSet:
+		typ := fmt.Sprintf("nvarchar(%d)", enumLength(t))
+		*notes = append(*notes, enumNote(t, typ))
+		return typ
+	default:
+		*notes = append(*notes, "no equivalent type; stored as text")
+		return "nvarchar(max)"
+	}
+}
+
+func sqliteTypeName(class typeClass, t columnType, notes *[]string) string {
+	switch class {
+	case classBool:
+		return "BOOLEAN"
+	case classTinyInt, classSmallInt, classInt, classBigInt:
+		return "INTEGER"
+	case classDecimal:
+		if t.precision == 0 {
+			return "NUMERIC"
+		}
+		return fmt.Sprintf("NUMERIC(%d,%d)", t.precision, t.scale)
+	case classFloat, classDouble:
+		return "REAL"
+	case classChar, classVarchar, classText, classUUID:
+		return "TEXT"
+	case classBinary, classVarbinary, classBlob:
+		return "BLOB"
+	case classDate:
+		return "DATE"
+	case classTime:
+		return "TIME"
+	case classDateTime:
+		return "DATETIME"
+	case classTimestampTZ:
+		*notes = append(*notes, "time zone offsets are not kept; values are stored in UTC")
+		return "DATETIME"
+	case classJSON:
+		*notes = append(*notes, "no JSON type; stored as text and not validated")
+		return "TEXT"
+	case classEnum, classSet:
+		*notes = append(*notes, enumNote(t, "TEXT"))
+		return "TEXT"
+	default:
+		*notes = append(*notes, "no equivalent type; stored as text")
+		return "TEXT"
+	}
+}
+
+// withPrecision appends fractional second digits unless they are the
+// engine's default
+func withPrecision(name string, precision, def int) string {
+	if precision == def {
+		return name
+	}
+	return fmt.Sprintf("%s(%d)", name, precision)
+}
+
+// Kinds of column default
+const (
+	defaultLiteral = iota
+	defaultNow
+	defaultUUID
+	defaultExpression
+)
+
+// columnDefault is a column default in engine-neutral form
+type columnDefault struct {
+	kind int
+	// The literal value, unquoted, or the expression as the source wrote it
+	value string
+}
+
+// parseDefault reads a default as a srcType database reports it: a bare
+// value for MySQL, an expression with casts for PostgreSQL, an expression
+// in parentheses for SQL Server and the expression as written for SQLite.
+// A NULL default reads as nil.
+func parseDefault(srcType DBType, col ColumnInfo) *columnDefault {
+	if col.Default == nil {
+		return nil
+	}
+	raw := strings.TrimSpace(*col.Default)
+	if srcType == SQLServer || srcType == PostgreSQL {
+		raw = stripOuterParens(raw)
+	}
+	if m := postgresCastRe.FindStringSubmatch(raw); srcType == PostgreSQL && m != nil {
+		raw = m[1]
+	}
+	upper := strings.ToUpper(raw)
+
+	// MySQL reports literals unquoted; expressions are flagged in Extra
+	if srcType == MySQL && !strings.Contains(col.Extra, "DEFAULT_GENERATED") && !isSpecialDefault(raw) {
+		if strings.HasPrefix(upper, "B'") && strings.HasSuffix(raw, "'") {
+			// bit literal
+			n, err := strconv.ParseInt(raw[2:len(raw)-1], 2, 64)
+			if err == nil {
+				return &columnDefault{kind: defaultLiteral, value: strconv.FormatInt(n, 10)}
+			}
+		}
+		return &columnDefault{kind: defaultLiteral, value: raw}
+	}
+
+	switch {
+	case upper == "NULL":
+		return nil
+	case strings.HasPrefix(upper, "N'") && strings.HasSuffix(raw, "'") && len(raw) >= 3:
+		return &columnDefault{kind: defaultLiteral, value: strings.ReplaceAll(raw[2:len(raw)-1], "''", "'")}
+	case strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") && len(raw) >= 2:
+		return &columnDefault{kind: defaultLiteral, value: strings.ReplaceAll(raw[1:len(raw)-1], "''", "'")}
+	case numberRe.MatchString(raw):
+		return &columnDefault{kind: defaultLiteral, value: raw}
+	case upper == "TRUE":
+		return &columnDefault{kind: defaultLiteral, value: "1"}
+	case upper == "FALSE":
+		return &columnDefault{kind: defaultLiteral, value: "0"}
+	}
+
+	fn := stripOuterParens(strings.ReplaceAll(upper, " ", ""))
+	if i := strings.Index(fn, "("); i >= 0 && !strings.HasPrefix(fn, "DATETIME(") {
+		fn = fn[:i]
+	}
+	switch fn {
+	case "CURRENT_TIMESTAMP", "NOW", "LOCALTIMESTAMP", "LOCALTIME", "GETDATE", "SYSDATETIME",
+		"SYSDATETIMEOFFSET", "CURRENT_DATE", "CURRENT_TIME", "DATETIME('NOW')", "DATETIME('NOW','LOCALTIME')":
+		return &columnDefault{kind: defaultNow, value: raw}
+	case "UUID", "GEN_RANDOM_UUID", "UUID_GENERATE_V4", "NEWID", "NEWSEQUENTIALID":
+		return &columnDefault{kind: defaultUUID, value: raw}
+	}
+	return &columnDefault{kind: defaultExpression, value: raw}
+}
+
+// stripOuterParens removes parentheses enclosing a whole expression, as
+// SQL Server puts around defaults, such as ((0)) or (getdate())
+func stripOuterParens(s string) string {
+	for len(s) >= 2 && s[0] == '(' && s[len(s)-1] == ')' {
+		depth := 0
+		for i := 0; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 && i < len(s)-1 {
+				return s
+			}
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// renderDefault writes a default for a dbType column of the given class, in the form
+// the engine's columnDef expects. It returns false for defaults the engine
+// cannot express.
+func renderDefault(dbType DBType, class typeClass, precision int, d columnDefault) (string, bool) {
+	switch d.kind {
+	case defaultLiteral:
+		return renderLiteralDefault(dbType, class, d.value)
+	case defaultNow:
+		return renderNowDefault(dbType, class, precision)
+	case defaultUUID:
+		switch {
+		case class != classUUID && class != classChar && class != classVarchar:
+			return "", false
+		case dbType == MySQL:
+			return "(UUID())", true
+		case dbType == PostgreSQL && class == classUUID:
+			return "gen_random_uuid()", true
+		case dbType == SQLServer:
+			return "NEWID()", true
+		}
+	}
+	return "", false
+}
+
+func renderLiteralDefault(dbType DBType, class typeClass, value string) (string, bool) {
+	switch {
+	case class == classBool:
+		var b bool
+		switch strings.ToLower(value) {
+		case "1", "t", "true", "y", "yes", "on":
+			b = true
+		case "0", "f", "false", "n", "no", "off":
+		default:
+			return "", false
+		}
+		if dbType == PostgreSQL {
+			return strings.ToUpper(strconv.FormatBool(b)), true
+		}
+		if b {
+			return "1", true
+		}
+		return "0", true
+	case class >= classTinyInt && class <= classDouble:
+		if !numberRe.MatchString(value) {
+			return "", false
+		}
+		return value, true
+	case dbType == MySQL:
+		// MySQL takes no literal default for its text, blob and json types.
+		// Others are written bare, as MySQL reports them, and quoted by
+		// columnDef unless they read as an expression.
+		switch class {
+		case classText, classBlob, classJSON, classOther:
+			return "", false
+		}
+		if isSpecialDefault(value) {
+			return "", false
+		}
+		return value, true
+	case dbType == SQLServer && (class >= classChar && class <= classText || class == classEnum || class == classSet):
+		return "N'" + strings.ReplaceAll(value, "'", "''") + "'", true
+	default:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'", true
+	}
+}
+
+func renderNowDefault(dbType DBType, class typeClass, precision int) (string, bool) {
+	switch class {
+	case classDate:
+		switch dbType {
+		case MySQL:
+			return "(CURRENT_DATE)", true
+		case SQLServer:
+			return "CAST(GETDATE() AS date)", true
+		default:
+			return "CURRENT_DATE", true
+		}
+	case classTime:
+		switch dbType {
+		case MySQL:
+			return "(CURRENT_TIME)", true
+		case PostgreSQL:
+			return "LOCALTIME", true
+		case SQLServer:
+			return "CAST(SYSDATETIME() AS time)", true
+		default:
+			return "CURRENT_TIME", true
+		}
+	case classDateTime, classTimestampTZ:
+		switch dbType {
+		case MySQL:
+			// MySQL wants the precision of the column repeated
+			if precision > 0 {
+				return fmt.Sprintf("CURRENT_TIMESTAMP(%d)", precision), true
+			}
+			return "CURRENT_TIMESTAMP", true
+		case SQLServer:
+			if class == classTimestampTZ {
+				return "SYSDATETIMEOFFSET()", true
+			}
+			return "SYSDATETIME()", true
+		default:
+			return "CURRENT_TIMESTAMP", true
+		}
+	}
+	return "", false
+}
+
+// isAutoIncrement reports whether the database generates the column's values
+func isAutoIncrement(srcType DBType, table TableInfo, col ColumnInfo, pks []string) bool {
+	switch srcType {
+	case PostgreSQL:
+		return col.Default != nil && strings.HasPrefix(*col.Default, "nextval(")
+	case SQLServer:
+		return col.Extra == "IDENTITY"
+	case SQLite:
+		// Only a rowid alias declared AUTOINCREMENT; a plain INTEGER PRIMARY
+		// KEY takes explicit values as readily
+		return len(pks) == 1 && pks[0] == col.Name && strings.EqualFold(col.Type, "integer") &&
+			strings.Contains(strings.ToUpper(table.CreateSQL), "AUTOINCREMENT")
+	default:
+		return strings.Contains(strings.ToLower(col.Extra), "auto_increment")
+	}
+}
+
+// translateTable rewrites a table read from a srcType database so that the
+// dbType generator creates it with types, defaults and identity columns of
+// its own engine. Indexes on expressions and partial indexes are left out,
+// and everything that may lose or change data is reported.
+func translateTable(table TableInfo, srcType, dbType DBType) (TableInfo, []TypeConversion) {
+	if srcType == "" {
+		srcType = MySQL
+	}
+	if dbType == "" {
+		dbType = MySQL
+	}
+	var conversions []TypeConversion
+
+	out := table
+	out.CreateSQL = ""
+	pks := primaryKeyColumns(table)
+	columns := make(map[string]bool)
+	for _, col := range table.Columns {
+		columns[col.Name] = true
+	}
+
+	// Keys cannot use MySQL text or SQL Server max types
+	indexed := make(map[string]bool)
+	for _, pk := range pks {
+		indexed[pk] = true
+	}
+	for _, idx := range table.Indexes {
+		indexed[idx.Column] = true
+	}
+
+	out.Columns = make([]ColumnInfo, len(table.Columns))
+	for i, col := range table.Columns {
+		var notes []string
+		t := parseColumnType(srcType, col.Type)
+		t.autoIncrement = isAutoIncrement(srcType, table, col, pks)
+		if indexed[col.Name] && (t.class == classText || t.class == classVarchar) {
+			switch {
+			case dbType == MySQL && (t.class == classText || t.length > 16383):
+				t.class, t.length = classVarchar, 255
+				notes = append(notes, "indexed text limited to 255 characters")
+			case dbType == SQLServer && (t.class == classText || t.length > 450):
+				t.class, t.length = classVarchar, 450
+				notes = append(notes, "indexed text limited to 450 characters")
+			}
+		}
+		typ, note := renderColumnType(dbType, t)
+		if note != "" {
+			notes = append([]string{note}, notes...)
+		}
+
+		col.Type = typ
+		col.Extra = ""
+		if t.autoIncrement {
+			switch dbType {
+			case MySQL:
+				col.Extra = "auto_increment"
+			case SQLServer:
+				col.Extra = "IDENTITY"
+			case PostgreSQL:
+				serial := map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}
+				if s, ok := serial[typ]; ok {
+					col.Type = s
+				}
+			case SQLite:
+				if len(pks) != 1 || col.Type != "INTEGER" {
+					notes = append(notes, "SQLite only generates values for a single INTEGER PRIMARY KEY")
+				}
+			}
+		}
+		if srcType == MySQL {
+			extra := strings.ToUpper(table.Columns[i].Extra)
+			if strings.Contains(extra, "ON UPDATE") && dbType != MySQL {
+				notes = append(notes, "ON UPDATE CURRENT_TIMESTAMP is not kept")
+			}
+			if strings.Contains(strings.ReplaceAll(extra, "DEFAULT_GENERATED", ""), "GENERATED") {
+				notes = append(notes, "generated column becomes a plain column")
+			}
+		}
+
+		col.Default = nil
+		if d := parseDefault(srcType, table.Columns[i]); d != nil && !t.autoIncrement {
+			if def, ok := renderDefault(dbType, t.class, renderedPrecision(dbType, t), *d); ok {
+				col.Default = &def
+			} else {
+				notes = append(notes, fmt.Sprintf("default %s left out", d.value))
+			}
+		}
+
+		out.Columns[i] = col
+		if len(notes) > 0 {
+			conversions = append(conversions, TypeConversion{
+				Column:     col.Name,
+				SourceType: table.Columns[i].Type,
+				TargetType: col.Type,
+				Detail:     strings.Join(notes, "; "),
+			})
+		}
+	}
+
+	out.Indexes = nil
+	skipped := make(map[string]bool)
+	for _, idx := range table.Indexes {
+		if skipped[idx.Name] {
+			continue
+		}
+		partial := isPartialIndex(idx.Filter, idx.Definition)
+		if !columns[idx.Column] || partial {
+			skipped[idx.Name] = true
+			detail := fmt.Sprintf("index %s uses an expression and was left out", idx.Name)
+			if partial {
+				detail = fmt.Sprintf("partial index %s was left out", idx.Name)
+			}
+			conversions = append(conversions, TypeConversion{Detail: detail})
+			continue
+		}
+		idx.Definition = ""
+		out.Indexes = append(out.Indexes, idx)
+	}
+	// Drop columns already added of an index skipped part way through
+	if len(skipped) > 0 {
+		kept := out.Indexes[:0]
+		for _, idx := range out.Indexes {
+			if !skipped[idx.Name] {
+				kept = append(kept, idx)
+			}
+		}
+		out.Indexes = kept
+	}
+	return out, conversions
+}
+
+// renderedPrecision returns the fractional second digits a time column
+// gets on dbType
+func renderedPrecision(dbType DBType, t columnType) int {
+	if max := maxTimePrecision[dbType]; t.precision > max {
+		return max
+	}
+	return t.precision
+}
+
+// TranslateCreateTable renders a table read from a srcType database as the
+// statements creating it on a dbType database, with the conversions that
+// may lose or change data
+func TranslateCreateTable(table TableInfo, srcType, dbType DBType) ([]string, []TypeConversion) {
+	translated, conversions := translateTable(table, srcType, dbType)
+	return newDDLGenerator(dbType, dbType).createTable(translated), conversions
+}
+
+// createTableDiff returns the diff creating a table missing from the target,
+// translated to the target's engine when it differs from the source's
+func createTableDiff(gen ddlGenerator, srcType, dbType DBType, tableName string, table TableInfo) DiffResult {
+	diff := DiffResult{
+		Type:       "added",
+		TableName:  tableName,
+		ObjectType: "table",
+		Action:     "create",
+		Detail:     "Table exists in source but not in target",
+	}
+	if sameEngine(srcType, dbType) {
+		diff.SQL = joinStatements(gen.createTable(table))
+		return diff
+	}
+
+	stmts, conversions := TranslateCreateTable(table, srcType, dbType)
+	diff.SQL = joinStatements(stmts)
+	diff.Conversions = conversions
+	if len(conversions) > 0 {
+		diff.Detail += fmt.Sprintf(" (%d type conversion(s) to review)", len(conversions))
+	}
+	return diff
+}
+
+// sameEngine reports whether two database types are the same engine
+func sameEngine(a, b DBType) bool {
+	if a == "" {
+		a = MySQL
+	}
+	if b == "" {
+		b = MySQL
+	}
+	return a == b
+}
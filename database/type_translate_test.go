@@ -0,0 +1,85 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnType(t *testing.T) {
+	tests := []struct {
+		srcType DBType
+		colType string
+		want    columnType
+	}{
+		{MySQL, "int(10) unsigned zerofill", columnType{class: classInt, unsigned: true}},
+		{MySQL, "tinyint(1)", columnType{class: classBool}},
+		{SQLServer, "tinyint", columnType{class: classTinyInt, unsigned: true}},
+		{MySQL, "decimal", columnType{class: classDecimal, precision: 10}},
+		{PostgreSQL, "numeric(12,4)", columnType{class: classDecimal, precision: 12, scale: 4}},
+		{PostgreSQL, "character varying(40)", columnType{class: classVarchar, length: 40}},
+		{SQLServer, "nvarchar(max)", columnType{class: classText}},
+		{PostgreSQL, "timestamp(3) without time zone", columnType{class: classDateTime, precision: 3}},
+		{SQLServer, "datetime", columnType{class: classDateTime, precision: 3}},
+		{MySQL, "enum('a','it''s','(x)')", columnType{class: classEnum, values: []string{"a", "it's", "(x)"}}},
+		{SQLite, "int", columnType{class: classBigInt}},
+		{SQLite, "NVARCHAR(30)", columnType{class: classVarchar, length: 30}},
+		{SQLite, "MYTYPE", columnType{class: classDecimal}},
+		{PostgreSQL, "point", columnType{class: classOther}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.srcType)+" "+tt.colType, func(t *testing.T) {
+			if got := parseColumnType(tt.srcType, tt.colType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseColumnType = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateColumnType(t *testing.T) {
+	tests := []struct {
+		srcType  DBType
+		colType  string
+		dbType   DBType
+		want     string
+		wantNote bool
+	}{
+		{MySQL, "int(10) unsigned", PostgreSQL, "bigint", true},
+		{MySQL, "int(10) unsigned", SQLite, "INTEGER", false},
+		{MySQL, "bigint unsigned", PostgreSQL, "numeric(20,0)", true},
+		{MySQL, "tinyint(1)", PostgreSQL, "boolean", false},
+		{MySQL, "tinyint unsigned", SQLServer, "tinyint", false},
+		{MySQL, "tinyint", SQLServer, "smallint", false},
+		{SQLServer, "tinyint", MySQL, "tinyint unsigned", false},
+		{PostgreSQL, "numeric", MySQL, "decimal(38,10)", true},
+		{PostgreSQL, "numeric", PostgreSQL, "numeric", false},
+		{MySQL, "decimal(65,30)", SQLServer, "decimal(38,30)", true},
+		{PostgreSQL, "money", SQLServer, "decimal(19,2)", true},
+		{SQLServer, "datetime2", MySQL, "datetime(6)", true},
+		{SQLServer, "datetime", PostgreSQL, "timestamp(3)", false},
+		{MySQL, "datetime", PostgreSQL, "timestamp(0)", false},
+		{PostgreSQL, "timestamp with time zone", SQLServer, "datetimeoffset(6)", false},
+		{PostgreSQL, "timestamptz", MySQL, "datetime(6)", true},
+		{SQLServer, "timestamp", PostgreSQL, "bytea", true},
+		{SQLServer, "nvarchar(max)", MySQL, "longtext", false},
+		{MySQL, "varchar(20000)", MySQL, "longtext", false},
+		{MySQL, "enum('a','it''s')", PostgreSQL, "varchar(4)", true},
+		{MySQL, "set('a','bc')", SQLServer, "nvarchar(4)", true},
+		{PostgreSQL, "uuid", MySQL, "char(36)", false},
+		{PostgreSQL, "uuid", SQLServer, "uniqueidentifier", false},
+		{PostgreSQL, "jsonb", SQLServer, "nvarchar(max)", true},
+		{PostgreSQL, "real", MySQL, "float", false},
+		{MySQL, "real", PostgreSQL, "double precision", false},
+		{PostgreSQL, "point", MySQL, "longtext", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.srcType)+" "+tt.colType+" to "+string(tt.dbType), func(t *testing.T) {
+			got, note := renderColumnType(tt.dbType, parseColumnType(tt.srcType, tt.colType))
+			if got != tt.want {
+				t.Errorf("type = %q, want %q", got, tt.want)
+			}
+			if (note != "") != tt.wantNote {
+				t.Errorf("note = %q, want a note: %v", note, tt.wantNote)
+			}
+		})
+	}
+}
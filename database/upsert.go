@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkUpsertKey checks that the target table has a primary key or unique
+// index on exactly the key rows are matched on. Without one ON CONFLICT
+// fails, and ON DUPLICATE KEY and MERGE may write the wrong row.
+func (c *tableComparison) checkUpsertKey() error {
+	info, err := tableInfo(c.targetDB, c.targetType, c.targetTable)
+	if err != nil {
+		return fmt.Errorf("failed to read target indexes: %v", err)
+	}
+	if !isUniqueKey(*info, c.targetKeys) {
+		return fmt.Errorf("upsert needs a primary key or unique index on (%s) in %s; sync without upsert instead",
+			strings.Join(c.targetKeys, ", "), c.targetTable)
+	}
+	return nil
+}
+
+// isUniqueKey reports whether the primary key or a unique index that is not
+// partial covers exactly the given columns
+func isUniqueKey(table TableInfo, keys []string) bool {
+	sameColumns := func(columns []string) bool {
+		if len(columns) != len(keys) {
+			return false
+		}
+		for _, key := range keys {
+			found := false
+			for _, col := range columns {
+				if strings.EqualFold(col, key) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+
+	if sameColumns(primaryKeyColumns(table)) {
+		return true
+	}
+	for _, idx := range buildIndexDefs(table.Indexes) {
+		if idx.Unique && !isPartialIndex(idx.Filter, idx.Definition) && sameColumns(idx.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateUpsertSQL writes a row that may or may not exist in the target:
+// INSERT ... ON DUPLICATE KEY UPDATE on MySQL, INSERT ... ON CONFLICT DO
+// UPDATE on PostgreSQL and SQLite, and MERGE on SQL Server
+func generateUpsertSQL(dbType DBType, tableName string, row map[string]interface{}, columns, primaryKeys []string, kinds map[string]valueKind) dataStatement {
+	isPK := make(map[string]bool)
+	for _, pk := range primaryKeys {
+		isPK[pk] = true
+	}
+	var cols, updated []string
+	for _, col := range columns {
+		if _, ok := row[col]; ok {
+			cols = append(cols, col)
+			if !isPK[col] {
+				updated = append(updated, col)
+			}
+		}
+	}
+
+	if dbType == SQLServer {
+		return generateMergeSQL(tableName, row, cols, updated, primaryKeys, kinds)
+	}
+
+	b := newStatementBuilder(dbType)
+	b.sql(fmt.Sprintf("INSERT INTO %s (%s) VALUES (", quoteTableName(dbType, tableName), quotedColumnList(dbType, cols)))
+	for i, col := range cols {
+		if i > 0 {
+			b.sql(", ")
+		}
+		b.value(row[col], kinds[col])
+	}
+	b.sql(")")
+
+	sets := make([]string, len(updated))
+	switch dbType {
+	case MySQL, "":
+		for i, col := range updated {
+			sets[i] = fmt.Sprintf("%s = VALUES(%s)", quoteIdentifier(dbType, col), quoteIdentifier(dbType, col))
+		}
+		if len(sets) == 0 {
+			// A key-only row has nothing to update; assigning the key to
+			// itself keeps the statement a no-op for existing rows
+			pk := quoteIdentifier(dbType, primaryKeys[0])
+			sets = append(sets, pk+" = "+pk)
+		}
+		b.sql(" ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "))
+	default:
+		b.sql(fmt.Sprintf(" ON CONFLICT (%s)", quotedKeyList(dbType, primaryKeys)))
+		if len(updated) == 0 {
+			b.sql(" DO NOTHING")
+			break
+		}
+		for i, col := range updated {
+			sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", quoteIdentifier(dbType, col), quoteIdentifier(dbType, col))
+		}
+		b.sql(" DO UPDATE SET " + strings.Join(sets, ", "))
+	}
+	return b.statement()
+}
+
+// generateMergeSQL writes a SQL Server upsert as a MERGE of a one-row source
+func generateMergeSQL(tableName string, row map[string]interface{}, cols, updated, primaryKeys []string, kinds map[string]valueKind) dataStatement {
+	q := func(col string) string { return quoteIdentifier(SQLServer, col) }
+
+	b := newStatementBuilder(SQLServer)
+	b.sql(fmt.Sprintf("MERGE INTO %s AS t USING (VALUES (", quoteTableName(SQLServer, tableName)))
+	for i, col := range cols {
+		if i > 0 {
+			b.sql(", ")
+		}
+		b.value(row[col], kinds[col])
+	}
+	b.sql(fmt.Sprintf(")) AS s (%s) ON ", quotedColumnList(SQLServer, cols)))
+
+	conds := make([]string, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		conds[i] = fmt.Sprintf("t.%s = s.%s", q(pk), q(pk))
+	}
+	b.sql(strings.Join(conds, " AND "))
+
+	if len(updated) > 0 {
+		sets := make([]string, len(updated))
+		for i, col := range updated {
+			sets[i] = fmt.Sprintf("%s = s.%s", q(col), q(col))
+		}
+		b.sql(" WHEN MATCHED THEN UPDATE SET " + strings.Join(sets, ", "))
+	}
+
+	values := make([]string, len(cols))
+	for i, col := range cols {
+		values[i] = "s." + q(col)
+	}
+	b.sql(fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)", quotedColumnList(SQLServer, cols), strings.Join(values, ", ")))
+
+	// MERGE is the one statement SQL Server requires a semicolon after
+	stmt := b.statement()
+	stmt.template += ";"
+	return stmt
+}
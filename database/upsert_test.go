@@ -0,0 +1,117 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateUpsertSQL(t *testing.T) {
+	row := map[string]interface{}{"id": int64(1), "name": "it's", "total": 2.5}
+	columns := []string{"id", "name", "total", "missing"}
+	tests := []struct {
+		dbType       DBType
+		row          map[string]interface{}
+		wantSQL      string
+		wantTemplate string
+	}{
+		{MySQL, row,
+			"INSERT INTO `orders` (`id`, `name`, `total`) VALUES (1, 'it''s', 2.5) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `total` = VALUES(`total`);",
+			"INSERT INTO `orders` (`id`, `name`, `total`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `total` = VALUES(`total`)"},
+		{MySQL, map[string]interface{}{"id": int64(1)},
+			"INSERT INTO `orders` (`id`) VALUES (1) ON DUPLICATE KEY UPDATE `id` = `id`;",
+			"INSERT INTO `orders` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = `id`"},
+		{PostgreSQL, row,
+			`INSERT INTO "public"."orders" ("id", "name", "total") VALUES (1, 'it''s', 2.5) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "total" = EXCLUDED."total";`,
+			`INSERT INTO "public"."orders" ("id", "name", "total") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "total" = EXCLUDED."total"`},
+		{SQLite, map[string]interface{}{"id": int64(1)},
+			`INSERT INTO "orders" ("id") VALUES (1) ON CONFLICT ("id") DO NOTHING;`,
+			`INSERT INTO "orders" ("id") VALUES (?) ON CONFLICT ("id") DO NOTHING`},
+		{SQLServer, row,
+			"MERGE INTO [dbo].[orders] AS t USING (VALUES (1, N'it''s', 2.5)) AS s ([id], [name], [total]) ON t.[id] = s.[id] " +
+				"WHEN MATCHED THEN UPDATE SET [name] = s.[name], [total] = s.[total] " +
+				"WHEN NOT MATCHED THEN INSERT ([id], [name], [total]) VALUES (s.[id], s.[name], s.[total]);",
+			"MERGE INTO [dbo].[orders] AS t USING (VALUES (@p1, @p2, @p3)) AS s ([id], [name], [total]) ON t.[id] = s.[id] " +
+				"WHEN MATCHED THEN UPDATE SET [name] = s.[name], [total] = s.[total] " +
+				"WHEN NOT MATCHED THEN INSERT ([id], [name], [total]) VALUES (s.[id], s.[name], s.[total]);"},
+		{SQLServer, map[string]interface{}{"id": int64(1)},
+			"MERGE INTO [dbo].[orders] AS t USING (VALUES (1)) AS s ([id]) ON t.[id] = s.[id] " +
+				"WHEN NOT MATCHED THEN INSERT ([id]) VALUES (s.[id]);",
+			"MERGE INTO [dbo].[orders] AS t USING (VALUES (@p1)) AS s ([id]) ON t.[id] = s.[id] " +
+				"WHEN NOT MATCHED THEN INSERT ([id]) VALUES (s.[id]);"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dbType), func(t *testing.T) {
+			stmt := generateUpsertSQL(tt.dbType, "orders", tt.row, columns, []string{"id"}, nil)
+			if stmt.sql != tt.wantSQL {
+				t.Errorf("sql =\n%s\nwant\n%s", stmt.sql, tt.wantSQL)
+			}
+			if stmt.template != tt.wantTemplate {
+				t.Errorf("template =\n%s\nwant\n%s", stmt.template, tt.wantTemplate)
+			}
+			if len(stmt.args) != len(tt.row) {
+				t.Errorf("%d args, want %d", len(stmt.args), len(tt.row))
+			}
+		})
+	}
+}
+
+func TestGenerateUpsertSQLBindsBinary(t *testing.T) {
+	row := map[string]interface{}{"id": int64(7), "data": "\x00\xff"}
+	stmt := generateUpsertSQL(PostgreSQL, "blobs", row, []string{"id", "data"}, []string{"id"},
+		map[string]valueKind{"data": kindBinary})
+	want := []SQLArg{{Type: "int", Value: "7"}, newSQLArg([]byte("\x00\xff"))}
+	if !reflect.DeepEqual(stmt.args, want) {
+		t.Errorf("args = %v, want %v", stmt.args, want)
+	}
+}
+
+func TestIsUniqueKey(t *testing.T) {
+	table := TableInfo{
+		Columns: []ColumnInfo{{Name: "id", Key: "PRI"}, {Name: "email"}, {Name: "tenant_id"}, {Name: "code"}},
+		Indexes: []IndexInfo{
+			{Name: "uq_tenant_code", Column: "tenant_id", SeqInIdx: 1},
+			{Name: "uq_tenant_code", Column: "code", SeqInIdx: 2},
+			{Name: "ix_email", Column: "email", NonUnique: 1, SeqInIdx: 1},
+			{Name: "uq_live_code", Column: "code", SeqInIdx: 1, Filter: "deleted IS NULL"},
+		},
+	}
+	tests := []struct {
+		keys []string
+		want bool
+	}{
+		{[]string{"id"}, true},
+		{[]string{"ID"}, true},
+		{[]string{"code", "tenant_id"}, true},
+		{[]string{"tenant_id"}, false},
+		{[]string{"email"}, false},
+		{[]string{"code"}, false},
+		{[]string{"id", "email"}, false},
+	}
+	for _, tt := range tests {
+		if got := isUniqueKey(table, tt.keys); got != tt.want {
+			t.Errorf("isUniqueKey(%v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestUpsertNeedsUniqueKey(t *testing.T) {
+	source := newSQLiteFile(t, "source.db",
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, code TEXT NOT NULL, qty INTEGER)",
+		"INSERT INTO items VALUES (1, 'a', 1)")
+	target := newSQLiteFile(t, "target.db",
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, code TEXT NOT NULL, qty INTEGER)")
+	config := DataSyncConfig{SourceConfig: source, TargetConfig: target, TableName: "items",
+		SyncInsert: true, Upsert: true, Keys: map[string][]string{"items": {"code"}}}
+
+	if _, err := CompareDataSync(config); err == nil {
+		t.Error("upsert on a key without a unique index did not fail")
+	}
+	config.Keys = nil
+	diffs, err := CompareDataSync(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("%d differences, want 1", len(diffs))
+	}
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueKind is how the values of a column are compared
+type valueKind int
+
+const (
+	kindOther valueKind = iota
+	kindText
+	kindBinary
+	kindInteger
+	kindDecimal
+	kindFloat
+	kindTime
+	kindBool
+	kindUUID
+)
+
+// valueComparer compares row values by the kind of their column
+type valueComparer struct {
+	kinds    map[string]valueKind
+	options  DataCompareOptions
+	timeUnit time.Duration
+}
+
+func newValueComparer(sourceColumns, targetColumns []ColumnInfo, options DataCompareOptions) *valueComparer {
+	targetKinds := make(map[string]valueKind)
+	for _, col := range targetColumns {
+		targetKinds[col.Name] = columnKind(col.Type)
+	}
+
+	v := &valueComparer{kinds: make(map[string]valueKind), options: options}
+	for _, col := range sourceColumns {
+		v.kinds[col.Name] = mergeKinds(columnKind(col.Type), targetKinds[col.Name])
+	}
+
+	switch options.TimestampPrecision {
+	case "s":
+		v.timeUnit = time.Second
+	case "ms":
+		v.timeUnit = time.Millisecond
+	case "us":
+		v.timeUnit = time.Microsecond
+	}
+	return v
+}
+
+// columnKind classifies a column type as reported by getColumnInfo
+func columnKind(columnType string) valueKind {
+	t := strings.ToLower(strings.TrimSpace(columnType))
+	switch {
+	case t == "":
+		return kindOther
+	case t == "uuid", t == "uniqueidentifier":
+		return kindUUID
+	case strings.HasPrefix(t, "bool"), t == "bit", t == "bit(1)", strings.HasPrefix(t, "tinyint(1)"):
+		return kindBool
+	case strings.Contains(t, "timestamp"), strings.HasPrefix(t, "datetime"), t == "date", t == "smalldatetime":
+		return kindTime
+	case strings.Contains(t, "int") && !strings.Contains(t, "interval") && !strings.Contains(t, "point"):
+		return kindInteger
+	case strings.HasPrefix(t, "decimal"), strings.HasPrefix(t, "numeric"), strings.HasSuffix(t, "money"):
+		return kindDecimal
+	case strings.HasPrefix(t, "float"), strings.HasPrefix(t, "double"), strings.HasPrefix(t, "real"):
+		return kindFloat
+	case strings.Contains(t, "binary"), strings.Contains(t, "blob"), t == "bytea", t == "image":
+		return kindBinary
+	case strings.Contains(t, "char"), strings.Contains(t, "text"), strings.Contains(t, "clob"):
+		return kindText
+	default:
+		return kindOther
+	}
+}
+
+// mergeKinds picks the comparison for a column whose two sides differ in
+// type, preferring the one that parses values the most leniently
+func mergeKinds(a, b valueKind) valueKind {
+	if a == kindOther {
+		return b
+	}
+	if b == kindOther {
+		return a
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// rowsEqual reports whether two rows hold the same values
+func (v *valueComparer) rowsEqual(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for col, value := range a {
+		if !v.valuesEqual(v.kinds[col], value, b[col]) {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesEqual compares two values as the given kind, falling back to their
+// text form when either does not parse as that kind
+func (v *valueComparer) valuesEqual(kind valueKind, a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch kind {
+	case kindBool:
+		if x, ok := toBool(a); ok {
+			if y, ok := toBool(b); ok {
+				return x == y
+			}
+		}
+	case kindInteger, kindDecimal:
+		if x, ok := toRat(a); ok {
+			if y, ok := toRat(b); ok {
+				return x.Cmp(y) == 0
+			}
+		}
+	case kindFloat:
+		if x, ok := toFloat(a); ok {
+			if y, ok := toFloat(b); ok {
+				return x == y || math.Abs(x-y) <= v.options.FloatEpsilon
+			}
+		}
+	case kindTime:
+		if x, ok := toTime(a); ok {
+			if y, ok := toTime(b); ok {
+				d := x.Sub(y)
+				if d < 0 {
+					d = -d
+				}
+				return d == 0 || d < v.timeUnit
+			}
+		}
+	case kindUUID:
+		return strings.EqualFold(fmt.Sprintf("%v", normalizeUUID(a)), fmt.Sprintf("%v", normalizeUUID(b)))
+	case kindText, kindOther:
+		x, y := fmt.Sprintf("%v", a), fmt.Sprintf("%v", b)
+		if kind == kindText && v.options.IgnoreTrailingSpace {
+			x, y = strings.TrimRight(x, " "), strings.TrimRight(y, " ")
+		}
+		if kind == kindText && v.options.IgnoreCase {
+			return strings.EqualFold(x, y)
+		}
+		return x == y
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+// rowKey returns the canonical form of the given columns of a row, equal for
+// rows whose values are equal exactly. Values that only match within the
+// float or timestamp tolerances can still get different keys.
+func (v *valueComparer) rowKey(columns []string, row map[string]interface{}) string {
+	var b strings.Builder
+	for _, col := range columns {
+		b.WriteString(v.canonical(v.kinds[col], row[col]))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// canonical renders a value so that values equal as the given kind render
+// alike
+func (v *valueComparer) canonical(kind valueKind, value interface{}) string {
+	if value == nil {
+		return "\x01null"
+	}
+
+	switch kind {
+	case kindBool:
+		if x, ok := toBool(value); ok {
+			return strconv.FormatBool(x)
+		}
+	case kindInteger, kindDecimal:
+		if x, ok := toRat(value); ok {
+			return x.RatString()
+		}
+	case kindFloat:
+		if x, ok := toFloat(value); ok {
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+	case kindTime:
+		if x, ok := toTime(value); ok {
+			return x.UTC().Truncate(v.timeUnit).Format(time.RFC3339Nano)
+		}
+	case kindUUID:
+		return fmt.Sprintf("%v", normalizeUUID(value))
+	case kindText:
+		s := fmt.Sprintf("%v", value)
+		if v.options.IgnoreTrailingSpace {
+			s = strings.TrimRight(s, " ")
+		}
+		if v.options.IgnoreCase {
+			s = strings.ToLower(s)
+		}
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func toBool(value interface{}) (bool, bool) {
+	switch strings.ToLower(fmt.Sprintf("%v", value)) {
+	case "1", "t", "true", "y", "yes", "\x01":
+		return true, true
+	case "0", "f", "false", "n", "no", "\x00":
+		return false, true
+	}
+	return false, false
+}
+
+func toRat(value interface{}) (*big.Rat, bool) {
+	switch x := value.(type) {
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(x), true
+	case float32:
+		return toRat(float64(x))
+	}
+	return new(big.Rat).SetString(strings.TrimSpace(fmt.Sprintf("%v", value)))
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch x := value.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprintf("%v", value)), 64)
+	return f, err == nil
+}
+
+// timeLayouts are the text forms drivers return timestamps in when they do
+// not parse them, e.g. MySQL without parseTime
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02",
+}
+
+func toTime(value interface{}) (time.Time, bool) {
+	if t, ok := value.(time.Time); ok {
+		return t, true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
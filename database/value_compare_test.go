@@ -0,0 +1,94 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestColumnKind(t *testing.T) {
+	tests := map[string]valueKind{
+		"int(11)":                  kindInteger,
+		"bigint unsigned":          kindInteger,
+		"tinyint(1)":               kindBool,
+		"bit":                      kindBool,
+		"boolean":                  kindBool,
+		"decimal(10,2)":            kindDecimal,
+		"money":                    kindDecimal,
+		"double precision":         kindFloat,
+		"real":                     kindFloat,
+		"datetime(6)":              kindTime,
+		"timestamp with time zone": kindTime,
+		"interval":                 kindOther,
+		"point":                    kindOther,
+		"varbinary(16)":            kindBinary,
+		"bytea":                    kindBinary,
+		"nvarchar(50)":             kindText,
+		"uniqueidentifier":         kindUUID,
+		"":                         kindOther,
+	}
+	for columnType, want := range tests {
+		if got := columnKind(columnType); got != want {
+			t.Errorf("columnKind(%q) = %v, want %v", columnType, got, want)
+		}
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		options DataCompareOptions
+		kind    valueKind
+		a, b    interface{}
+		want    bool
+	}{
+		{"nulls", DataCompareOptions{}, kindText, nil, nil, true},
+		{"null and value", DataCompareOptions{}, kindText, nil, "", false},
+		{"integer across types", DataCompareOptions{}, kindInteger, int64(5), "5", true},
+		{"decimal scale", DataCompareOptions{}, kindDecimal, "1.50", "1.5", true},
+		{"bool across engines", DataCompareOptions{}, kindBool, int64(1), true, true},
+		{"float exact", DataCompareOptions{}, kindFloat, 0.1, 0.1, true},
+		{"float outside default", DataCompareOptions{}, kindFloat, 0.1, 0.1000001, false},
+		{"float within epsilon", DataCompareOptions{FloatEpsilon: 1e-6}, kindFloat, 0.1, 0.1000001, true},
+		{"float beyond epsilon", DataCompareOptions{FloatEpsilon: 1e-6}, kindFloat, 0.1, 0.100002, false},
+		{"time exact", DataCompareOptions{}, kindTime, base, base.Add(time.Microsecond), false},
+		{"time within ms", DataCompareOptions{TimestampPrecision: "ms"}, kindTime, base, base.Add(999 * time.Microsecond), true},
+		{"time beyond ms", DataCompareOptions{TimestampPrecision: "ms"}, kindTime, base, base.Add(time.Millisecond), false},
+		{"time within s, either order", DataCompareOptions{TimestampPrecision: "s"}, kindTime, base.Add(500 * time.Millisecond), base, true},
+		{"time from text", DataCompareOptions{}, kindTime, "2024-03-01 12:00:00", base, true},
+		{"trailing space", DataCompareOptions{}, kindText, "abc  ", "abc", false},
+		{"trailing space ignored", DataCompareOptions{IgnoreTrailingSpace: true}, kindText, "abc  ", "abc", true},
+		{"leading space kept", DataCompareOptions{IgnoreTrailingSpace: true}, kindText, " abc", "abc", false},
+		{"case", DataCompareOptions{}, kindText, "ABC", "abc", false},
+		{"case ignored", DataCompareOptions{IgnoreCase: true}, kindText, "ABC", "abc", true},
+		{"case ignored for text only", DataCompareOptions{IgnoreCase: true}, kindOther, "ABC", "abc", false},
+		{"uuid case", DataCompareOptions{}, kindUUID, "6F9619FF-8B86-D011-B42D-00C04FC964FF", "6f9619ff-8b86-d011-b42d-00c04fc964ff", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newValueComparer(nil, nil, tt.options)
+			if got := v.valuesEqual(tt.kind, tt.a, tt.b); got != tt.want {
+				t.Errorf("valuesEqual(%#v, %#v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	columns := []ColumnInfo{{Name: "id", Type: "int"}, {Name: "code", Type: "varchar(10)"}, {Name: "at", Type: "datetime"}}
+	v := newValueComparer(columns, columns, DataCompareOptions{IgnoreCase: true, IgnoreTrailingSpace: true, TimestampPrecision: "s"})
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := map[string]interface{}{"id": int64(1), "code": "AB ", "at": at.Add(300 * time.Millisecond)}
+	b := map[string]interface{}{"id": "1", "code": "ab", "at": "2024-03-01 12:00:00"}
+	keys := []string{"id", "code", "at"}
+	if v.rowKey(keys, a) != v.rowKey(keys, b) {
+		t.Errorf("rows equal under the options got different keys")
+	}
+	b["id"] = int64(2)
+	if v.rowKey(keys, a) == v.rowKey(keys, b) {
+		t.Errorf("rows with different ids got the same key")
+	}
+	if v.rowKey([]string{"code"}, map[string]interface{}{"code": nil}) == v.rowKey([]string{"code"}, map[string]interface{}{"code": "null"}) {
+		t.Errorf("NULL and the text null got the same key")
+	}
+}
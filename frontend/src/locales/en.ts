@@ -23,6 +23,7 @@ export default {
     user: 'User',
     password: 'Password',
     database: 'Database',
+    schemas: 'Schemas',
     dbFile: 'Database File',
     selectDatabase: '-- Select database --',
     connect: 'Connect',
@@ -40,7 +41,46 @@ export default {
     charset: 'Charset',
     collation: 'Collation',
     create: 'Create',
-    creating: 'Creating...'
+    creating: 'Creating...',
+    tls: 'TLS / SSL',
+    tlsMode: 'Mode',
+    tlsDefault: 'Driver default',
+    tlsCACert: 'CA Certificate',
+    tlsClientCert: 'Client Certificate',
+    tlsClientKey: 'Client Key',
+    tlsServerName: 'Server Name',
+    tlsSkipVerify: 'Skip certificate verification',
+    ssh: 'SSH Tunnel',
+    sshHost: 'SSH Host',
+    sshPort: 'SSH Port',
+    sshUser: 'SSH User',
+    sshPassword: 'SSH Password',
+    sshPrivateKey: 'Private Key',
+    sshPassphrase: 'Key Passphrase',
+    sshKnownHosts: 'known_hosts File',
+    sshHostKeyFingerprint: 'Host Key Fingerprint',
+    masterPassphrase: 'Master Passphrase',
+    masterPassphraseHint: 'Encrypts saved passwords. Leave empty to store them in plaintext again.',
+    newPassphrase: 'New Passphrase',
+    confirmPassphrase: 'Confirm Passphrase',
+    unlock: 'Unlock',
+    lock: 'Lock',
+    passwordPlaceholder: "Password, ${'{'}env:NAME{'}'} or ${'{'}file:/path{'}'}",
+    secretReferenceHint: "${'{'}env:NAME{'}'} reads an environment variable and ${'{'}file:/path{'}'} a file when connecting. Other values starting with ${'{'}, env: or file: are rejected.",
+    exportConnections: 'Export Connections',
+    importConnections: 'Import Connections',
+    export: 'Export',
+    stripPasswords: 'Leave out passwords',
+    exportPassphrase: 'Passphrase to encrypt passwords (optional)',
+    importHint: 'SyncForge exports, DBeaver data-sources.json or Navicat .ncx files',
+    onConflict: 'When a name is already saved',
+    conflictRename: 'Import under a new name',
+    conflictOverwrite: 'Overwrite',
+    conflictSkip: 'Skip',
+    importPassphrase: 'Passphrase of an encrypted export',
+    keepReferences: 'Keep environment variable and file references in passwords',
+    chooseFile: 'Choose File...',
+    importSummary: '{added} added, {overwritten} overwritten, {skipped} skipped'
   },
   schema: {
     compare: 'Compare Schemas',
@@ -97,15 +137,55 @@ export default {
     execute: 'Execute',
     connectFirst: 'Please connect to source database first',
     failedLoadTables: 'Failed to load tables',
+    syncRolledBack: '{type} of {table} ({pk}) failed, all changes were rolled back: {error}',
+    syncNotRolledBack: '{type} of {table} ({pk}) failed and the target may be partially updated: {error}',
+    syncApplied: 'Inserted {inserted}, updated {updated} and deleted {deleted} row(s)',
     copiedSQL: 'Copied {count} SQL statements',
-    noPK: 'No PK',
+    noPK: 'No key',
     pk: 'PK',
+    uniqueKey: 'Unique key',
+    uniqueKeyHint: 'No primary key: rows are matched on this NOT NULL unique index',
+    noKeyHint: 'No primary or unique key: rows are matched on all their values, and changed rows are synced as a delete and an insert',
+    keyColumns: 'Key columns',
+    keyColumnsHint: 'Columns that identify a row, unique on both sides, to use instead of the primary key',
+    allColumns: 'all columns',
     rows: 'rows',
     startingComparison: 'Starting comparison for {count} table(s)',
     comparingTable: 'Comparing table',
     comparedTable: 'Compared {table}: {count} difference(s)',
     errorComparing: 'Error comparing {table}',
-    comparisonComplete: 'Comparison complete: {count} total difference(s) found'
+    comparisonComplete: 'Comparison complete: {count} total difference(s) found',
+    checksumMode: 'Checksum mode',
+    checksumModeHint: 'Compare blocks of rows by server-side checksums and only read the blocks that differ. Needs both databases on the same engine.',
+    ignoreTrailingSpace: 'Ignore trailing spaces',
+    ignoreCase: 'Ignore case',
+    timestampPrecision: 'Timestamp precision',
+    exact: 'Exact',
+    microseconds: 'Microseconds',
+    milliseconds: 'Milliseconds',
+    seconds: 'Seconds',
+    floatEpsilon: 'Float tolerance',
+    upsertMode: 'Upsert mode',
+    tableOptions: 'Table options',
+    targetTable: 'Target table',
+    mappingSet: 'Mapping set',
+    mappingSetHint: 'Save the selected tables with their target tables, filters and columns, to sync them again in one job',
+    mappingSetName: 'Mapping set name',
+    loadMappingSet: 'Load',
+    saveMappingSet: 'Save',
+    failedSaveMappingSet: 'Failed to save mapping set',
+    rowFilter: 'Row filter',
+    rowFiltersHint: 'Only compare and sync the rows matching a condition, applied on both sides',
+    filterPlaceholder: 'e.g. tenant_id = 42',
+    excludeColumns: 'Ignored columns',
+    excludeColumnsPlaceholder: 'e.g. updated_at, updated_by',
+    renameColumns: 'Renamed columns',
+    renameColumnsHint: 'Source columns stored under another name in the target, as source:target',
+    renameColumnsPlaceholder: 'e.g. name:full_name',
+    upsertModeHint: 'Write new and changed rows as INSERT ... ON DUPLICATE KEY UPDATE, ON CONFLICT DO UPDATE or MERGE, so the sync can be safely re-run after a failure',
+    batchSize: 'Rows per INSERT',
+    bulkLoad: 'Bulk load inserts',
+    bulkLoadHint: 'Load inserted rows with COPY (PostgreSQL), bulk copy (SQL Server) or LOAD DATA LOCAL INFILE (MySQL, needs local_infile on the server, skips rows whose keys already exist)'
   },
   browser: {
     title: 'Table Browser',
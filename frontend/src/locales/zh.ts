@@ -23,6 +23,7 @@ export default {
     user: '用户名',
     password: '密码',
     database: '数据库',
+    schemas: '模式',
     dbFile: '数据库文件',
     selectDatabase: '-- 选择数据库 --',
     connect: '连接',
@@ -40,7 +41,46 @@ export default {
     charset: '字符集',
     collation: '排序规则',
     create: '创建',
-    creating: '创建中...'
+    creating: '创建中...',
+    tls: 'TLS / SSL',
+    tlsMode: '模式',
+    tlsDefault: '驱动默认',
+    tlsCACert: 'CA 证书',
+    tlsClientCert: '客户端证书',
+    tlsClientKey: '客户端私钥',
+    tlsServerName: '服务器名称',
+    tlsSkipVerify: '跳过证书验证',
+    ssh: 'SSH 隧道',
+    sshHost: 'SSH 主机',
+    sshPort: 'SSH 端口',
+    sshUser: 'SSH 用户',
+    sshPassword: 'SSH 密码',
+    sshPrivateKey: '私钥文件',
+    sshPassphrase: '私钥密码',
+    sshKnownHosts: 'known_hosts 文件',
+    sshHostKeyFingerprint: '主机密钥指纹',
+    masterPassphrase: '主密码',
+    masterPassphraseHint: '用于加密已保存的密码。留空则恢复为明文保存。',
+    newPassphrase: '新主密码',
+    confirmPassphrase: '确认主密码',
+    unlock: '解锁',
+    lock: '锁定',
+    passwordPlaceholder: "密码、${'{'}env:NAME{'}'} 或 ${'{'}file:/path{'}'}",
+    secretReferenceHint: "连接时 ${'{'}env:NAME{'}'} 读取环境变量，${'{'}file:/path{'}'} 读取文件。其他以 ${'{'}、env: 或 file: 开头的值会被拒绝。",
+    exportConnections: '导出连接',
+    importConnections: '导入连接',
+    export: '导出',
+    stripPasswords: '不导出密码',
+    exportPassphrase: '加密密码的口令（可选）',
+    importHint: '支持 SyncForge 导出文件、DBeaver data-sources.json 和 Navicat .ncx 文件',
+    onConflict: '名称已存在时',
+    conflictRename: '以新名称导入',
+    conflictOverwrite: '覆盖',
+    conflictSkip: '跳过',
+    importPassphrase: '加密导出文件的口令',
+    keepReferences: '保留密码中的环境变量和文件引用',
+    chooseFile: '选择文件...',
+    importSummary: '新增 {added} 个，覆盖 {overwritten} 个，跳过 {skipped} 个'
   },
   schema: {
     compare: '对比结构',
@@ -97,15 +137,55 @@ export default {
     execute: '执行',
     connectFirst: '请先连接源数据库',
     failedLoadTables: '加载表失败',
+    syncRolledBack: '{table} ({pk}) 的 {type} 执行失败，所有更改已回滚：{error}',
+    syncNotRolledBack: '{table} ({pk}) 的 {type} 执行失败，目标库可能已被部分更新：{error}',
+    syncApplied: '已插入 {inserted} 行，更新 {updated} 行，删除 {deleted} 行',
     copiedSQL: '已复制 {count} 条 SQL 语句',
-    noPK: '无主键',
+    noPK: '无键',
     pk: '主键',
+    uniqueKey: '唯一键',
+    uniqueKeyHint: '无主键：按此非空唯一索引匹配行',
+    noKeyHint: '无主键或唯一键：按所有列的值匹配行，变更的行以删除加插入同步',
+    keyColumns: '键列',
+    keyColumnsHint: '用于标识行的列，在两端均唯一，代替主键使用',
+    allColumns: '所有列',
     rows: '行',
     startingComparison: '开始对比 {count} 个表',
     comparingTable: '正在对比表',
     comparedTable: '已对比 {table}：{count} 个差异',
     errorComparing: '对比 {table} 时出错',
-    comparisonComplete: '对比完成：共发现 {count} 个差异'
+    comparisonComplete: '对比完成：共发现 {count} 个差异',
+    checksumMode: '校验和模式',
+    checksumModeHint: '在服务器端按数据块计算校验和，仅读取校验和不同的数据块。要求两个数据库为同一引擎。',
+    ignoreTrailingSpace: '忽略尾随空格',
+    ignoreCase: '忽略大小写',
+    timestampPrecision: '时间戳精度',
+    exact: '精确',
+    microseconds: '微秒',
+    milliseconds: '毫秒',
+    seconds: '秒',
+    floatEpsilon: '浮点容差',
+    upsertMode: 'Upsert 模式',
+    tableOptions: '表选项',
+    targetTable: '目标表',
+    mappingSet: '映射集',
+    mappingSetHint: '保存所选表及其目标表、过滤条件和列设置，以便一次性再次同步',
+    mappingSetName: '映射集名称',
+    loadMappingSet: '加载',
+    saveMappingSet: '保存',
+    failedSaveMappingSet: '保存映射集失败',
+    rowFilter: '行过滤条件',
+    rowFiltersHint: '仅对比和同步满足条件的行，条件同时作用于源库和目标库',
+    filterPlaceholder: '例如 tenant_id = 42',
+    excludeColumns: '忽略的列',
+    excludeColumnsPlaceholder: '例如 updated_at, updated_by',
+    renameColumns: '列名映射',
+    renameColumnsHint: '目标库中名称不同的源列，格式为 源列:目标列',
+    renameColumnsPlaceholder: '例如 name:full_name',
+    upsertModeHint: '新增和变更的行使用 INSERT ... ON DUPLICATE KEY UPDATE、ON CONFLICT DO UPDATE 或 MERGE 写入，同步失败后可安全地重新执行',
+    batchSize: '每条 INSERT 行数',
+    bulkLoad: '批量加载插入行',
+    bulkLoadHint: '使用 COPY (PostgreSQL)、bulk copy (SQL Server) 或 LOAD DATA LOCAL INFILE (MySQL，需服务器开启 local_infile，已存在主键的行会被跳过) 加载插入的行'
   },
   browser: {
     title: '表浏览器',